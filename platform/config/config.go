@@ -0,0 +1,345 @@
+// Package config loads a service's configuration from, in increasing order
+// of precedence, the defaults it is given, an optional YAML or TOML file,
+// environment variables and command line flags.
+//
+// Only fields with a config tag are loaded. The tag names the key in the
+// file; the environment variable is the key in upper case, and the flag is
+// the key with dashes:
+//
+//	ServerPort uint16 `config:"server_port" usage:"port to listen on"`
+//	SessionKey string `config:"session_key" secret:"true" required:"true"`
+//
+// is read from server_port in the file, SERVER_PORT in the environment and
+// -server-port on the command line. Secret values are redacted when the
+// configuration is printed. The fields of embedded structs, such as the
+// server.Config every service shares, are loaded as if they were declared
+// in the outer struct.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv is the environment variable naming the config file, when it is
+// not given with -config.
+const FileEnv = "CONFIG_FILE"
+
+// ErrPrinted is returned by Load once it has printed the configuration or
+// the usage message, and there is nothing left for the program to do.
+var ErrPrinted = errors.New("config: printed")
+
+// Validator is implemented by configurations with checks of their own. It
+// is called once every source has been loaded.
+type Validator interface {
+	Validate() error
+}
+
+type Loader struct {
+	// Name is the program name shown in the usage message.
+	Name string
+	// Args are parsed as flags. Commands with flags of their own leave it
+	// nil, and are configured through the file and environment alone.
+	Args []string
+	// Output is where -print-config writes, os.Stdout when nil.
+	Output io.Writer
+}
+
+type field struct {
+	key      string
+	value    reflect.Value
+	usage    string
+	secret   bool
+	required bool
+}
+
+// Load fills cfg, a pointer to a struct already holding the defaults. Every
+// invalid value is reported, not just the first, joined into one error.
+func (l *Loader) Load(cfg interface{}) error {
+	fields, err := fieldsOf(cfg)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet(l.Name, flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv(FileEnv), "YAML or TOML config file")
+	printConfig := fs.Bool("print-config", false, "print the configuration, with secrets redacted, and exit")
+
+	// flags are applied last, so they are only recorded while parsing
+	flagValues := map[string]string{}
+	for _, f := range fields {
+		f := f
+		fs.Func(strings.ReplaceAll(f.key, "_", "-"), f.usage, func(s string) error {
+			flagValues[f.key] = s
+			return nil
+		})
+	}
+
+	if l.Args != nil {
+		err := fs.Parse(l.Args)
+		if errors.Is(err, flag.ErrHelp) {
+			return ErrPrinted
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			raw := values[key]
+			f, ok := lookup(fields, key)
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown key %s", *configFile, key))
+				continue
+			}
+			if err := set(f.value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", *configFile, key, err))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		env := strings.ToUpper(f.key)
+		if raw, ok := os.LookupEnv(env); ok {
+			if err := set(f.value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("environment: %s: %w", env, err))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if raw, ok := flagValues[f.key]; ok {
+			if err := set(f.value, raw); err != nil {
+				errs = append(errs, fmt.Errorf("flag -%s: %w", strings.ReplaceAll(f.key, "_", "-"), err))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if f.required && f.value.IsZero() {
+			errs = append(errs, fmt.Errorf("%s is required", f.key))
+		}
+	}
+
+	if v, ok := cfg.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if *printConfig {
+		out := l.Output
+		if out == nil {
+			out = os.Stdout
+		}
+		if err := Print(out, cfg); err != nil {
+			return err
+		}
+		if len(errs) == 0 {
+			return ErrPrinted
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Print writes cfg as YAML, with secrets redacted. The output can be used as
+// a config file once the secrets are filled back in.
+func Print(w io.Writer, cfg interface{}) error {
+	fields, err := fieldsOf(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		value := format(f.value)
+		if f.secret && !f.value.IsZero() {
+			value = `"<redacted>"`
+		}
+		_, err := fmt.Fprintf(w, "%s: %s\n", f.key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fieldsOf(cfg interface{}) ([]field, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("config: must load into a pointer to a struct")
+	}
+	return structFields(v.Elem()), nil
+}
+
+func structFields(v reflect.Value) []field {
+	var fields []field
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key, ok := sf.Tag.Lookup("config")
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				fields = append(fields, structFields(v.Field(i))...)
+			}
+			continue
+		}
+		fields = append(fields, field{
+			key:      key,
+			value:    v.Field(i),
+			usage:    sf.Tag.Get("usage"),
+			secret:   sf.Tag.Get("secret") == "true",
+			required: sf.Tag.Get("required") == "true",
+		})
+	}
+	return fields
+}
+
+func lookup(fields []field, key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// readFile decodes a flat YAML or TOML file, chosen by its extension, into
+// the raw values of its keys.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &decoded)
+	case ".toml":
+		err = toml.Unmarshal(data, &decoded)
+	default:
+		return nil, fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(decoded))
+	for key, v := range decoded {
+		switch v := v.(type) {
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: %s: nested tables are not supported", path, key)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses raw into v, the same way whichever source it came from.
+func set(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", raw)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number that fits in %s", raw, v.Type())
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a positive whole number that fits in %s", raw, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func format(v reflect.Value) string {
+	if v.Type() == durationType {
+		return strconv.Quote(time.Duration(v.Int()).String())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Slice:
+		// a JSON array of strings is also a YAML flow sequence
+		data, _ := json.Marshal(v.Interface())
+		return string(data)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Shared struct {
+	Port uint16 `config:"test_port" usage:"port to listen on"`
+}
+
+type testConfig struct {
+	Shared
+	Name    string        `config:"test_name"`
+	Timeout time.Duration `config:"test_timeout"`
+	Origins []string      `config:"test_origins"`
+	Debug   bool          `config:"test_debug"`
+	Key     string        `config:"test_key" secret:"true" required:"true"`
+	Token   string        `config:"test_token" secret:"true"`
+	Ignored string
+}
+
+func (c *testConfig) Validate() error {
+	if c.Name == "invalid" {
+		return errors.New("test_name must not be invalid")
+	}
+	return nil
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func defaults() *testConfig {
+	return &testConfig{
+		Shared:  Shared{Port: 8080},
+		Name:    "default",
+		Timeout: time.Second,
+		Debug:   true,
+	}
+}
+
+func TestSourcesTakePrecedenceInOrder(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+test_port: 9000
+test_name: file
+test_timeout: 5s
+test_origins: [a, b]
+test_key: file-key
+`)
+	t.Setenv("TEST_NAME", "env")
+	t.Setenv("TEST_TIMEOUT", "10s")
+
+	cfg := defaults()
+	l := &Loader{Name: "test", Args: []string{"-config", file, "-test-timeout", "1m"}}
+	if err := l.Load(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := testConfig{
+		// the file overrides the default, the environment the file, and the
+		// flag the environment
+		Shared:  Shared{Port: 9000},
+		Name:    "env",
+		Timeout: time.Minute,
+		Origins: []string{"a", "b"},
+		Key:     "file-key",
+		// the default is kept when no source sets it
+		Debug: true,
+	}
+	if cfg.Shared != want.Shared || cfg.Name != want.Name || cfg.Timeout != want.Timeout ||
+		strings.Join(cfg.Origins, ",") != "a,b" || cfg.Debug != want.Debug || cfg.Key != want.Key {
+		t.Errorf("loaded %+v, want %+v", *cfg, want)
+	}
+}
+
+func TestFileFormats(t *testing.T) {
+	for _, file := range []string{
+		writeFile(t, "config.yml", "test_name: yaml\ntest_key: k\n"),
+		writeFile(t, "config.toml", "test_name = \"yaml\"\ntest_key = \"k\"\n"),
+	} {
+		t.Setenv(FileEnv, file)
+		cfg := defaults()
+		if err := (&Loader{Name: "test"}).Load(cfg); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if cfg.Name != "yaml" {
+			t.Errorf("%s: loaded name %q", file, cfg.Name)
+		}
+	}
+
+	t.Setenv(FileEnv, writeFile(t, "config.json", "{}"))
+	if err := (&Loader{Name: "test"}).Load(defaults()); err == nil || !strings.Contains(err.Error(), ".yaml, .yml or .toml") {
+		t.Errorf("got %v, want an error about the extension", err)
+	}
+}
+
+func TestErrorsAreJoined(t *testing.T) {
+	file := writeFile(t, "config.yaml", "test_name: invalid\ntest_colour: red\ntest_port: 70000\n")
+	t.Setenv("TEST_DEBUG", "maybe")
+
+	err := (&Loader{Name: "test", Args: []string{"-config", file, "-test-timeout", "soon"}}).Load(defaults())
+	if err == nil {
+		t.Fatal("loaded an invalid configuration")
+	}
+	for _, want := range []string{
+		file + ": unknown key test_colour",
+		file + `: test_port: "70000" is not a positive whole number that fits in uint16`,
+		`environment: TEST_DEBUG: "maybe" is not a boolean`,
+		`flag -test-timeout: "soon" is not a duration`,
+		"test_key is required",
+		"test_name must not be invalid",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not say %q", err, want)
+		}
+	}
+}
+
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	t.Setenv("TEST_KEY", "hunter2")
+	var out bytes.Buffer
+	l := &Loader{Name: "test", Args: []string{"-print-config", "-test-origins", "a,b"}, Output: &out}
+	if err := l.Load(defaults()); !errors.Is(err, ErrPrinted) {
+		t.Fatalf("got %v, want ErrPrinted", err)
+	}
+
+	want := `test_port: 8080
+test_name: "default"
+test_timeout: "1s"
+test_origins: ["a","b"]
+test_debug: true
+test_key: "<redacted>"
+test_token: ""
+`
+	if out.String() != want {
+		t.Errorf("printed\n%s\nwant\n%s", out.String(), want)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Error("printed a secret")
+	}
+
+	// what is printed loads back as it was
+	os.Unsetenv("TEST_KEY")
+	file := writeFile(t, "printed.yaml", strings.Replace(out.String(), `"<redacted>"`, "hunter2", 1))
+	cfg := defaults()
+	if err := (&Loader{Name: "test", Args: []string{"-config", file}}).Load(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Key != "hunter2" || strings.Join(cfg.Origins, ",") != "a,b" {
+		t.Errorf("loaded %+v back", *cfg)
+	}
+}
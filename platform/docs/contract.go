@@ -0,0 +1,409 @@
+package docs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Contract checks requests and responses against an OpenAPI document, so
+// tests fail when the handlers and the document drift apart. It understands
+// the parts of JSON Schema the documents use: type, enum, format date-time,
+// properties, required, additionalProperties, items, allOf, $ref and the
+// numeric and length bounds.
+type Contract struct {
+	doc map[string]interface{}
+}
+
+// Operation is one method on one path of the document.
+type Operation struct {
+	Method string
+	// Path is the path template, like /fridge/{id}
+	Path string
+	ID   string
+	// Secured operations need a bearer token
+	Secured bool
+
+	contract *Contract
+	node     map[string]interface{}
+}
+
+// LoadContract parses spec, a service's OpenAPI document.
+func LoadContract(spec []byte) (*Contract, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("openapi.yaml: %w", err)
+	}
+	return &Contract{doc: doc}, nil
+}
+
+// Operations lists every operation in the document, sorted by path and
+// method.
+func (c *Contract) Operations() []Operation {
+	var ops []Operation
+	paths, _ := c.doc["paths"].(map[string]interface{})
+	for path, item := range paths {
+		methods, _ := item.(map[string]interface{})
+		for method, node := range methods {
+			op, _ := node.(map[string]interface{})
+			if op == nil {
+				continue
+			}
+			id, _ := op["operationId"].(string)
+			security, _ := op["security"].([]interface{})
+			ops = append(ops, Operation{
+				Method:   strings.ToUpper(method),
+				Path:     path,
+				ID:       id,
+				Secured:  len(security) > 0,
+				contract: c,
+				node:     op,
+			})
+		}
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Path != ops[j].Path {
+			return ops[i].Path < ops[j].Path
+		}
+		return ops[i].Method < ops[j].Method
+	})
+	return ops
+}
+
+// Operation finds the operation with the given operationId.
+func (c *Contract) Operation(id string) (Operation, bool) {
+	for _, op := range c.Operations() {
+		if op.ID == id {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+func (op Operation) String() string {
+	return op.Method + " " + op.Path
+}
+
+// requestSchema is the JSON schema of the request body, nil when the
+// operation takes none.
+func (op Operation) requestSchema() map[string]interface{} {
+	body := op.contract.resolve(op.node["requestBody"])
+	content, _ := body["content"].(map[string]interface{})
+	media := op.contract.resolve(content["application/json"])
+	return op.contract.resolve(media["schema"])
+}
+
+// HasBody reports whether the operation takes a JSON request body.
+func (op Operation) HasBody() bool {
+	return op.requestSchema() != nil
+}
+
+// Example is the example request body given in the document.
+func (op Operation) Example() ([]byte, error) {
+	schema := op.requestSchema()
+	example, ok := schema["example"]
+	if !ok {
+		return nil, fmt.Errorf("%s: request body has no example", op)
+	}
+	return json.Marshal(example)
+}
+
+// Required lists the fields the request body must have.
+func (op Operation) Required() []string {
+	var fields []string
+	required, _ := op.requestSchema()["required"].([]interface{})
+	for _, f := range required {
+		fields = append(fields, fmt.Sprint(f))
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Fields lists every field the request body may have.
+func (op Operation) Fields() []string {
+	var fields []string
+	properties, _ := op.requestSchema()["properties"].(map[string]interface{})
+	for name := range properties {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Sample is a value the document allows for field of the request body.
+func (op Operation) Sample(field string) interface{} {
+	properties, _ := op.requestSchema()["properties"].(map[string]interface{})
+	return op.contract.sample(properties[field])
+}
+
+func (c *Contract) sample(node interface{}) interface{} {
+	schema := c.resolve(node)
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	types := typesOf(schema["type"])
+	if len(types) == 0 {
+		return nil
+	}
+	switch types[0] {
+	case "string":
+		if schema["format"] == "date-time" {
+			return time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+		}
+		return "sample"
+	case "integer", "number":
+		if n, ok := number(schema["minimum"]); ok {
+			return n
+		}
+		return 1
+	case "boolean":
+		return true
+	case "array":
+		return []interface{}{c.sample(schema["items"])}
+	case "object":
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// CheckRequest checks body is a valid request body for the operation.
+func (op Operation) CheckRequest(body []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s: request body: %w", op, err)
+	}
+	return op.contract.check(op.requestSchema(), value, "request")
+}
+
+// CheckResponse checks a response has a status the operation documents, and
+// a body of the documented type and schema.
+func (op Operation) CheckResponse(status int, header http.Header, body []byte) error {
+	responses, _ := op.node["responses"].(map[string]interface{})
+	node, ok := responses[strconv.Itoa(status)]
+	if !ok {
+		node, ok = responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%s: status %d is not documented", op, status)
+	}
+
+	response := op.contract.resolve(node)
+	content, _ := response["content"].(map[string]interface{})
+	if len(content) == 0 {
+		if len(body) > 0 {
+			return fmt.Errorf("%s: status %d has no documented body, got %q", op, status, body)
+		}
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("%s: status %d: bad Content-Type %q", op, status, header.Get("Content-Type"))
+	}
+	media, ok := content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s: status %d: Content-Type %s is not documented", op, status, mediaType)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Errorf("%s: status %d: body is not JSON: %w", op, status, err)
+	}
+	err = op.contract.check(op.contract.resolve(media)["schema"], value, "response")
+	if err != nil {
+		return fmt.Errorf("%s: status %d: %w", op, status, err)
+	}
+	return nil
+}
+
+// resolve follows a $ref, if node is one.
+func (c *Contract) resolve(node interface{}) map[string]interface{} {
+	m, _ := node.(map[string]interface{})
+	for m != nil {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+
+		var target interface{} = c.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			parent, _ := target.(map[string]interface{})
+			target = parent[part]
+		}
+		m, _ = target.(map[string]interface{})
+	}
+	return nil
+}
+
+// check validates value against schema, reporting every mismatch found.
+func (c *Contract) check(node interface{}, value interface{}, at string) error {
+	schema := c.resolve(node)
+	if schema == nil {
+		return nil
+	}
+
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(at+": "+format, args...))
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if err := c.check(sub, value, at); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if types := typesOf(schema["type"]); len(types) > 0 && !matchesType(value, types) {
+		fail("%s is not of type %s", describe(value), strings.Join(types, " or "))
+		return errors.Join(errs...)
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+			}
+		}
+		if !found {
+			fail("%v is not one of %v", value, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				fail("%q is not a date-time", v)
+			}
+		}
+		if n, ok := number(schema["maxLength"]); ok && float64(utf8.RuneCountInString(v)) > n {
+			fail("is longer than %v", n)
+		}
+		if n, ok := number(schema["minLength"]); ok && float64(utf8.RuneCountInString(v)) < n {
+			fail("is shorter than %v", n)
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && v < n {
+			fail("%v is below %v", v, n)
+		}
+		if n, ok := number(schema["maximum"]); ok && v > n {
+			fail("%v is above %v", v, n)
+		}
+	case []interface{}:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			fail("has fewer than %v items", n)
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			fail("has more than %v items", n)
+		}
+		for i, item := range v {
+			if err := c.check(schema["items"], item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	case map[string]interface{}:
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := v[name.(string)]; !ok {
+				fail("is missing %s", name)
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, field := range v {
+			sub, ok := properties[name]
+			switch {
+			case ok:
+			case schema["additionalProperties"] == false:
+				fail("has undocumented field %s", name)
+				continue
+			default:
+				sub = schema["additionalProperties"]
+			}
+			if err := c.check(sub, field, at+"."+name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func typesOf(node interface{}) []string {
+	switch t := node.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, len(t))
+		for i, s := range t {
+			types[i] = fmt.Sprint(s)
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describe(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func number(node interface{}) (float64, bool) {
+	switch n := node.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
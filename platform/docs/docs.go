@@ -0,0 +1,43 @@
+// Package docs serves a service's OpenAPI description, and a page that
+// renders it, and checks requests and responses against it in tests.
+package docs
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+)
+
+// the UI is loaded from a CDN, so the services do not carry its assets
+const page = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>%s API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css">
+</head>
+<body>
+  <div id="docs"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "openapi.yaml", dom_id: "#docs" });
+  </script>
+</body>
+</html>
+`
+
+// Handler serves the UI at /docs/ and spec at /docs/openapi.yaml. The UI
+// fetches the document relative to its own path, so both can be moved
+// behind a proxy together.
+func Handler(title string, spec []byte) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /docs/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, page, html.EscapeString(title))
+	})
+	mux.HandleFunc("GET /docs/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(spec)
+	})
+	return mux
+}
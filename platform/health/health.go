@@ -0,0 +1,131 @@
+// Package health reports whether a service is alive, and whether the
+// dependencies it cannot serve requests without can be reached.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+)
+
+// Check probes one dependency, returning nil when it can be used.
+type Check func(ctx context.Context) error
+
+// Registry holds the checks readiness is made of.
+type Registry struct {
+	// how long each check may take before the dependency is reported
+	// unavailable
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	names  []string
+	checks map[string]Check
+}
+
+// Register adds check under name, which is how it is reported by Ready.
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.checks == nil {
+		r.checks = map[string]Check{}
+	}
+	if _, ok := r.checks[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.checks[name] = check
+}
+
+// Check runs every check, and joins the errors of those that failed.
+func (r *Registry) Check(ctx context.Context) error {
+	var errs []error
+	for _, res := range r.run(ctx) {
+		if res.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.name, res.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type result struct {
+	name string
+	err  error
+}
+
+// run calls the checks at the same time, so readiness takes as long as the
+// slowest of them. Results are in the order the checks were registered.
+func (r *Registry) run(ctx context.Context) []result {
+	r.mu.Lock()
+	names := append([]string(nil), r.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = r.checks[name]
+	}
+	timeout := r.Timeout
+	r.mu.Unlock()
+
+	results := make([]result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			ctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			results[i] = result{name: names[i], err: check(ctx)}
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// Live reports that the process is up and serving requests. It runs no
+// checks, so a slow dependency does not get the service restarted.
+func (r *Registry) Live(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+// Ready reports the result of every check, and whether the service can do
+// anything useful with a request.
+func (r *Registry) Ready(w http.ResponseWriter, req *http.Request) {
+	report := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{
+		Status: "ok",
+		Checks: map[string]string{},
+	}
+
+	status := http.StatusOK
+	for _, res := range r.run(req.Context()) {
+		if res.err == nil {
+			report.Checks[res.name] = "ok"
+			continue
+		}
+		logging.Logger(req.Context()).Warn("dependency is unavailable", "check", res.name, "err", res.err)
+		report.Checks[res.name] = res.err.Error()
+		report.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	res, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(res)
+}
@@ -0,0 +1,137 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func ready(t *testing.T, r *Registry) (int, report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %q", ct)
+	}
+	var got report
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, got
+}
+
+func ok(ctx context.Context) error { return nil }
+
+// hang blocks until its check times out.
+func hang(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks map[string]Check
+		status int
+		want   report
+	}{
+		{"no checks", nil, http.StatusOK, report{"ok", map[string]string{}}},
+		{"every check passes", map[string]Check{"firestore": ok, "finance": ok}, http.StatusOK,
+			report{"ok", map[string]string{"firestore": "ok", "finance": "ok"}}},
+		{"a check fails", map[string]Check{"firestore": ok, "finance": func(ctx context.Context) error { return errors.New("connection refused") }},
+			http.StatusServiceUnavailable, report{"unavailable", map[string]string{"firestore": "ok", "finance": "connection refused"}}},
+		{"a check times out", map[string]Check{"firestore": hang, "finance": ok}, http.StatusServiceUnavailable,
+			report{"unavailable", map[string]string{"firestore": "context deadline exceeded", "finance": "ok"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Registry{Timeout: 20 * time.Millisecond}
+			for name, check := range tt.checks {
+				r.Register(name, check)
+			}
+
+			status, got := ready(t, r)
+			if status != tt.status || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %d %+v, want %d %+v", status, got, tt.status, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksRunTogether(t *testing.T) {
+	r := &Registry{Timeout: 100 * time.Millisecond}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		r.Register(name, hang)
+	}
+
+	start := time.Now()
+	status, _ := ready(t, r)
+	if took := time.Since(start); took > 300*time.Millisecond {
+		t.Errorf("four checks timing out took %v, want about one timeout", took)
+	}
+	if status != http.StatusServiceUnavailable {
+		t.Errorf("got %d, want %d", status, http.StatusServiceUnavailable)
+	}
+}
+
+func TestReadyStopsWithTheRequest(t *testing.T) {
+	// without a timeout of its own, a check lasts as long as the request
+	r := &Registry{}
+	r.Register("firestore", hang)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	r.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil).WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "context canceled") {
+		t.Errorf("got %d %s, want the check canceled", rec.Code, rec.Body)
+	}
+}
+
+func TestCheckJoinsFailures(t *testing.T) {
+	r := &Registry{Timeout: 20 * time.Millisecond}
+	r.Register("firestore", hang)
+	r.Register("finance", func(ctx context.Context) error { return errors.New("connection refused") })
+	r.Register("sheets", ok)
+
+	err := r.Check(context.Background())
+	if err == nil || err.Error() != "firestore: context deadline exceeded\nfinance: connection refused" {
+		t.Errorf("got %v, want the failures in the order registered", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want it to wrap the check's error", err)
+	}
+
+	// registering a name again replaces its check
+	r.Register("firestore", ok)
+	r.Register("finance", ok)
+	if err := r.Check(context.Background()); err != nil {
+		t.Errorf("got %v once every check passes", err)
+	}
+}
+
+func TestLiveRunsNoChecks(t *testing.T) {
+	r := &Registry{}
+	r.Register("firestore", func(ctx context.Context) error {
+		t.Error("liveness ran a check")
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	r.Live(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"status":"ok"}` {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,174 @@
+// Package logging writes structured JSON logs, and ties every log line
+// written while serving a request to that request through its ID.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// request IDs sent by clients are only propagated if they look like one
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var quietPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// New returns a JSON logger writing to w, and makes it the default logger
+// for both log/slog and log.
+func New(w io.Writer, level string) *slog.Logger {
+	logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: parseLevel(level),
+	}))
+	slog.SetDefault(logger)
+	return logger
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+type ctxKey struct{}
+
+type requestInfo struct {
+	mu     sync.Mutex
+	id     string
+	user   string
+	logger *slog.Logger
+}
+
+// Middleware assigns each request an ID, or propagates the one it was sent
+// with, and logs the request once it has been served.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return handler(logger, next)
+	}
+}
+
+func handler(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		info := &requestInfo{
+			id:     id,
+			logger: logger.With("request_id", id),
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), ctxKey{}, info)))
+
+		// successful health probes are made every few seconds and would
+		// drown out everything else
+		level := slog.LevelInfo
+		if quietPaths[r.URL.Path] && rec.status < 300 {
+			level = slog.LevelDebug
+		}
+
+		logger.Log(r.Context(), level, "request",
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"bytes", rec.bytes,
+			"user", info.username(),
+		)
+	})
+}
+
+// Logger returns the logger of the request ctx belongs to, or the default
+// logger outside of a request.
+func Logger(ctx context.Context) *slog.Logger {
+	info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+	if !ok {
+		return slog.Default()
+	}
+
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.logger
+}
+
+// RequestID returns the ID of the request ctx belongs to.
+func RequestID(ctx context.Context) string {
+	info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.id
+}
+
+// SetUser records who made the request, once they have been authenticated.
+// It is added to every line logged for the request from then on.
+func SetUser(ctx context.Context, username string) {
+	info, ok := ctx.Value(ctxKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.user = username
+	info.logger = info.logger.With("user", username)
+}
+
+func (i *requestInfo) username() string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.user
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// serve sends a request with the X-Request-ID sent, through the middleware
+// to h, and returns the response and every line logged, decoded.
+func serve(t *testing.T, sent string, path string, h http.HandlerFunc) (*httptest.ResponseRecorder, []map[string]interface{}) {
+	t.Helper()
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if sent != "" {
+		r.Header.Set(RequestIDHeader, sent)
+	}
+	rec := httptest.NewRecorder()
+	Middleware(logger)(h).ServeHTTP(rec, r)
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&logs)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	return rec, lines
+}
+
+func TestRequestIDs(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	tests := []struct {
+		name string
+		sent string
+		// whether the ID sent is the one used
+		kept bool
+	}{
+		{"none sent", "", false},
+		{"sent", "edge-1234.abc_DEF", true},
+		{"sent too long", string(bytes.Repeat([]byte("a"), 65)), false},
+		{"sent with other characters", "id\nforged=1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			rec, lines := serve(t, tt.sent, "/fridge", func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+				Logger(r.Context()).Info("handling")
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			id := rec.Header().Get(RequestIDHeader)
+			if tt.kept && id != tt.sent {
+				t.Errorf("responded with ID %q, want the one sent, %q", id, tt.sent)
+			}
+			if !tt.kept && !generated.MatchString(id) {
+				t.Errorf("responded with ID %q, want a generated one", id)
+			}
+			if seen != id {
+				t.Errorf("the handler saw ID %q, want %q", seen, id)
+			}
+
+			// the handler's line and the request's both carry it
+			if len(lines) != 2 {
+				t.Fatalf("logged %v, want the handler's line and the request's", lines)
+			}
+			for _, line := range lines {
+				if line["request_id"] != id {
+					t.Errorf("logged %v, want request_id %s", line, id)
+				}
+			}
+			if req := lines[1]; req["msg"] != "request" || req["path"] != "/fridge" || req["status"] != float64(http.StatusCreated) {
+				t.Errorf("logged the request as %v", req)
+			}
+		})
+	}
+}
+
+func TestSetUserIsLoggedFromThenOn(t *testing.T) {
+	_, lines := serve(t, "", "/fridge", func(w http.ResponseWriter, r *http.Request) {
+		Logger(r.Context()).Info("before")
+		SetUser(r.Context(), "nathan")
+		Logger(r.Context()).Info("after")
+	})
+
+	if len(lines) != 3 {
+		t.Fatalf("logged %v", lines)
+	}
+	if _, ok := lines[0]["user"]; ok {
+		t.Errorf("logged %v, want no user before authentication", lines[0])
+	}
+	if lines[1]["user"] != "nathan" || lines[2]["user"] != "nathan" {
+		t.Errorf("logged %v, want the user after authentication and with the request", lines[1:])
+	}
+}
+
+func TestHealthProbesAreQuiet(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	if _, lines := serve(t, "", "/readyz", ok); len(lines) != 0 {
+		t.Errorf("logged a successful probe at info: %v", lines)
+	}
+
+	failing := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) }
+	if _, lines := serve(t, "", "/readyz", failing); len(lines) != 1 {
+		t.Errorf("logged %v, want a failed probe logged", lines)
+	}
+}
+
+func TestOutsideARequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if id := RequestID(r.Context()); id != "" {
+		t.Errorf("got request ID %q outside a request", id)
+	}
+	if Logger(r.Context()) != slog.Default() {
+		t.Error("got a logger other than the default outside a request")
+	}
+	SetUser(r.Context(), "nathan")
+}
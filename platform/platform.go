@@ -0,0 +1,71 @@
+// Package platform holds what every service is built on, so a service's
+// main is
+//
+//	func main() {
+//		platform.Main("wtfinance", application.LoadConfig,
+//			func(ctx context.Context, cfg application.Config) (platform.Service, error) {
+//				return application.New(ctx, cfg)
+//			})
+//	}
+//
+// Its packages load configuration (config), log requests (logging), trace
+// them (tracing), validate their bodies (validate), write problem responses
+// (problem), serve and check the OpenAPI documents (docs), report health
+// (health) and run the server, its workers and its shutdown (server).
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/NathanRJohnson/live-backend/platform/config"
+)
+
+// Service is a running service, built from its configuration.
+type Service interface {
+	// Start serves until ctx is done, then shuts down cleanly.
+	Start(ctx context.Context) error
+}
+
+// SignalContext returns a copy of ctx that is done once the process is
+// interrupted, or terminated as docker stops a container.
+func SignalContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+}
+
+// Main loads the configuration from the command line with load, builds the
+// service with build and runs it until it is signalled to stop. It exits
+// with status 2 when the configuration is invalid, and 1 when the service
+// fails.
+func Main[C any](name string, load func(args []string) (C, error), build func(context.Context, C) (Service, error)) {
+	ctx, cancel := SignalContext(context.Background())
+	defer cancel()
+
+	cfg, err := load(os.Args[1:])
+	if errors.Is(err, config.ErrPrinted) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	service, err := build(ctx, cfg)
+	if err != nil {
+		slog.Error("failed to initialize "+name, "err", err)
+		cancel()
+		os.Exit(1)
+	}
+
+	err = service.Start(ctx)
+	if err != nil {
+		slog.Error(name+" stopped", "err", err)
+		cancel()
+		os.Exit(1)
+	}
+}
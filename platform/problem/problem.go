@@ -0,0 +1,94 @@
+// Package problem writes RFC 7807 problem details responses, so every
+// service reports errors the same way.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+)
+
+// Error codes sent in problem responses. Clients can rely on them not
+// changing, unlike the detail message.
+const (
+	CodeBadRequest   = "bad_request"
+	CodeInvalid      = "invalid"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeRateLimited  = "rate_limited"
+	CodeTooLarge     = "too_large"
+	CodeInternal     = "internal"
+	CodeUnavailable  = "unavailable"
+	CodeUpstream     = "upstream"
+)
+
+// Problem is an RFC 7807 problem details response body.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	// every field that failed validation, for invalid requests
+	Errors validate.Errors `json:"errors,omitempty"`
+}
+
+// Write responds with a problem+json body. detail is shown to the client,
+// so must not carry internal errors.
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	send(w, newProblem(r, status, code, detail))
+}
+
+// WriteInvalid responds with every field error found in the request.
+func WriteInvalid(w http.ResponseWriter, r *http.Request, errs validate.Errors) {
+	problem := newProblem(r, http.StatusBadRequest, CodeInvalid, "the request has invalid fields")
+	problem.Errors = errs
+	send(w, problem)
+}
+
+func newProblem(r *http.Request, status int, code string, detail string) Problem {
+	return Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: logging.RequestID(r.Context()),
+	}
+}
+
+func send(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// Decode decodes and validates the request body into dst. When it cannot,
+// it responds with why and returns false.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	err := validate.Decode(w, r, dst)
+	if err == nil {
+		return true
+	}
+
+	var fieldErrs validate.Errors
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &fieldErrs):
+		WriteInvalid(w, r, fieldErrs)
+	case errors.As(err, &tooLarge):
+		Write(w, r, http.StatusRequestEntityTooLarge, CodeTooLarge, fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit))
+	default:
+		Write(w, r, http.StatusBadRequest, CodeBadRequest, err.Error())
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package problem
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+)
+
+func TestDecodeRespondsWithTheProblem(t *testing.T) {
+	type body struct {
+		Name string `json:"name" validate:"required"`
+	}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+		detail string
+		errors validate.Errors
+	}{
+		{"invalid fields", `{"name":"","colour":"red"}`, http.StatusBadRequest, CodeInvalid, "the request has invalid fields",
+			validate.Errors{{Field: "colour", Message: "is not a known field"}, {Field: "name", Message: "is required"}}},
+		{"not JSON", `{"name"`, http.StatusBadRequest, CodeBadRequest, "request body is not valid JSON: unexpected EOF", nil},
+		{"too large", `{"name":"` + strings.Repeat("a", validate.MaxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, CodeTooLarge, "request body must not exceed 1048576 bytes", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Problem
+			var ok bool
+			// the request ID the logging middleware gives the request is sent
+			// back with the problem
+			var requestID string
+			h := logging.Middleware(logging.New(io.Discard, "error"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestID = logging.RequestID(r.Context())
+				ok = Decode(w, r, &body{})
+			}))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(tt.body)))
+
+			if ok {
+				t.Fatal("decoded the body")
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("got content type %q", ct)
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.status || got.Status != tt.status || got.Title != http.StatusText(tt.status) || got.Type != "about:blank" ||
+				got.Code != tt.code || got.Detail != tt.detail || got.Instance != "/items" || got.RequestID == "" || got.RequestID != requestID {
+				t.Errorf("got %d %+v, want %d %s %q for request %s", rec.Code, got, tt.status, tt.code, tt.detail, requestID)
+			}
+			if len(got.Errors) != len(tt.errors) {
+				t.Fatalf("got field errors %v, want %v", got.Errors, tt.errors)
+			}
+			for i := range tt.errors {
+				if got.Errors[i] != tt.errors[i] {
+					t.Errorf("got field errors %v, want %v", got.Errors, tt.errors)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config is the configuration every service shares. Services embed it in
+// their own, so its keys are loaded alongside theirs.
+type Config struct {
+	ServerPort uint16 `config:"server_port" usage:"port to listen on"`
+	// one of debug, info, warn or error
+	LogLevel string `config:"log_level" usage:"one of debug, info, warn or error"`
+	// where spans are sent, "none", "otlp" or "stdout"
+	TraceExporter    string        `config:"trace_exporter" usage:"none, otlp or stdout"`
+	IdleTimeout      time.Duration `config:"idle_timeout" usage:"how long idle connections are kept open"`
+	ShutdownTimeout  time.Duration `config:"shutdown_timeout" usage:"how long to wait for requests and workers to finish on shutdown"`
+	ReadinessTimeout time.Duration `config:"readiness_timeout" usage:"how long readiness waits on each dependency"`
+	// TLS is served when both are set, in place of plain HTTP
+	TLSCertFile string `config:"tls_cert_file" usage:"PEM certificate to serve, TLS is off when empty"`
+	TLSKeyFile  string `config:"tls_key_file" usage:"PEM private key of tls_cert_file"`
+	// signs the certificates of the other services, and of clients when
+	// TLSClientAuth is set
+	TLSCAFile     string `config:"tls_ca_file" usage:"PEM CA trusted for the other services and clients, the system roots when empty"`
+	TLSClientAuth bool   `config:"tls_client_auth" usage:"require client certificates signed by tls_ca_file"`
+	// how often the files are checked, so renewed certificates are used
+	// without a restart
+	TLSReloadInterval time.Duration `config:"tls_reload_interval" usage:"how often certificate files are checked for changes"`
+	// a plain HTTP port redirecting to the TLS one, 0 for none
+	RedirectPort uint16 `config:"redirect_port" usage:"plain HTTP port redirecting to HTTPS, 0 for none"`
+}
+
+// TLSEnabled reports whether the server listens with TLS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+var DefaultConfig = Config{
+	ServerPort:       3000,
+	LogLevel:         "info",
+	TraceExporter:    "none",
+	IdleTimeout:      30 * time.Second,
+	ShutdownTimeout:  10 * time.Second,
+	ReadinessTimeout: 3 * time.Second,
+
+	TLSReloadInterval: time.Minute,
+}
+
+// Validate checks the values that parse but make no sense. Services call it
+// from their own Validate, which hides this one.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ServerPort == 0 {
+		errs = append(errs, errors.New("server_port must not be 0"))
+	}
+	if !OneOf(c.LogLevel, "debug", "info", "warn", "error") {
+		errs = append(errs, fmt.Errorf("log_level %q must be debug, info, warn or error", c.LogLevel))
+	}
+	if !OneOf(c.TraceExporter, "none", "otlp", "stdout") {
+		errs = append(errs, fmt.Errorf("trace_exporter %q must be none, otlp or stdout", c.TraceExporter))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls_cert_file and tls_key_file must be set together"))
+	}
+	if c.TLSClientAuth && (!c.TLSEnabled() || c.TLSCAFile == "") {
+		errs = append(errs, errors.New("tls_client_auth needs tls_cert_file, tls_key_file and tls_ca_file"))
+	}
+	if c.RedirectPort != 0 && !c.TLSEnabled() {
+		errs = append(errs, errors.New("redirect_port needs tls_cert_file and tls_key_file"))
+	}
+	if c.RedirectPort != 0 && c.RedirectPort == c.ServerPort {
+		errs = append(errs, errors.New("redirect_port must differ from server_port"))
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout},
+		{"readiness_timeout", c.ReadinessTimeout},
+		{"tls_reload_interval", c.TLSReloadInterval},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.key))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// OneOf reports whether value is one of allowed.
+func OneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
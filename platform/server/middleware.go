@@ -0,0 +1,18 @@
+package server
+
+import "net/http"
+
+// Middleware wraps a handler with behaviour of its own.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in every middleware, the first outermost, so
+//
+//	server.Chain(router, logging.Middleware(logger), tracing.Middleware)
+//
+// logs each request around the span tracing it.
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
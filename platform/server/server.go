@@ -0,0 +1,240 @@
+// Package server runs a service's HTTP server and the background workers
+// started alongside it, and shuts both down cleanly when the service is
+// stopped.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/health"
+)
+
+// Server serves Handler until the context given to Run is done. It then
+// stops accepting connections, waits for requests in flight and background
+// workers to finish, and runs the shutdown hooks, in that order.
+type Server struct {
+	Config  Config
+	Handler http.Handler
+	// the server refuses to start until every check passes, optional
+	Health *health.Registry
+	// slog.Default when nil
+	Logger *slog.Logger
+
+	mu      sync.Mutex
+	workers sync.WaitGroup
+	// workers registered before Run, started once it is ready
+	pending []worker
+	started bool
+	// cancels the context workers are given
+	stopWorkers context.CancelFunc
+	workerCtx   context.Context
+	hooks       []hook
+	// loaded on first use, when TLS is configured
+	certificates *certificates
+}
+
+type worker struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
+// Go runs fn in the background until the server shuts down, which cancels
+// ctx and then waits for fn to return. Workers registered before Run are
+// started once the health checks pass. An error is logged, it does not stop
+// the server.
+func (s *Server) Go(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := worker{name: name, fn: fn}
+	if !s.started {
+		s.pending = append(s.pending, w)
+		return
+	}
+	s.start(w)
+}
+
+// start runs w, s.mu must be held.
+func (s *Server) start(w worker) {
+	if s.workerCtx == nil {
+		s.workerCtx, s.stopWorkers = context.WithCancel(context.Background())
+	}
+	ctx := s.workerCtx
+
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		if err := w.fn(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			s.logger().Error("worker failed", "worker", w.name, "err", err)
+		}
+	}()
+}
+
+// OnShutdown registers fn to run once requests and workers have drained,
+// such as closing a client or flushing telemetry. Hooks run in the reverse
+// of the order they were registered, and run even when the server failed
+// to start.
+func (s *Server) OnShutdown(name string, fn func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, hook{name: name, fn: fn})
+}
+
+// Run serves requests until ctx is done, then shuts the server down. It
+// returns early if the certificates cannot be loaded, the health checks fail
+// or the server cannot listen.
+func (s *Server) Run(ctx context.Context) error {
+	defer s.runHooks()
+
+	server := &http.Server{
+		Addr:        fmt.Sprintf(":%d", s.Config.ServerPort),
+		Handler:     s.Handler,
+		IdleTimeout: s.Config.IdleTimeout,
+	}
+	servers := []*http.Server{server}
+
+	if s.Config.TLSEnabled() {
+		tlsConfig, err := s.serverTLS()
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = tlsConfig
+		if s.Config.TLSClientAuth {
+			server.Handler = requireClientCert(server.Handler)
+		}
+
+		certs, _ := s.certs()
+		s.Go("reload certificates", func(ctx context.Context) error {
+			return certs.watch(ctx, s.Config.TLSReloadInterval, s.logger())
+		})
+
+		if s.Config.RedirectPort != 0 {
+			servers = append(servers, &http.Server{
+				Addr:        fmt.Sprintf(":%d", s.Config.RedirectPort),
+				Handler:     redirect(s.Config.ServerPort),
+				IdleTimeout: s.Config.IdleTimeout,
+			})
+		}
+	}
+
+	if s.Health != nil {
+		if err := s.Health.Check(ctx); err != nil {
+			return fmt.Errorf("not ready: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.started = true
+	for _, w := range s.pending {
+		s.start(w)
+	}
+	s.pending = nil
+	s.mu.Unlock()
+
+	s.logger().Info("starting server", "port", s.Config.ServerPort, "tls", s.Config.TLSEnabled(), "client_auth", s.Config.TLSClientAuth)
+	if s.Config.RedirectPort != 0 {
+		s.logger().Info("redirecting to https", "port", s.Config.RedirectPort)
+	}
+
+	ch := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			var err error
+			if srv.TLSConfig != nil {
+				// the certificate comes from TLSConfig, so no files are
+				// named here
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				ch <- fmt.Errorf("failed to start server on %s: %w", srv.Addr, err)
+			}
+		}(srv)
+	}
+
+	var err error
+	select {
+	case err = <-ch:
+	case <-ctx.Done():
+		s.logger().Info("shutting down", "timeout", s.shutdownTimeout())
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+
+	// workers are stopped while requests already being served finish
+	workersDone := make(chan struct{})
+	go func() {
+		s.drainWorkers()
+		close(workersDone)
+	}()
+
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(timeout); err == nil {
+			err = shutdownErr
+		}
+	}
+
+	select {
+	case <-workersDone:
+	case <-timeout.Done():
+		s.logger().Warn("workers did not stop in time")
+	}
+
+	return err
+}
+
+// drainWorkers cancels the workers' context and waits for them to return.
+func (s *Server) drainWorkers() {
+	s.mu.Lock()
+	stop := s.stopWorkers
+	s.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+	s.workers.Wait()
+}
+
+func (s *Server) runHooks() {
+	s.mu.Lock()
+	hooks := s.hooks
+	s.mu.Unlock()
+
+	// the drain may have used up the shutdown timeout, so hooks are given
+	// one of their own
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout())
+	defer cancel()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].fn(ctx); err != nil {
+			s.logger().Error("shutdown hook failed", "hook", hooks[i].name, "err", err)
+		}
+	}
+}
+
+func (s *Server) shutdownTimeout() time.Duration {
+	if s.Config.ShutdownTimeout <= 0 {
+		return DefaultConfig.ShutdownTimeout
+	}
+	return s.Config.ShutdownTimeout
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// certificates holds the certificate the server presents, and the CA it
+// trusts, as last read from their files.
+type certificates struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+	// contents last loaded, so a file that was touched but not changed
+	// is not reloaded
+	loaded []byte
+}
+
+// load reads the files, and keeps what was loaded before when they are
+// invalid.
+func (c *certificates) load() error {
+	var contents []byte
+	for _, path := range []string{c.certFile, c.keyFile, c.caFile} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		contents = append(contents, data...)
+	}
+
+	c.mu.RLock()
+	unchanged := bytes.Equal(contents, c.loaded)
+	c.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	var cert *tls.Certificate
+	if c.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if c.caFile != "" {
+		data, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("%s holds no PEM certificates", c.caFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = cert
+	c.pool = pool
+	c.loaded = contents
+	return nil
+}
+
+// watch reloads the files every interval until ctx is done, so renewed
+// certificates are served without a restart.
+func (c *certificates) watch(ctx context.Context, interval time.Duration, logger *slog.Logger) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		c.mu.RLock()
+		before := c.loaded
+		c.mu.RUnlock()
+
+		if err := c.load(); err != nil {
+			logger.Error("failed to reload certificates, still serving the previous ones", "err", err)
+			continue
+		}
+
+		c.mu.RLock()
+		changed := !bytes.Equal(before, c.loaded)
+		c.mu.RUnlock()
+		if changed {
+			logger.Info("reloaded certificates", "cert", c.certFile)
+		}
+	}
+}
+
+func (c *certificates) certificate() *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert
+}
+
+func (c *certificates) roots() *x509.CertPool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pool
+}
+
+// certs returns the server's certificates, loading them the first time.
+func (s *Server) certs() (*certificates, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.certificates != nil {
+		return s.certificates, nil
+	}
+	c := &certificates{
+		certFile: s.Config.TLSCertFile,
+		keyFile:  s.Config.TLSKeyFile,
+		caFile:   s.Config.TLSCAFile,
+	}
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("failed to load certificates: %w", err)
+	}
+	s.certificates = c
+	return c, nil
+}
+
+// serverTLS is the configuration the server listens with. HTTP/2 is
+// offered ahead of HTTP/1.1, and client certificates are verified when
+// TLSClientAuth is set. They are required by requireClientCert rather than
+// the handshake, so health probes can be made without one.
+func (s *Server) serverTLS() (*tls.Config, error) {
+	certs, err := s.certs()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certs.certificate(), nil
+		},
+	}
+
+	if s.Config.TLSClientAuth {
+		// the CA is looked up for every handshake, so a reloaded one is
+		// used straight away
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := cfg.Clone()
+			c.GetConfigForClient = nil
+			c.ClientAuth = tls.VerifyClientCertIfGiven
+			c.ClientCAs = certs.roots()
+			return c, nil
+		}
+	}
+	return cfg, nil
+}
+
+// ClientTLS is the configuration for calling the other services. They are
+// trusted if their certificates are signed by TLSCAFile, or by the system
+// roots when it is not set, and the server's own certificate is presented
+// to those that ask for one. It is nil when TLS is not configured.
+func (s *Server) ClientTLS() (*tls.Config, error) {
+	if !s.Config.TLSEnabled() && s.Config.TLSCAFile == "" {
+		return nil, nil
+	}
+	certs, err := s.certs()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// the chain is verified in VerifyConnection, against the CA as
+		// it is when the connection is made
+		InsecureSkipVerify: certs.roots() != nil,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			roots := certs.roots()
+			if roots == nil {
+				return nil
+			}
+			opts := x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         roots,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+	if s.Config.TLSEnabled() {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certs.certificate(), nil
+		}
+	}
+	return cfg, nil
+}
+
+// Transport is http.DefaultTransport, calling the other services with
+// ClientTLS.
+func (s *Server) Transport() (http.RoundTripper, error) {
+	cfg, err := s.ClientTLS()
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return http.DefaultTransport, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	// a custom TLS configuration turns HTTP/2 off unless asked for
+	transport.ForceAttemptHTTP2 = true
+	return transport, nil
+}
+
+// probes are made by the container runtime, which holds no certificate
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// requireClientCert refuses requests made without a verified client
+// certificate, other than health probes.
+func requireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			if !probePaths[r.URL.Path] {
+				http.Error(w, "client certificate required", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirect answers every request with a permanent redirect to the same URL
+// over HTTPS, on port.
+func redirect(port uint16) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+		// 308 rather than 301, so the method and body are kept
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,348 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA signs self-signed certificates, as scripts/gen-certs.sh does.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a certificate for localhost, usable by servers and clients,
+// and its key, both PEM encoded.
+func (ca *testCA) issue(t *testing.T, serial int64) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func freePort(t *testing.T) uint16 {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return uint16(l.Addr().(*net.TCPAddr).Port)
+}
+
+// tlsFiles writes a CA and a certificate it issued to a temporary directory,
+// and returns a configuration serving them.
+func tlsFiles(t *testing.T, ca *testCA) Config {
+	dir := t.TempDir()
+	certPEM, keyPEM := ca.issue(t, 2)
+
+	cfg := DefaultConfig
+	cfg.ServerPort = freePort(t)
+	cfg.TLSCertFile = filepath.Join(dir, "cert.pem")
+	cfg.TLSKeyFile = filepath.Join(dir, "key.pem")
+	cfg.TLSCAFile = filepath.Join(dir, "ca.pem")
+	cfg.TLSReloadInterval = 20 * time.Millisecond
+	writeFile(t, cfg.TLSCertFile, certPEM)
+	writeFile(t, cfg.TLSKeyFile, keyPEM)
+	writeFile(t, cfg.TLSCAFile, ca.pem)
+	return cfg
+}
+
+// start runs s until the test ends, once it accepts connections.
+func start(t *testing.T, s *Server) {
+	if s.Handler == nil {
+		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.Proto)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	})
+
+	addr := net.JoinHostPort("127.0.0.1", itoa(s.Config.ServerPort))
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not start on %s", addr)
+}
+
+func itoa(port uint16) string {
+	return strconv.Itoa(int(port))
+}
+
+func client(ca *testCA, cert *tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: roots}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: cfg, ForceAttemptHTTP2: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func get(t *testing.T, c *http.Client, url string) (*http.Response, string, error) {
+	t.Helper()
+	res, err := c.Get(url)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	return res, string(body), nil
+}
+
+func TestServesHTTP2OverTLS(t *testing.T) {
+	ca := newTestCA(t)
+	s := &Server{Config: tlsFiles(t, ca)}
+	start(t, s)
+
+	_, body, err := get(t, client(ca, nil), "https://localhost:"+itoa(s.Config.ServerPort)+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "HTTP/2.0" {
+		t.Errorf("served over %s, want HTTP/2.0", body)
+	}
+}
+
+func TestReloadsChangedCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsFiles(t, ca)
+	s := &Server{Config: cfg}
+	start(t, s)
+
+	serial := func() int64 {
+		conn, err := tls.Dial("tcp", "127.0.0.1:"+itoa(cfg.ServerPort), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+
+	if got := serial(); got != 2 {
+		t.Fatalf("serving certificate %d, want 2", got)
+	}
+
+	certPEM, keyPEM := ca.issue(t, 3)
+	writeFile(t, cfg.TLSKeyFile, keyPEM)
+	writeFile(t, cfg.TLSCertFile, certPEM)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for serial() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("the renewed certificate was not served")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRequiresClientCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsFiles(t, ca)
+	cfg.TLSClientAuth = true
+	s := &Server{Config: cfg}
+	start(t, s)
+
+	url := "https://localhost:" + itoa(cfg.ServerPort) + "/"
+
+	res, _, err := get(t, client(ca, nil), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("a client without a certificate got %d, want 403", res.StatusCode)
+	}
+
+	// health probes are made without one
+	res, _, err = get(t, client(ca, nil), url+"readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("a health probe got %d, want 200", res.StatusCode)
+	}
+
+	other := newTestCA(t)
+	certPEM, keyPEM := other.issue(t, 4)
+	untrusted, _ := tls.X509KeyPair(certPEM, keyPEM)
+	if _, _, err := get(t, client(ca, &untrusted), url); err == nil {
+		t.Error("a client with a certificate from another CA was let in")
+	}
+
+	// the services call each other with their own certificate
+	transport, err := s.Transport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, body, err := get(t, &http.Client{Transport: transport}, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || body != "HTTP/2.0" {
+		t.Errorf("got %d over %s, want 200 over HTTP/2.0", res.StatusCode, body)
+	}
+}
+
+func TestRedirectsToHTTPS(t *testing.T) {
+	ca := newTestCA(t)
+	cfg := tlsFiles(t, ca)
+	cfg.RedirectPort = freePort(t)
+	s := &Server{Config: cfg}
+	start(t, s)
+
+	var res *http.Response
+	var err error
+	for i := 0; i < 100; i++ {
+		res, _, err = get(t, client(ca, nil), "http://localhost:"+itoa(cfg.RedirectPort)+"/fridge/?x=1")
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "https://localhost:" + itoa(cfg.ServerPort) + "/fridge/?x=1"
+	if res.StatusCode != http.StatusPermanentRedirect || res.Header.Get("Location") != want {
+		t.Errorf("got %d to %q, want 308 to %q", res.StatusCode, res.Header.Get("Location"), want)
+	}
+}
+
+func TestRefusesToStartWithoutCertificates(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.ServerPort = freePort(t)
+	cfg.TLSCertFile = filepath.Join(t.TempDir(), "missing.pem")
+	cfg.TLSKeyFile = cfg.TLSCertFile
+
+	var hooked bool
+	s := &Server{Config: cfg}
+	s.OnShutdown("hook", func(context.Context) error {
+		hooked = true
+		return nil
+	})
+
+	err := s.Run(context.Background())
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "certificates") {
+		t.Errorf("got %v, want the certificate to be missing", err)
+	}
+	if !hooked {
+		t.Error("shutdown hooks did not run")
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"plain", func(*Config) {}, ""},
+		{"tls", func(c *Config) { c.TLSCertFile, c.TLSKeyFile = "c", "k" }, ""},
+		{"half a pair", func(c *Config) { c.TLSCertFile = "c" }, "must be set together"},
+		{"client auth without a CA", func(c *Config) { c.TLSCertFile, c.TLSKeyFile, c.TLSClientAuth = "c", "k", true }, "tls_client_auth needs"},
+		{"redirect without tls", func(c *Config) { c.RedirectPort = 80 }, "redirect_port needs"},
+		{"redirect to itself", func(c *Config) { c.TLSCertFile, c.TLSKeyFile, c.RedirectPort = "c", "k", c.ServerPort }, "must differ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig
+			tt.change(&cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
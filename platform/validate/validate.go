@@ -0,0 +1,429 @@
+// Package validate decodes request bodies and checks them against the rules
+// in their struct tags, so every handler validates the same way.
+//
+// Rules are listed, comma separated, in a validate tag:
+//
+//	Name     string   `json:"item_name" validate:"required,max=100"`
+//	Quantity *int     `json:"quantity" validate:"min=1"`
+//	Scopes   []string `json:"scopes" validate:"required,oneof=fridge:read fridge:write"`
+//
+// The rules are:
+//   - required: the field is present and not zero, blank or empty.
+//   - notblank: a string, when present, is not only whitespace.
+//   - min=n, max=n: a number's value, or the length of a string or slice.
+//   - oneof=a b: a string, or every string in a slice, is one of the values.
+//
+// Optional fields are pointers. A nil pointer passes every rule but required.
+// The fields of embedded structs are checked as if they were declared in
+// the outer struct, and those of nested structs are named by their path,
+// like address.city.
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBodyBytes is the largest request body Decode will read.
+const MaxBodyBytes = 1 << 20
+
+// FieldError is a rule a field of the request broke.
+type FieldError struct {
+	// Field is the JSON name of the field.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors holds every rule a request broke, not just the first.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, f := range e {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Decode reads the JSON body of r into dst, a pointer to a struct, and
+// validates it. Fields dst does not have are rejected. Bodies over
+// MaxBodyBytes fail with an *http.MaxBytesError. Unknown fields, values of
+// the wrong type and broken rules are returned together as Errors, and any
+// other error describes why the body is not a JSON object.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("request body is empty")
+		}
+		return fmt.Errorf("request body is not valid JSON: %w", err)
+	}
+	if dec.More() {
+		return errors.New("request body must hold a single JSON object")
+	}
+
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a pointer to a struct", dst)
+	}
+	if !isObject(raw) {
+		return errors.New("request body must be a JSON object")
+	}
+	errs := decodeObject(raw, rv.Elem(), "")
+
+	broken, err := checkStruct(rv.Elem(), "")
+	if err != nil {
+		return err
+	}
+	for _, b := range broken {
+		// a value that could not be decoded would only be reported again
+		if !errs.has(b.Field) {
+			errs = append(errs, b)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (e Errors) has(field string) bool {
+	for _, f := range e {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isObject(data json.RawMessage) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+// decodeObject decodes each member of the JSON object data into the field
+// of v it names, going on past the ones it cannot so every mistake is
+// reported. Fields are named by their path from the request body.
+func decodeObject(data json.RawMessage, v reflect.Value, prefix string) Errors {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return Errors{{Field: strings.TrimSuffix(prefix, "."), Message: "must be an object"}}
+	}
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs Errors
+	for _, name := range names {
+		sf, ok := fieldNamed(v.Type(), name)
+		if !ok {
+			errs = append(errs, FieldError{Field: prefix + name, Message: "is not a known field"})
+			continue
+		}
+		errs = append(errs, decodeValue(members[name], v.FieldByIndex(sf.Index), prefix+jsonName(sf))...)
+	}
+	return errs
+}
+
+// decodeValue decodes data into v, going into structs member by member.
+func decodeValue(data json.RawMessage, v reflect.Value, path string) Errors {
+	t := v.Type()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct && !decodesItself(t) && isObject(data) {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(t))
+			}
+			v = v.Elem()
+		}
+		return decodeObject(data, v, path+".")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v.Addr().Interface())
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field != "" {
+			path += "." + typeErr.Field
+		}
+		return Errors{{Field: path, Message: "must be " + describe(typeErr.Type)}}
+	}
+	// the decoder has no typed error for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return Errors{{Field: path + "." + strings.Trim(field, `"`), Message: "is not a known field"}}
+	}
+	return Errors{{Field: path, Message: "must be " + describe(v.Type())}}
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func decodesItself(t reflect.Type) bool {
+	return reflect.PointerTo(t).Implements(unmarshalerType)
+}
+
+// fieldNamed is the field of t that the JSON member name decodes into,
+// matching as encoding/json does: exactly, or else ignoring case.
+func fieldNamed(t reflect.Type, name string) (reflect.StructField, bool) {
+	var folded reflect.StructField
+	for _, sf := range jsonFields(t) {
+		switch {
+		case jsonName(sf) == name:
+			return sf, true
+		case folded.Index == nil && strings.EqualFold(jsonName(sf), name):
+			folded = sf
+		}
+	}
+	return folded, folded.Index != nil
+}
+
+// jsonFields are the fields of t that decode from JSON, with those of
+// embedded structs as if they were declared in t.
+func jsonFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			for _, embedded := range jsonFields(sf.Type) {
+				embedded.Index = append([]int{i}, embedded.Index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		if !sf.IsExported() || sf.Tag.Get("json") == "-" {
+			continue
+		}
+		fields = append(fields, sf)
+	}
+	return fields
+}
+
+// describer is implemented by types that decode from JSON in their own
+// way, to say what they expect.
+type describer interface {
+	Describe() string
+}
+
+func describe(t reflect.Type) string {
+	if d, ok := reflect.Zero(t).Interface().(describer); ok {
+		return d.Describe()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	default:
+		return "a " + t.String()
+	}
+}
+
+// Struct checks v, a struct or a pointer to one, against its validate tags.
+func Struct(v interface{}) error {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", v)
+	}
+
+	errs, err := checkStruct(rv, "")
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkStruct checks the fields of rv, and those of the structs they hold,
+// naming them by their path from prefix.
+func checkStruct(rv reflect.Value, prefix string) (Errors, error) {
+	var errs Errors
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			embedded, err := checkStruct(rv.Field(i), prefix)
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, embedded...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := prefix + jsonName(sf)
+		if nested := reflect.Indirect(rv.Field(i)); nested.Kind() == reflect.Struct && !decodesItself(nested.Type()) {
+			inner, err := checkStruct(nested, name+".")
+			if err != nil {
+				return nil, err
+			}
+			errs = append(errs, inner...)
+		}
+
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			msg, err := check(rv.Field(i), rule)
+			if err != nil {
+				return nil, fmt.Errorf("validate: %s: %w", sf.Name, err)
+			}
+			if msg != "" {
+				errs = append(errs, FieldError{Field: name, Message: msg})
+				// later rules of a missing field would only repeat it
+				break
+			}
+		}
+	}
+	return errs, nil
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// check applies one rule to v, returning why it fails, or an error when the
+// rule itself is malformed.
+func check(v reflect.Value, rule string) (string, error) {
+	name, arg, _ := strings.Cut(rule, "=")
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if name == "required" {
+				return "is required", nil
+			}
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	switch name {
+	case "required":
+		if isBlank(v) {
+			return "is required", nil
+		}
+	case "notblank":
+		if v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "" {
+			return "must not be blank", nil
+		}
+	case "min", "max":
+		return checkBound(v, name, arg)
+	case "oneof":
+		allowed := strings.Fields(arg)
+		if !isOneOf(v, allowed) {
+			return "must be one of " + strings.Join(allowed, ", "), nil
+		}
+	default:
+		return "", fmt.Errorf("unknown rule %q", rule)
+	}
+	return "", nil
+}
+
+func isBlank(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Bool:
+		// false is a value, not a missing one
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
+func checkBound(v reflect.Value, name string, arg string) (string, error) {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return "", fmt.Errorf("%s needs a number, not %q", name, arg)
+	}
+
+	var n float64
+	var unit string
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice:
+		n, unit = float64(v.Len()), " items"
+	default:
+		return "", fmt.Errorf("%s does not apply to %s", name, v.Type())
+	}
+
+	switch {
+	case name == "min" && n < bound:
+		if unit != "" {
+			return "must have at least " + arg + unit, nil
+		}
+		return "must be at least " + arg, nil
+	case name == "max" && n > bound:
+		if unit != "" {
+			return "must have at most " + arg + unit, nil
+		}
+		return "must be at most " + arg, nil
+	}
+	return "", nil
+}
+
+func isOneOf(v reflect.Value, allowed []string) bool {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String {
+		for i := 0; i < v.Len(); i++ {
+			if !contains(allowed, v.Index(i).String()) {
+				return false
+			}
+		}
+		return true
+	}
+	return v.Kind() == reflect.String && contains(allowed, v.String())
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
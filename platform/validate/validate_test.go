@@ -0,0 +1,177 @@
+package validate
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City    string `json:"city" validate:"required"`
+	Country string `json:"country" validate:"oneof=CA US"`
+}
+
+type paging struct {
+	Limit *int `json:"limit" validate:"min=1,max=100"`
+}
+
+type body struct {
+	paging
+	Name    string   `json:"name" validate:"required,max=5"`
+	Note    *string  `json:"note" validate:"notblank"`
+	Age     int      `json:"age" validate:"min=18"`
+	Tags    []string `json:"tags" validate:"max=2,oneof=a b c"`
+	Home    address  `json:"home"`
+	Work    *address `json:"work"`
+	Ignored string   `json:"-"`
+}
+
+func decode(t *testing.T, content string, dst interface{}) error {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(content))
+	return Decode(httptest.NewRecorder(), r, dst)
+}
+
+func fieldErrors(t *testing.T, err error) Errors {
+	t.Helper()
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got %v, want field errors", err)
+	}
+	return errs
+}
+
+const valid = `{"name":"milk","age":20,"home":{"city":"Guelph","country":"CA"}}`
+
+func TestStructRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Errors
+	}{
+		{"valid", valid, nil},
+		{"required missing", `{"age":20,"home":{"city":"Guelph","country":"CA"}}`, Errors{{"name", "is required"}}},
+		{"required blank", `{"name":"  ","age":20,"home":{"city":"Guelph","country":"CA"}}`, Errors{{"name", "is required"}}},
+		{"notblank", `{"name":"milk","note":" ","age":20,"home":{"city":"Guelph","country":"CA"}}`, Errors{{"note", "must not be blank"}}},
+		{"min of a number", `{"name":"milk","age":17,"home":{"city":"Guelph","country":"CA"}}`, Errors{{"age", "must be at least 18"}}},
+		{"max of a string", `{"name":"cheese","age":20,"home":{"city":"Guelph","country":"CA"}}`, Errors{{"name", "must have at most 5 characters"}}},
+		{"max of a slice", `{"name":"milk","age":20,"tags":["a","b","c"],"home":{"city":"Guelph","country":"CA"}}`, Errors{{"tags", "must have at most 2 items"}}},
+		{"oneof in a slice", `{"name":"milk","age":20,"tags":["a","z"],"home":{"city":"Guelph","country":"CA"}}`, Errors{{"tags", "must be one of a, b, c"}}},
+		{"embedded", `{"name":"milk","age":20,"limit":0,"home":{"city":"Guelph","country":"CA"}}`, Errors{{"limit", "must be at least 1"}}},
+		{"nested", `{"name":"milk","age":20,"home":{"country":"MX"}}`, Errors{{"home.city", "is required"}, {"home.country", "must be one of CA, US"}}},
+		{"nested pointer", `{"name":"milk","age":20,"home":{"city":"Guelph","country":"CA"},"work":{"city":"","country":"US"}}`, Errors{{"work.city", "is required"}}},
+		{"every rule broken", `{"name":"","age":1,"home":{"city":"Guelph","country":"CA"},"limit":101}`, Errors{{"limit", "must be at most 100"}, {"name", "is required"}, {"age", "must be at least 18"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decode(t, tt.content, &body{})
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, want none", err)
+				}
+				return
+			}
+			if got := fieldErrors(t, err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeGathersEveryError(t *testing.T) {
+	var b body
+	err := decode(t, `{"name":7,"age":"old","colour":"red","home":{"city":"Guelph","country":"CA","zip":1},"work":{"city":true},"tags":["a"]}`, &b)
+	want := Errors{
+		{"age", "must be a whole number"},
+		{"colour", "is not a known field"},
+		{"home.zip", "is not a known field"},
+		{"name", "must be a string"},
+		{"work.city", "must be a string"},
+		// the fields that could be decoded are still checked
+		{"work.country", "must be one of CA, US"},
+	}
+	if got := fieldErrors(t, err); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if len(b.Tags) != 1 || b.Home.City != "Guelph" {
+		t.Errorf("decoded %+v, want the valid fields set", b)
+	}
+}
+
+func TestDecodeMatchesNamesAsJSONDoes(t *testing.T) {
+	var b body
+	if err := decode(t, `{"NAME":"milk","age":20,"home":{"City":"Guelph","country":"CA"},"limit":5}`, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Name != "milk" || b.Home.City != "Guelph" || b.Limit == nil || *b.Limit != 5 {
+		t.Errorf("decoded %+v", b)
+	}
+
+	errs := fieldErrors(t, decode(t, `{"name":"milk","age":20,"home":{"city":"Guelph","country":"CA"},"Ignored":"x"}`, &b))
+	if len(errs) != 1 || errs[0] != (FieldError{"Ignored", "is not a known field"}) {
+		t.Errorf("got %v, want a field tagged - to be unknown", errs)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", "request body is empty"},
+		{"not JSON", `{"name":`, "request body is not valid JSON"},
+		{"two values", valid + valid, "request body must hold a single JSON object"},
+		{"not an object", `["milk"]`, "request body must be a JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decode(t, tt.content, &body{})
+			var errs Errors
+			if err == nil || errors.As(err, &errs) || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("too large", func(t *testing.T) {
+		err := decode(t, `{"name":"`+strings.Repeat("a", MaxBodyBytes)+`"}`, &body{})
+		var tooLarge *http.MaxBytesError
+		if !errors.As(err, &tooLarge) {
+			t.Errorf("got %v, want a *http.MaxBytesError", err)
+		}
+	})
+}
+
+func TestMalformedRules(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"unknown rule", &struct {
+			A string `validate:"shiny"`
+		}{}},
+		{"bound without a number", &struct {
+			A int `validate:"min=many"`
+		}{}},
+		{"bound of a bool", &struct {
+			A bool `validate:"max=1"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Struct(tt.v)
+			var errs Errors
+			if err == nil || errors.As(err, &errs) {
+				t.Errorf("got %v, want an error about the rule", err)
+			}
+		})
+	}
+
+	if err := Struct("milk"); err == nil {
+		t.Error("validated a string")
+	}
+}
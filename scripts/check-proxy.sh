@@ -0,0 +1,34 @@
+#!/bin/sh
+# Checks that the proxy hides the routes only meant for the services
+# themselves, against a running stack:
+#
+#   docker compose up -d
+#   scripts/check-proxy.sh [base URL]
+#
+# Exits non-zero, listing them, when any is reachable.
+set -eu
+
+base=${1:-http://localhost}
+failed=0
+
+for path in /user/tokens/introspect /user/tokens/introspect/ //user/tokens/introspect '/user/tokens/introspect?x=1'; do
+  for method in GET POST; do
+    code=$(curl -s -o /dev/null -w '%{http_code}' -X "$method" -H 'Content-Type: application/json' -d '{}' "$base$path")
+    if [ "$code" != 404 ]; then
+      echo "$method $path: got $code, want 404"
+      failed=1
+    fi
+  done
+done
+
+# the rest of the user routes are still proxied
+code=$(curl -s -o /dev/null -w '%{http_code}' -X POST -H 'Content-Type: application/json' -d '{}' "$base/user/signin")
+if [ "$code" = 404 ] || [ "$code" = 502 ]; then
+  echo "POST /user/signin: got $code, want it proxied"
+  failed=1
+fi
+
+if [ "$failed" = 0 ]; then
+  echo "proxy ok"
+fi
+exit "$failed"
@@ -0,0 +1,39 @@
+#!/bin/sh
+# Generates a self-signed CA, and certificates it signs for the proxy and
+# both services, for trying out TLS and mutual TLS locally:
+#
+#   scripts/gen-certs.sh [dir]
+#   docker compose -f compose.yaml -f compose.tls.yaml up -d
+#
+# Each certificate can be used by a server and a client, so the services
+# present their own when calling each other. Running it again renews the
+# certificates with the same CA, which the services pick up without a
+# restart.
+set -eu
+
+dir=${1:-secrets/tls}
+days=${DAYS:-30}
+mkdir -p "$dir"
+
+if [ ! -f "$dir/ca.pem" ]; then
+  openssl ecparam -name prime256v1 -genkey -noout -out "$dir/ca-key.pem"
+  openssl req -x509 -new -key "$dir/ca-key.pem" -sha256 -days 365 \
+    -subj "/CN=live-backend local CA" -out "$dir/ca.pem"
+fi
+
+for name in proxy fridge-api finance-api; do
+  openssl ecparam -name prime256v1 -genkey -noout -out "$dir/$name-key.pem"
+  openssl req -new -key "$dir/$name-key.pem" -subj "/CN=$name" -out "$dir/$name.csr"
+  printf '%s\n' \
+    "subjectAltName=DNS:$name,DNS:localhost,IP:127.0.0.1" \
+    "keyUsage=digitalSignature" \
+    "extendedKeyUsage=serverAuth,clientAuth" > "$dir/$name.ext"
+  openssl x509 -req -in "$dir/$name.csr" -CA "$dir/ca.pem" -CAkey "$dir/ca-key.pem" \
+    -CAcreateserial -sha256 -days "$days" -extfile "$dir/$name.ext" -out "$dir/$name.pem"
+  rm "$dir/$name.csr" "$dir/$name.ext"
+done
+
+# readable by the services, which do not run as root in every image
+chmod 644 "$dir"/*.pem
+chmod 600 "$dir/ca-key.pem"
+echo "certificates written to $dir"
@@ -2,66 +2,100 @@ package application
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"time"
+	"os"
 
+	"github.com/NathanRJohnson/live-backend/platform/health"
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/server"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/repository/transaction"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
 type App struct {
-	router http.Handler
-	gss    *sheets.Service
-	config Config
+	router  http.Handler
+	gss     *sheets.Service
+	config  Config
+	logger  *slog.Logger
+	metrics *metrics.Prometheus
+	health  *health.Registry
+	server  *server.Server
+	// calls the other service, over TLS when it is configured
+	transport http.RoundTripper
+	// the spreadsheets whose subscriptions are posted
+	spreadsheets *spreadsheets
 }
 
 func New(ctx context.Context, cfg Config) (*App, error) {
-	// Initialize the Sheets API client
+	logger := logging.New(os.Stdout, cfg.LogLevel)
+
+	shutdownTracing, err := tracing.Setup(ctx, "wtfinance", cfg.TraceExporter)
+	if err != nil {
+		logger.Error("failed to set up tracing", "err", err)
+		return nil, err
+	}
+
+	// Initialize the Sheets API client, which records a span for every call
+	// through the global tracer provider
 	service, err := sheets.NewService(ctx, option.WithCredentialsJSON(cfg.ServiceKey))
 	if err != nil {
-		log.Fatalf("Unable to create Sheets service: %v", err)
+		logger.Error("unable to create sheets service", "err", err)
+		return nil, err
 	}
 
 	app := &App{
-		gss:    service,
-		config: cfg,
+		gss:     service,
+		config:  cfg,
+		logger:  logger,
+		metrics: metrics.NewPrometheus("wtfinance"),
+		health:  &health.Registry{Timeout: cfg.ReadinessTimeout},
 	}
-	app.loadRoutes()
 
-	return app, nil
-}
+	// without Sheets every request would fail, so the server refuses to
+	// start until it can be reached
+	repo := &transaction.GoogleSheetsRepo{Service: service, Metrics: app.metrics}
+	app.health.Register("sheets", func(ctx context.Context) error {
+		return repo.Ping(ctx, cfg.HealthSheetRef)
+	})
 
-func (a *App) Start(ctx context.Context) error {
-	server := &http.Server{
-		Addr:        fmt.Sprintf(":%d", a.config.ServerPort),
-		Handler:     a.router,
-		IdleTimeout: 30 * time.Second,
+	app.server = &server.Server{
+		Config: cfg.Config,
+		Health: app.health,
+		Logger: logger,
+	}
+	app.transport, err = app.server.Transport()
+	if err != nil {
+		logger.Error("failed to load certificates", "err", err)
+		return nil, err
 	}
 
-	fmt.Println("Starting server")
-
-	ch := make(chan error, 1)
-
-	go func() {
-		err := server.ListenAndServe()
-		if err != nil {
-			ch <- fmt.Errorf("failed to start server: %w", err)
-		}
-		close(ch)
-	}()
+	app.spreadsheets, err = loadSpreadsheets(cfg.SubscriptionsFile, logger)
+	if err != nil {
+		logger.Error("failed to load spreadsheets with subscriptions", "err", err)
+		return nil, err
+	}
 
-	select {
-	case err := <-ch:
-		return err
+	app.loadRoutes()
+	app.server.Go("post subscriptions", func(ctx context.Context) error {
+		return app.postSubscriptions(ctx, app.transactionRepo())
+	})
+	app.server.Handler = server.Chain(app.router,
+		logging.Middleware(logger),
+		metrics.Middleware(app.metrics),
+		tracing.Middleware(metrics.Route),
+	)
 
-	case <-ctx.Done():
-		timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+	app.server.OnShutdown("tracing", shutdownTracing)
 
-		return server.Shutdown(timeout)
-	}
+	return app, nil
+}
 
-	return nil
+// Start serves requests until ctx is done, once Google Sheets can be
+// reached.
+func (a *App) Start(ctx context.Context) error {
+	return a.server.Run(ctx)
 }
@@ -1,48 +1,158 @@
 package application
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/config"
+	"github.com/NathanRJohnson/live-backend/platform/server"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
 )
 
 type Config struct {
-	ServerPort  uint16
-	SecretsPath string
+	// the port, timeouts, log level and trace exporter
+	server.Config
+	SecretsPath string `config:"secrets_path" usage:"path of the Google Sheets service account key"`
 	ServiceKey  []byte
+	SessionKey  string `config:"session_key" secret:"true" required:"true" usage:"key session tokens are signed with, shared with wtfridge"`
+	// access tokens are checked against the fridge service
+	FridgeURL         string        `config:"fridge_api_url" usage:"base URL of the fridge service"`
+	IntrospectTimeout time.Duration `config:"introspect_timeout" usage:"how long to wait on the fridge service to check a token"`
+	// where transactions are kept in each spreadsheet
+	SheetName         string `config:"sheet_name" usage:"tab holding transactions"`
+	SheetFirstRow     int    `config:"sheet_first_row" usage:"first row holding a transaction"`
+	CycleSheet        string `config:"cycle_sheet" usage:"tab holding the budget cycle schedule and closed cycles"`
+	RateSheet         string `config:"rate_sheet" usage:"tab holding the exchange rates a user entered"`
+	BudgetSheet       string `config:"budget_sheet" usage:"tab holding the budget of each category"`
+	MappingSheet      string `config:"mapping_sheet" usage:"tab holding how each bank lays out its CSV statements"`
+	SubscriptionSheet string `config:"subscription_sheet" usage:"tab holding recurring transactions"`
+	RuleSheet         string `config:"rule_sheet" usage:"tab holding the rules categorizing transactions"`
+	Currency          string `config:"default_currency" usage:"currency of users who have not chosen one"`
+	// exchange rates every user can convert with, optional
+	RatesFile string `config:"rates_file" usage:"CSV file of exchange rates: date, from, to, rate"`
+	Rates     model.Rates
+	// how often the charges of subscriptions are posted, and where the
+	// spreadsheets with subscriptions are remembered, optional
+	SubscriptionInterval time.Duration `config:"subscription_interval" usage:"how often due subscription charges are posted"`
+	SubscriptionsFile    string        `config:"subscriptions_file" usage:"file remembering the spreadsheets with subscriptions across restarts"`
+	// spreadsheet read by the readiness check, optional
+	HealthSheetRef string `config:"health_sheet_ref" usage:"spreadsheet read by the readiness check"`
 }
 
-func LoadConfig() Config {
+// LoadConfig loads the configuration from defaults, the config file,
+// environment variables and args, then reads the service account key it
+// names.
+func LoadConfig(args []string) (Config, error) {
 	currentDir, err := filepath.Abs(filepath.Dir("."))
 	if err != nil {
-		fmt.Println("Error getting current directory", err)
+		return Config{}, fmt.Errorf("unable to get current directory: %w", err)
 	}
 
 	// local config init
 	cfg := Config{
-		ServerPort:  3000,
-		SecretsPath: filepath.Join(currentDir, "../secrets/gsheets-serviceKey.json"),
+		Config:               server.DefaultConfig,
+		SecretsPath:          filepath.Join(currentDir, "../secrets/gsheets-serviceKey.json"),
+		FridgeURL:            "http://localhost:3000",
+		IntrospectTimeout:    5 * time.Second,
+		SheetName:            "Sheet1",
+		SheetFirstRow:        3,
+		CycleSheet:           "Cycles",
+		RateSheet:            "Rates",
+		BudgetSheet:          "Budgets",
+		MappingSheet:         "Mappings",
+		SubscriptionSheet:    "Subscriptions",
+		Currency:             "USD",
+		SubscriptionInterval: time.Hour,
 	}
 
-	// load variables from docker environment
-	if serverPort, exists := os.LookupEnv("SERVER_PORT"); exists {
-		if port, err := strconv.ParseUint(serverPort, 10, 16); err == nil {
-			cfg.ServerPort = uint16(port)
-		}
+	loader := config.Loader{Name: "wtfinance", Args: args}
+	err = loader.Load(&cfg)
+	if errors.Is(err, config.ErrPrinted) {
+		return cfg, err
+	}
+
+	// a missing key file is reported along with any invalid values
+	secrets, secretsErr := os.ReadFile(cfg.SecretsPath)
+	if secretsErr != nil {
+		secretsErr = fmt.Errorf("unable to read secrets: %w", secretsErr)
+	}
+	var ratesErr error
+	if cfg.RatesFile != "" {
+		cfg.Rates, ratesErr = readRates(cfg.RatesFile)
+	}
+	if err != nil || secretsErr != nil || ratesErr != nil {
+		return cfg, errors.Join(err, secretsErr, ratesErr)
 	}
+	cfg.ServiceKey = secrets
+
+	return cfg, nil
+}
 
-	if _, exists := os.LookupEnv("SECRETS_PATH"); exists {
-		cfg.SecretsPath = "/run/secrets/googleSheets"
+func readRates(path string) (model.Rates, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rates: %w", err)
 	}
+	defer f.Close()
 
-	secrets, err := os.ReadFile(cfg.SecretsPath)
+	rates, err := model.ReadRates(f)
 	if err != nil {
-		log.Fatalf("Unable to read secrets: %v", err)
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
+	return rates, nil
+}
 
-	cfg.ServiceKey = secrets
+// Validate checks the values that parse but make no sense.
+func (c *Config) Validate() error {
+	errs := []error{c.Config.Validate()}
+
+	if c.SecretsPath == "" {
+		errs = append(errs, errors.New("secrets_path is required"))
+	}
+	if u, err := url.Parse(c.FridgeURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("fridge_api_url %q is not an absolute URL", c.FridgeURL))
+	}
+	if c.SheetName == "" {
+		errs = append(errs, errors.New("sheet_name is required"))
+	}
+	if c.SheetFirstRow < 1 {
+		errs = append(errs, errors.New("sheet_first_row must be at least 1"))
+	}
+	tabs := map[string]string{"sheet_name": c.SheetName}
+	for _, s := range []struct{ key, name string }{
+		{"cycle_sheet", c.CycleSheet},
+		{"rate_sheet", c.RateSheet},
+		{"budget_sheet", c.BudgetSheet},
+		{"mapping_sheet", c.MappingSheet},
+		{"subscription_sheet", c.SubscriptionSheet},
+		{"rule_sheet", c.RuleSheet},
+	} {
+		if s.name == "" {
+			errs = append(errs, fmt.Errorf("%s is required", s.key))
+		} else if other, ok := tabs[s.name]; ok {
+			errs = append(errs, fmt.Errorf("%s must differ from %s", s.key, other))
+		}
+		tabs[s.name] = s.key
+	}
+	if !model.ValidCurrency(c.Currency) {
+		errs = append(errs, fmt.Errorf("default_currency %q is not an ISO 4217 code", c.Currency))
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"introspect_timeout", c.IntrospectTimeout},
+		{"subscription_interval", c.SubscriptionInterval},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.key))
+		}
+	}
 
-	return cfg
+	return errors.Join(errs...)
 }
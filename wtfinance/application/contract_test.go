@@ -0,0 +1,292 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/health"
+	"github.com/NathanRJohnson/live-backend/wtfinance/docs"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/golang-jwt/jwt/v4"
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	contractSessionKey = "contract-session"
+	contractSheet      = "contract-sheet"
+)
+
+// fakeSheets answers the few Sheets API calls the repository makes, for one
+// spreadsheet holding a single transaction, with ID t1, and the circle
+// values.
+func fakeSheets(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.HasPrefix(r.URL.Path, "/v4/spreadsheets/"+contractSheet) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":404,"message":"Requested entity was not found.","status":"NOT_FOUND"}}`))
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPut, r.Method == http.MethodPost:
+			w.Write([]byte(`{}`))
+		case r.URL.Path == "/v4/spreadsheets/"+contractSheet:
+			w.Write([]byte(`{"properties":{"timeZone":"America/Toronto"},"sheets":[{"properties":{"sheetId":0,"title":"Sheet1"}}]}`))
+		case strings.HasSuffix(r.URL.Path, "!E3:E"):
+			w.Write([]byte(`{"values":[["t1"]]}`))
+		case strings.Contains(r.URL.Path, "!A3:N"):
+			w.Write([]byte(`{"values":[["5/1","Rent","Home","$900.00","t1"]]}`))
+		case strings.HasSuffix(r.URL.Path, "Subscriptions!A2:K"):
+			w.Write([]byte(`{"values":[["t1","Rent","Home",900,"USD","expense","monthly","1","2024-01-01","active","2024-05-01"]]}`))
+		case strings.HasSuffix(r.URL.Path, "Budgets!A2:D"):
+			w.Write([]byte(`{"values":[["Home","",1000,"USD"]]}`))
+		default:
+			w.Write([]byte(`{"values":[]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// fakeFridge answers introspection as fridge does for the session tokens of
+// sessionToken, whose account is active.
+func fakeFridge(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"active":true,"username":"contract"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newContractApp(t *testing.T) *App {
+	srv := fakeSheets(t)
+	service, err := sheets.NewService(context.Background(),
+		option.WithEndpoint(srv.URL),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{
+		gss: service,
+		config: Config{
+			SessionKey: contractSessionKey,
+			FridgeURL:  fakeFridge(t).URL,
+		},
+		metrics: metrics.NewPrometheus("wtfinance"),
+		health:  &health.Registry{},
+	}
+	app.loadRoutes()
+	return app
+}
+
+// sessionToken signs in a user whose account is linked to sheet.
+func sessionToken(t *testing.T, sheet string) string {
+	claims := jwt.MapClaims{
+		"username":  "contract",
+		"sheet_ref": sheet,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(contractSessionKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// call serves a request for op through the app's router, and checks what it
+// answers is documented.
+func call(t *testing.T, app *App, op docs.Operation, header http.Header, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	path := strings.NewReplacer("{id}", "t1", "{cycle}", "current", "{category}", "Home", "{bank}", "Scotiabank").Replace(op.Path)
+	r := httptest.NewRequest(op.Method, path, bytes.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, r)
+
+	if rec.Code == http.StatusNotFound && rec.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("%s is not routed", op)
+	}
+	if rec.Code == http.StatusMethodNotAllowed {
+		t.Fatalf("%s is not routed", op)
+	}
+	if err := op.CheckResponse(rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+		t.Error(err)
+	}
+	return rec
+}
+
+func TestDocumentedOperationsAreServed(t *testing.T) {
+	contract, err := docs.LoadContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newContractApp(t)
+	signedIn := "Bearer " + sessionToken(t, contractSheet)
+	linkedToMissing := "Bearer " + sessionToken(t, "missing")
+	unlinked := "Bearer " + sessionToken(t, "")
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"without credentials", http.Header{"Sheetref": {contractSheet}}, http.StatusUnauthorized},
+		{"without SheetRef", http.Header{"Authorization": {signedIn}}, http.StatusBadRequest},
+		{"another spreadsheet", http.Header{"Authorization": {signedIn}, "Sheetref": {"missing"}}, http.StatusForbidden},
+		{"no linked spreadsheet", http.Header{"Authorization": {unlinked}, "Sheetref": {contractSheet}}, http.StatusForbidden},
+		{"unknown spreadsheet", http.Header{"Authorization": {linkedToMissing}, "Sheetref": {"missing"}}, http.StatusNotFound},
+		{"signed in", http.Header{"Authorization": {signedIn}, "Sheetref": {contractSheet}}, http.StatusOK},
+	}
+
+	// what a successful call answers, when it is not 200
+	success := map[string]int{
+		"deleteTransaction": http.StatusNoContent,
+		"deleteBudget":      http.StatusNoContent,
+		"checkAccess":       http.StatusNoContent,
+	}
+
+	for _, op := range contract.Operations() {
+		var body []byte
+		if op.HasBody() {
+			body, err = op.Example()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(op.ID+"/"+tt.name, func(t *testing.T) {
+				want := tt.want
+				if want == http.StatusOK && success[op.ID] != 0 {
+					want = success[op.ID]
+				}
+				rec := call(t, app, op, tt.header, body)
+				if rec.Code != want {
+					t.Errorf("got %d, want %d: %s", rec.Code, want, rec.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestUnknownTransactionIsNotFound(t *testing.T) {
+	app := newContractApp(t)
+	header := http.Header{
+		"Authorization": {"Bearer " + sessionToken(t, contractSheet)},
+		"Sheetref":      {contractSheet},
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		r := httptest.NewRequest(method, "/finance/missing", nil)
+		r.Header = header
+		rec := httptest.NewRecorder()
+		app.router.ServeHTTP(rec, r)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s /finance/missing = %d, want 404", method, rec.Code)
+		}
+	}
+}
+
+func TestDatesFollowTheUserTimeZone(t *testing.T) {
+	app := newContractApp(t)
+	header := http.Header{
+		"Authorization": {"Bearer " + sessionToken(t, contractSheet)},
+		"Sheetref":      {contractSheet},
+	}
+
+	// the fake spreadsheet is in America/Toronto, where this is still May 1
+	body := `{"date":"2024-05-02T02:00:00Z","name":"Rent","amount":900,"category":"Home"}`
+	r := httptest.NewRequest(http.MethodPost, "/finance/", strings.NewReader(body))
+	r.Header = header
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, r)
+
+	var created struct{ Date string }
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if rec.Code != http.StatusOK || created.Date != "2024-05-01T00:00:00-04:00" {
+		t.Errorf("got %d with date %q, want 200 with 2024-05-01T00:00:00-04:00", rec.Code, created.Date)
+	}
+}
+
+func TestRequestBodiesMatchSpec(t *testing.T) {
+	contract, err := docs.LoadContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newContractApp(t)
+	header := http.Header{
+		"Authorization": {"Bearer " + sessionToken(t, contractSheet)},
+		"Sheetref":      {contractSheet},
+	}
+
+	for _, op := range contract.Operations() {
+		if !op.HasBody() {
+			continue
+		}
+		example, err := op.Example()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Run(op.ID+"/required", func(t *testing.T) {
+			rec := call(t, app, op, header, []byte(`{}`))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("an empty body got %d, want 400", rec.Code)
+			}
+
+			var problem struct {
+				Errors []struct{ Field, Message string }
+			}
+			json.Unmarshal(rec.Body.Bytes(), &problem)
+
+			var required []string
+			for _, f := range problem.Errors {
+				if f.Message == "is required" {
+					required = append(required, f.Field)
+				}
+			}
+			sort.Strings(required)
+			if !reflect.DeepEqual(required, op.Required()) {
+				t.Errorf("handler requires %v, the document %v", required, op.Required())
+			}
+		})
+
+		t.Run(op.ID+"/undocumented", func(t *testing.T) {
+			var body map[string]interface{}
+			json.Unmarshal(example, &body)
+			body["undocumented"] = true
+			data, _ := json.Marshal(body)
+
+			if rec := call(t, app, op, header, data); rec.Code != http.StatusBadRequest {
+				t.Errorf("got %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestDocsAreServed(t *testing.T) {
+	app := newContractApp(t)
+
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/openapi.yaml", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), docs.Spec) {
+		t.Errorf("GET /docs/openapi.yaml = %d, want the document", rec.Code)
+	}
+}
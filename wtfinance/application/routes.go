@@ -3,7 +3,10 @@ package application
 import (
 	"net/http"
 
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/docs"
 	"github.com/NathanRJohnson/live-backend/wtfinance/handler"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
 	"github.com/NathanRJohnson/live-backend/wtfinance/repository/transaction"
 )
 
@@ -13,18 +16,91 @@ func (a *App) loadRoutes() {
 	transactionRouter := http.NewServeMux()
 	a.loadTransactionRoutes(transactionRouter)
 
-	router.Handle("/finance/", http.StripPrefix("/finance", transactionRouter))
-	a.router = router
+	router.Handle("/finance/", http.StripPrefix("/finance", metrics.Routes("/finance", transactionRouter)))
+
+	router.HandleFunc("GET /healthz", a.health.Live)
+	router.HandleFunc("GET /readyz", a.health.Ready)
+	router.Handle("GET /metrics", a.metrics.Handler())
+	router.Handle("GET /docs/", docs.Handler("wtfinance"))
+	a.router = metrics.Routes("", router)
+}
+
+// transactionRepo is the repository of the spreadsheets of users, laid out
+// as configured.
+func (a *App) transactionRepo() *transaction.GoogleSheetsRepo {
+	return &transaction.GoogleSheetsRepo{
+		Service: a.gss,
+		Metrics: a.metrics,
+		Layout: transaction.SheetLayout{
+			Sheet:             a.config.SheetName,
+			FirstRow:          a.config.SheetFirstRow,
+			CycleSheet:        a.config.CycleSheet,
+			RateSheet:         a.config.RateSheet,
+			BudgetSheet:       a.config.BudgetSheet,
+			MappingSheet:      a.config.MappingSheet,
+			SubscriptionSheet: a.config.SubscriptionSheet,
+			RuleSheet:         a.config.RuleSheet,
+		},
+		Currency:    a.config.Currency,
+		ServerRates: a.config.Rates,
+	}
 }
 
 func (a *App) loadTransactionRoutes(router *http.ServeMux) {
-	transactionHandler := &handler.Transaction{
-		Repo: &transaction.GoogleSheetsRepo{
-			Service: a.gss,
+	transactionHandler := &handler.Transaction{Repo: a.transactionRepo()}
+	if a.spreadsheets != nil {
+		transactionHandler.Subscribed = a.spreadsheets.add
+	}
+	auth := &handler.Auth{
+		SessionKey:    []byte(a.config.SessionKey),
+		IntrospectURL: a.config.FridgeURL + "/user/tokens/introspect",
+		Client: &http.Client{
+			Timeout:   a.config.IntrospectTimeout,
+			Transport: tracing.Transport(a.transport),
 		},
 	}
-	router.HandleFunc("POST /", transactionHandler.Create)
-	router.HandleFunc("GET /", transactionHandler.History)
-	router.HandleFunc("GET /circle", transactionHandler.CircleValues)
+	router.HandleFunc("POST /{$}", auth.Require(handler.ScopeFinanceWrite, transactionHandler.Create))
+	router.HandleFunc("GET /{$}", auth.Require(handler.ScopeFinanceRead, transactionHandler.History))
+	router.HandleFunc("GET /circle", auth.Require(handler.ScopeFinanceRead, transactionHandler.CircleValues))
+	router.HandleFunc("GET /access", auth.Require(handler.ScopeFinanceRead, transactionHandler.Access))
+	router.HandleFunc("GET /{id}", auth.Require(handler.ScopeFinanceRead, transactionHandler.Get))
+	router.HandleFunc("PUT /{id}", auth.Require(handler.ScopeFinanceWrite, transactionHandler.Update))
+	router.HandleFunc("DELETE /{id}", auth.Require(handler.ScopeFinanceWrite, transactionHandler.Delete))
+
+	router.HandleFunc("GET /preferences", auth.Require(handler.ScopeFinanceRead, transactionHandler.Preferences))
+	router.HandleFunc("PUT /preferences", auth.Require(handler.ScopeFinanceWrite, transactionHandler.SetPreferences))
+
+	router.HandleFunc("GET /rates", auth.Require(handler.ScopeFinanceRead, transactionHandler.Rates))
+	router.HandleFunc("POST /rates", auth.Require(handler.ScopeFinanceWrite, transactionHandler.AddRate))
+
+	router.HandleFunc("GET /budgets", auth.Require(handler.ScopeFinanceRead, transactionHandler.Budgets))
+	router.HandleFunc("PUT /budgets/{category}", auth.Require(handler.ScopeFinanceWrite, transactionHandler.SetBudget))
+	router.HandleFunc("DELETE /budgets/{category}", auth.Require(handler.ScopeFinanceWrite, transactionHandler.DeleteBudget))
+
+	router.HandleFunc("POST /import", auth.Require(handler.ScopeFinanceWrite, transactionHandler.PreviewImport))
+	router.HandleFunc("POST /import/confirm", auth.Require(handler.ScopeFinanceWrite, transactionHandler.Import))
+	router.HandleFunc("GET /import/mappings", auth.Require(handler.ScopeFinanceRead, transactionHandler.Mappings))
+	router.HandleFunc("PUT /import/mappings/{bank}", auth.Require(handler.ScopeFinanceWrite, transactionHandler.SetMapping))
+
+	router.HandleFunc("GET /subscriptions", auth.Require(handler.ScopeFinanceRead, transactionHandler.Subscriptions))
+	router.HandleFunc("POST /subscriptions", auth.Require(handler.ScopeFinanceWrite, transactionHandler.AddSubscription))
+	router.HandleFunc("GET /subscriptions/upcoming", auth.Require(handler.ScopeFinanceRead, transactionHandler.UpcomingCharges))
+	router.HandleFunc("POST /subscriptions/{id}/pause", auth.Require(handler.ScopeFinanceWrite, transactionHandler.PauseSubscription))
+	router.HandleFunc("POST /subscriptions/{id}/resume", auth.Require(handler.ScopeFinanceWrite, transactionHandler.ResumeSubscription))
+	router.HandleFunc("POST /subscriptions/{id}/cancel", auth.Require(handler.ScopeFinanceWrite, transactionHandler.CancelSubscription))
+
+	router.HandleFunc("GET /rules", auth.Require(handler.ScopeFinanceRead, transactionHandler.Rules))
+	router.HandleFunc("PUT /rules", auth.Require(handler.ScopeFinanceWrite, transactionHandler.SetRules))
+	router.HandleFunc("POST /rules/run", auth.Require(handler.ScopeFinanceWrite, transactionHandler.RunRules))
+
+	router.HandleFunc("GET /schedule", auth.Require(handler.ScopeFinanceRead, transactionHandler.Schedule))
+	router.HandleFunc("PUT /schedule", auth.Require(handler.ScopeFinanceWrite, transactionHandler.SetSchedule))
+	router.HandleFunc("GET /cycles", auth.Require(handler.ScopeFinanceRead, transactionHandler.Cycles))
+	router.HandleFunc("GET /cycles/{cycle}", auth.Require(handler.ScopeFinanceRead, transactionHandler.Cycle))
+	router.HandleFunc("GET /cycles/{cycle}/transactions", auth.Require(handler.ScopeFinanceRead, transactionHandler.CycleHistory))
+	router.HandleFunc("GET /cycles/{cycle}/totals", auth.Require(handler.ScopeFinanceRead, transactionHandler.CycleTotals))
+	router.HandleFunc("GET /cycles/{cycle}/budgets", auth.Require(handler.ScopeFinanceRead, transactionHandler.CycleProgress))
+	router.HandleFunc("GET /cycles/{cycle}/circle", auth.Require(handler.ScopeFinanceRead, transactionHandler.CycleCircleValues))
+	router.HandleFunc("POST /cycles/current/close", auth.Require(handler.ScopeFinanceWrite, transactionHandler.CloseCycle))
 
 }
@@ -0,0 +1,143 @@
+package application
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/repository/transaction"
+)
+
+// spreadsheets remembers the spreadsheets with subscriptions, which the
+// service otherwise only learns of from requests. With a file they are
+// remembered across restarts; without one, a spreadsheet is posted for
+// again once a request for its subscriptions succeeds, catching up on the
+// charges missed meanwhile.
+type spreadsheets struct {
+	mu     sync.Mutex
+	path   string
+	refs   map[string]bool
+	logger *slog.Logger
+}
+
+// loadSpreadsheets reads the file at path, one spreadsheet to a line. A
+// missing file has none, and an empty path keeps them in memory.
+func loadSpreadsheets(path string, logger *slog.Logger) (*spreadsheets, error) {
+	s := &spreadsheets{path: path, refs: map[string]bool{}, logger: logger}
+	if path == "" {
+		return s, nil
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read subscriptions file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if ref := strings.TrimSpace(scanner.Text()); ref != "" {
+			s.refs[ref] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// add remembers sheetRef. Failing to save it is only logged: it is still
+// posted for until the service restarts.
+func (s *spreadsheets) add(sheetRef string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refs[sheetRef] {
+		return
+	}
+	s.refs[sheetRef] = true
+	if err := s.save(); err != nil {
+		s.logger.Error("unable to save spreadsheets with subscriptions", "err", err)
+	}
+}
+
+// remove forgets sheetRef, once it cannot be reached.
+func (s *spreadsheets) remove(sheetRef string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.refs, sheetRef)
+	if err := s.save(); err != nil {
+		s.logger.Error("unable to save spreadsheets with subscriptions", "err", err)
+	}
+}
+
+// save rewrites the file, s.mu must be held.
+func (s *spreadsheets) save() error {
+	if s.path == "" {
+		return nil
+	}
+	var b strings.Builder
+	for _, ref := range s.list() {
+		b.WriteString(ref + "\n")
+	}
+
+	// written beside the file then renamed, so a crash never leaves half
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// list returns the spreadsheets, sorted; s.mu must be held.
+func (s *spreadsheets) list() []string {
+	refs := make([]string, 0, len(s.refs))
+	for ref := range s.refs {
+		refs = append(refs, ref)
+	}
+	slices.Sort(refs)
+	return refs
+}
+
+func (s *spreadsheets) all() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// postSubscriptions posts the charges due in every spreadsheet with
+// subscriptions, every subscription_interval until ctx is done.
+func (a *App) postSubscriptions(ctx context.Context, repo *transaction.GoogleSheetsRepo) error {
+	ticker := time.NewTicker(a.config.SubscriptionInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, sheetRef := range a.spreadsheets.all() {
+			posted, err := repo.PostSubscriptions(ctx, sheetRef)
+			switch {
+			case errors.Is(err, transaction.ErrNotFound):
+				a.logger.Warn("forgetting spreadsheet with subscriptions, it cannot be reached", "sheet", sheetRef)
+				a.spreadsheets.remove(sheetRef)
+			case err != nil:
+				a.logger.Error("failed to post subscriptions", "sheet", sheetRef, "err", err)
+			case len(posted) > 0:
+				a.logger.Info("posted subscriptions", "sheet", sheetRef, "count", len(posted))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	ScopeFinanceRead  = "finance:read"
+	ScopeFinanceWrite = "finance:write"
+)
+
+// personal access tokens are issued by the fridge service and carry a fixed
+// prefix so they can be told apart from session JWTs
+const accessTokenPrefix = "wtf_pat_"
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Username string
+	Scopes   []string
+	// the spreadsheet linked to the account, the only one the caller may use
+	SheetRef string
+	// session tokens are not scoped
+	IsSession bool
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.IsSession {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func principalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Auth accepts session JWTs signed with SessionKey, and personal access
+// tokens. Both are checked against the fridge service's introspection
+// endpoint, so a session token stops working as soon as its account is
+// deleted, disabled or has its credentials reset, as it would in fridge.
+type Auth struct {
+	SessionKey    []byte
+	IntrospectURL string
+	Client        *http.Client
+}
+
+// Require only lets the request through if it carries a valid session token,
+// or a personal access token that has been granted scope.
+func (a *Auth) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r)
+		if err != nil {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "token is missing required scope "+scope)
+			return
+		}
+
+		logging.SetUser(r.Context(), principal.Username)
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+func (a *Auth) authenticate(r *http.Request) (*Principal, error) {
+	token, err := getTokenFromHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(token, accessTokenPrefix) {
+		principal, err := a.introspect(r.Context(), token)
+		if errors.Is(err, errInactive) {
+			return nil, errors.New("invalid or expired access token")
+		}
+		return principal, err
+	}
+
+	// the signature is checked first, so forged tokens are turned away
+	// without asking fridge
+	principal, err := a.validateSessionToken(token)
+	if err != nil {
+		return nil, errors.New("invalid or expired session token")
+	}
+	active, err := a.introspect(r.Context(), token)
+	if errors.Is(err, errInactive) || (err == nil && active.Username != principal.Username) {
+		return nil, errors.New("session token has been revoked")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return principal, nil
+}
+
+func (a *Auth) validateSessionToken(tokenString string) (*Principal, error) {
+	var claims struct {
+		Username string `json:"username"`
+		SheetRef string `json:"sheet_ref"`
+		jwt.RegisteredClaims
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return a.SessionKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.Username == "" {
+		return nil, errors.New("invalid token")
+	}
+	return &Principal{Username: claims.Username, SheetRef: claims.SheetRef, IsSession: true}, nil
+}
+
+// errInactive is returned by introspect for a token fridge does not accept.
+var errInactive = errors.New("inactive token")
+
+// introspect asks fridge whether token is active, and returns who it
+// belongs to, the scopes it was granted and the spreadsheet it may use.
+func (a *Auth) introspect(ctx context.Context, token string) (*Principal, error) {
+	body, err := json.Marshal(map[string]string{"token": token})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.IntrospectURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(logging.RequestIDHeader, logging.RequestID(ctx))
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		logging.Logger(ctx).Error("failed to introspect token", "err", err)
+		return nil, errors.New("unable to verify token")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		logging.Logger(ctx).Error("failed to introspect token", "status", res.Status)
+		return nil, errors.New("unable to verify token")
+	}
+
+	var result struct {
+		Active   bool     `json:"active"`
+		Username string   `json:"username"`
+		Scopes   []string `json:"scopes"`
+		SheetRef string   `json:"sheet_ref"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if !result.Active {
+		return nil, errInactive
+	}
+
+	return &Principal{Username: result.Username, Scopes: result.Scopes, SheetRef: result.SheetRef}, nil
+}
+
+func getTokenFromHeader(header string) (string, error) {
+	if header == "" {
+		return "", errors.New("auth header not found")
+	}
+
+	splits := strings.Split(header, " ")
+	if len(splits) != 2 || splits[0] != "Bearer" {
+		return "", errors.New("invalid auth header")
+	}
+	return splits[1], nil
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestSessionTokensAreCheckedWithFridge(t *testing.T) {
+	key := []byte("session")
+	sign := func(key []byte, username string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"username":  username,
+			"sheet_ref": "sheet-1",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+		}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	// fridge knows nathan, and has revoked everything of sam
+	asked := 0
+	fridge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked++
+		var body struct{ Token string }
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Token == sign(key, "nathan") {
+			w.Write([]byte(`{"active":true,"username":"nathan","sheet_ref":"sheet-1"}`))
+			return
+		}
+		w.Write([]byte(`{"active":false}`))
+	}))
+	defer fridge.Close()
+
+	tests := []struct {
+		name   string
+		token  string
+		url    string
+		want   int
+		asking int
+	}{
+		{"active account", sign(key, "nathan"), fridge.URL, http.StatusOK, 1},
+		{"revoked account", sign(key, "sam"), fridge.URL, http.StatusUnauthorized, 1},
+		{"signed with another key", sign([]byte("other"), "nathan"), fridge.URL, http.StatusUnauthorized, 0},
+		{"fridge unreachable", sign(key, "nathan"), "http://127.0.0.1:1", http.StatusUnauthorized, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked = 0
+			auth := &Auth{SessionKey: key, IntrospectURL: tt.url}
+			var got *Principal
+			h := auth.Require(ScopeFinanceRead, func(w http.ResponseWriter, r *http.Request) {
+				got, _ = principalFromContext(r.Context())
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h(rec, r)
+
+			if rec.Code != tt.want {
+				t.Errorf("got %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if asked != tt.asking {
+				t.Errorf("asked fridge %d times, want %d", asked, tt.asking)
+			}
+			if tt.want == http.StatusOK && (got == nil || got.Username != "nathan" || got.SheetRef != "sheet-1" || !got.IsSession) {
+				t.Errorf("got principal %+v, want nathan's session for sheet-1", got)
+			}
+		})
+	}
+}
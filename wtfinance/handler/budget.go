@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func (t *Transaction) Budgets(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	budgets, err := t.Repo.Budgets(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, budgets)
+}
+
+// SetBudget sets the budget of the category in the path, for every cycle
+// or, given one, for that cycle alone.
+func (t *Transaction) SetBudget(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Set budget")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Amount   model.Money `json:"amount" validate:"required"`
+		Currency *string     `json:"currency"`
+		Cycle    string      `json:"cycle"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	budget := model.Budget{Category: r.PathValue("category"), Cycle: body.Cycle, Amount: body.Amount}
+	var errs validate.Errors
+	if len(budget.Category) > 50 {
+		errs = append(errs, validate.FieldError{Field: "category", Message: "must have at most 50 characters"})
+	}
+	if budget.Amount.Minor <= 0 {
+		errs = append(errs, validate.FieldError{Field: "amount", Message: "must be more than 0"})
+	}
+	if _, err := time.Parse(time.DateOnly, body.Cycle); body.Cycle != "" && err != nil {
+		errs = append(errs, validate.FieldError{Field: "cycle", Message: "must be the day a cycle starts, like 2024-05-01"})
+	}
+	if body.Currency != nil {
+		var currencyErrs validate.Errors
+		budget.Amount, currencyErrs = inCurrency(budget.Amount, *body.Currency)
+		errs = append(errs, currencyErrs...)
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	budget, err := t.Repo.SetBudget(r.Context(), sheetref, budget)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, budget)
+}
+
+// DeleteBudget removes the budget of the category in the path for every
+// cycle, or for the cycle in the query.
+func (t *Transaction) DeleteBudget(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Delete budget")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	err := t.Repo.DeleteBudget(r.Context(), sheetref, r.PathValue("category"), r.URL.Query().Get("cycle"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *Transaction) CycleProgress(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	progress, err := t.Repo.CycleProgress(r.Context(), sheetref, r.PathValue("cycle"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, progress)
+}
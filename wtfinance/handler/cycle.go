@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func (t *Transaction) Schedule(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := t.Repo.Schedule(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, schedule)
+}
+
+// SetSchedule changes when budget cycles start. Monthly schedules need a
+// day, biweekly ones an anchor and custom ones their dates.
+func (t *Transaction) SetSchedule(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Set budget cycle schedule")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Kind   string      `json:"kind" validate:"required,oneof=monthly biweekly custom"`
+		Day    *int        `json:"day" validate:"min=1,max=31"`
+		Anchor *time.Time  `json:"anchor"`
+		Dates  []time.Time `json:"dates" validate:"max=366"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	schedule := model.Schedule{Kind: body.Kind, Anchor: body.Anchor}
+	var errs validate.Errors
+	switch body.Kind {
+	case model.Monthly:
+		if body.Day == nil {
+			errs = append(errs, validate.FieldError{Field: "day", Message: "is required for a monthly schedule"})
+		} else {
+			schedule.Day = *body.Day
+		}
+		schedule.Anchor = nil
+	case model.Biweekly:
+		if body.Anchor == nil {
+			errs = append(errs, validate.FieldError{Field: "anchor", Message: "is required for a biweekly schedule"})
+		}
+	case model.Custom:
+		if len(body.Dates) == 0 {
+			errs = append(errs, validate.FieldError{Field: "dates", Message: "is required for a custom schedule"})
+		}
+		schedule.Dates = body.Dates
+		schedule.Anchor = nil
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	err := t.Repo.SetSchedule(r.Context(), sheetref, schedule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, schedule)
+}
+
+func (t *Transaction) Cycles(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	cycles, err := t.Repo.Cycles(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, cycles)
+}
+
+func (t *Transaction) Cycle(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	cycle, err := t.Repo.Cycle(r.Context(), sheetref, r.PathValue("cycle"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, cycle)
+}
+
+func (t *Transaction) CycleHistory(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	transactions, err := t.Repo.CycleTransactions(r.Context(), sheetref, r.PathValue("cycle"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, transactions)
+}
+
+func (t *Transaction) CycleTotals(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	totals, err := t.Repo.CycleTotals(r.Context(), sheetref, r.PathValue("cycle"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, totals)
+}
+
+func (t *Transaction) CycleCircleValues(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	circleValues, err := t.Repo.CycleCircleAmounts(r.Context(), sheetref, r.PathValue("cycle"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, circleValues)
+}
+
+// CloseCycle archives the current cycle and answers with it and the cycle
+// that follows.
+func (t *Transaction) CloseCycle(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Close budget cycle")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	closed, current, err := t.Repo.CloseCycle(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, struct {
+		Closed  model.Cycle `json:"closed"`
+		Current model.Cycle `json:"current"`
+	}{closed, current})
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"github.com/NathanRJohnson/live-backend/wtfinance/repository/transaction"
+	"github.com/NathanRJohnson/live-backend/wtfinance/statement"
+)
+
+// PreviewImport reads a bank statement and returns its transactions, each
+// marked new, a duplicate of one imported before, or a possible duplicate
+// of one entered by hand. Nothing is written until the user confirms the
+// lines they keep with Import.
+func (t *Transaction) PreviewImport(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Preview import")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Format  string `json:"format" validate:"required,oneof=csv ofx qfx qif"`
+		Content string `json:"content" validate:"required"`
+		// the saved mapping of a CSV statement
+		Bank     string  `json:"bank" validate:"max=50"`
+		Currency *string `json:"currency"`
+		// of lines the statement gives no category for, which are otherwise
+		// given one by the user's rules
+		Category string `json:"category" validate:"max=50"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	opts := statement.Options{}
+	if body.Currency != nil {
+		if !model.ValidCurrency(*body.Currency) {
+			problem.WriteInvalid(w, r, validate.Errors{{Field: "currency", Message: "must be an ISO 4217 code, like CAD"}})
+			return
+		}
+		opts.Currency = *body.Currency
+	}
+	if body.Format == statement.CSV {
+		if body.Bank == "" {
+			problem.WriteInvalid(w, r, validate.Errors{{Field: "bank", Message: "is required for a CSV statement"}})
+			return
+		}
+		mapping, err := t.Repo.Mapping(r.Context(), sheetref, body.Bank)
+		if errors.Is(err, transaction.ErrNotFound) {
+			problem.WriteInvalid(w, r, validate.Errors{{Field: "bank", Message: "has no saved mapping"}})
+			return
+		}
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		opts.Mapping = mapping
+	}
+	lines, err := statement.Parse(body.Format, body.Content, opts)
+	if err != nil {
+		problem.WriteInvalid(w, r, validate.Errors{{Field: "content", Message: err.Error()}})
+		return
+	}
+	ids := statement.ImportIDs(lines)
+	transactions := make([]model.Transaction, len(lines))
+	for i, line := range lines {
+		transactions[i] = line.Transaction(body.Category)
+		transactions[i].ImportID = ids[i]
+	}
+
+	preview, err := t.Repo.PreviewImport(r.Context(), sheetref, transactions)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, preview)
+}
+
+// importBody is a transaction of a confirmed import.
+type importBody struct {
+	transactionBody
+	ImportID string `json:"import_id" validate:"max=64"`
+}
+
+// Import records the transactions of a previewed statement the user kept,
+// edited as they wish. Those already imported are skipped.
+func (t *Transaction) Import(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Import transactions")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Transactions []importBody `json:"transactions" validate:"required,max=1000"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	var errs validate.Errors
+	transactions := make([]model.Transaction, len(body.Transactions))
+	for i, b := range body.Transactions {
+		var itemErrs validate.Errors
+		if err := validate.Struct(b); err != nil && !errors.As(err, &itemErrs) {
+			writeError(w, r, err)
+			return
+		}
+		var transactionErrs validate.Errors
+		transactions[i], transactionErrs = b.transaction()
+		transactions[i].ImportID = b.ImportID
+		for _, e := range append(itemErrs, transactionErrs...) {
+			e.Field = fmt.Sprintf("transactions[%d].%s", i, e.Field)
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	imported, skipped, err := t.Repo.Import(r.Context(), sheetref, transactions)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, struct {
+		Imported []model.Transaction `json:"imported"`
+		// the import IDs of transactions imported before
+		Skipped []string `json:"skipped"`
+	}{imported, skipped})
+}
+
+func (t *Transaction) Mappings(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	mappings, err := t.Repo.Mappings(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, mappings)
+}
+
+// dateFormat is a date format a mapping can give, made of YYYY or YY, MM or
+// M, DD or D, and separators.
+var dateFormat = regexp.MustCompile(`(?i)^(YYYY|YY|MM|M|DD|D|[-/. ])+$`)
+
+// SetMapping saves how the bank in the path lays out its CSV statements,
+// for previews of them to use.
+func (t *Transaction) SetMapping(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Set statement mapping")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Delimiter        string `json:"delimiter" validate:"max=1"`
+		Date             string `json:"date" validate:"required,max=100"`
+		DateFormat       string `json:"date_format" validate:"max=20"`
+		Name             string `json:"name" validate:"required,max=100"`
+		Amount           string `json:"amount" validate:"max=100"`
+		Debit            string `json:"debit" validate:"max=100"`
+		Credit           string `json:"credit" validate:"max=100"`
+		Category         string `json:"category" validate:"max=100"`
+		Currency         string `json:"currency" validate:"max=100"`
+		ExpensesPositive bool   `json:"expenses_positive"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	mapping := model.Mapping{
+		Bank:             r.PathValue("bank"),
+		Delimiter:        body.Delimiter,
+		Date:             body.Date,
+		DateFormat:       body.DateFormat,
+		Name:             body.Name,
+		Amount:           body.Amount,
+		Debit:            body.Debit,
+		Credit:           body.Credit,
+		Category:         body.Category,
+		Currency:         body.Currency,
+		ExpensesPositive: body.ExpensesPositive,
+	}
+	var errs validate.Errors
+	if len(mapping.Bank) > 50 {
+		errs = append(errs, validate.FieldError{Field: "bank", Message: "must have at most 50 characters"})
+	}
+	if mapping.DateFormat != "" && !dateFormat.MatchString(mapping.DateFormat) {
+		errs = append(errs, validate.FieldError{Field: "date_format", Message: "must be made of YYYY, MM and DD, like DD/MM/YYYY"})
+	}
+	if mapping.Amount == "" && mapping.Debit == "" && mapping.Credit == "" {
+		errs = append(errs, validate.FieldError{Field: "amount", Message: "or debit and credit is required"})
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	mapping, err := t.Repo.SetMapping(r.Context(), sheetref, mapping)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, mapping)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func (t *Transaction) Preferences(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	preferences, err := t.Repo.Preferences(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, preferences)
+}
+
+// SetPreferences changes the preferences in the body, leaving the others as
+// they are. A new currency applies to transactions entered without one.
+func (t *Transaction) SetPreferences(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Set preferences")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		TimeZone string `json:"timezone" validate:"max=64"`
+		Currency string `json:"currency"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+	var errs validate.Errors
+	if body.TimeZone == "" && body.Currency == "" {
+		errs = append(errs, validate.FieldError{Field: "timezone", Message: "or currency is required"})
+	}
+	// Local is the server's time zone, not a user's
+	if _, err := time.LoadLocation(body.TimeZone); body.TimeZone != "" && (err != nil || body.TimeZone == "Local") {
+		errs = append(errs, validate.FieldError{Field: "timezone", Message: "is not a known time zone"})
+	}
+	if body.Currency != "" && !model.ValidCurrency(body.Currency) {
+		errs = append(errs, validate.FieldError{Field: "currency", Message: "must be an ISO 4217 code, like CAD"})
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	preferences, err := t.Repo.SetPreferences(r.Context(), sheetref, model.Preferences{TimeZone: body.TimeZone, Currency: body.Currency})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, preferences)
+}
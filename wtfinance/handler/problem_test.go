@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/wtfinance/repository/transaction"
+)
+
+func TestWriteErrorMapsRepositoryErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"not found", fmt.Errorf("%w: no transaction t1", transaction.ErrNotFound), http.StatusNotFound, problem.CodeNotFound, "not found: no transaction t1"},
+		{"conflict", fmt.Errorf("the cycle is already closed: %w", transaction.ErrConflict), http.StatusConflict, problem.CodeConflict, "the cycle is already closed: conflict"},
+		{"invalid", fmt.Errorf("%w: bad date", transaction.ErrInvalid), http.StatusBadRequest, problem.CodeInvalid, "invalid: bad date"},
+		// the cause is logged, not shown
+		{"unavailable", fmt.Errorf("%w: dial tcp: timeout", transaction.ErrUnavailable), http.StatusServiceUnavailable, problem.CodeUnavailable, "the service is temporarily unavailable, try again shortly"},
+		{"anything else", errors.New("googleapi: Error 500"), http.StatusInternalServerError, problem.CodeInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, httptest.NewRequest(http.MethodGet, "/finance/transactions/t1", nil), tt.err)
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("got content type %q", ct)
+			}
+			var got problem.Problem
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			want := problem.Problem{
+				Type:     "about:blank",
+				Title:    http.StatusText(tt.status),
+				Status:   tt.status,
+				Detail:   tt.detail,
+				Instance: "/finance/transactions/t1",
+				Code:     tt.code,
+			}
+			if rec.Code != tt.status || got.Type != want.Type || got.Title != want.Title || got.Status != want.Status ||
+				got.Detail != want.Detail || got.Instance != want.Instance || got.Code != want.Code {
+				t.Errorf("got %d %+v, want %+v", rec.Code, got, want)
+			}
+		})
+	}
+}
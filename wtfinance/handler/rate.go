@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func (t *Transaction) Rates(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	rates, err := t.Repo.Rates(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, rates)
+}
+
+// AddRate records what a currency was worth in another from a day on.
+// Transactions from then are converted with it, until a later rate.
+func (t *Transaction) AddRate(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Add exchange rate")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Date *time.Time `json:"date" validate:"required"`
+		From string     `json:"from" validate:"required"`
+		To   string     `json:"to" validate:"required"`
+		Rate float64    `json:"rate" validate:"required,min=0"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	var errs validate.Errors
+	for _, c := range []struct{ field, code string }{{"from", body.From}, {"to", body.To}} {
+		if !model.ValidCurrency(c.code) {
+			errs = append(errs, validate.FieldError{Field: c.field, Message: "must be an ISO 4217 code, like CAD"})
+		}
+	}
+	if body.From == body.To {
+		errs = append(errs, validate.FieldError{Field: "to", Message: "must differ from from"})
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	rate, err := t.Repo.AddRate(r.Context(), sheetref, model.Rate{Date: *body.Date, From: body.From, To: body.To, Rate: body.Rate})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, rate)
+}
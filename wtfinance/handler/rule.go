@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func (t *Transaction) Rules(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := t.Repo.Rules(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, rules)
+}
+
+// ruleBody is a rule of SetRules. Its amounts are in the currency given,
+// or named in them, or else the user's.
+type ruleBody struct {
+	Contains string       `json:"contains" validate:"max=100"`
+	Pattern  string       `json:"pattern" validate:"max=200"`
+	Min      *model.Money `json:"min"`
+	Max      *model.Money `json:"max"`
+	Currency *string      `json:"currency"`
+	Category string       `json:"category" validate:"required,max=50"`
+	Rename   string       `json:"rename" validate:"max=100"`
+}
+
+// rule is the rule b describes, or the problems with it.
+func (b ruleBody) rule() (model.Rule, validate.Errors) {
+	var errs validate.Errors
+	if b.Contains == "" && b.Pattern == "" && b.Min == nil && b.Max == nil {
+		errs = append(errs, validate.FieldError{Field: "contains", Message: "or pattern, min or max is required"})
+	}
+	if _, err := regexp.Compile(b.Pattern); err != nil {
+		errs = append(errs, validate.FieldError{Field: "pattern", Message: "is not a regular expression: " + err.Error()})
+	}
+
+	rule := model.Rule{Contains: b.Contains, Pattern: b.Pattern, Category: b.Category, Rename: b.Rename}
+	for _, bound := range []struct {
+		field string
+		value *model.Money
+		dst   **model.Money
+	}{{"min", b.Min, &rule.Min}, {"max", b.Max, &rule.Max}} {
+		if bound.value == nil {
+			continue
+		}
+		amount := *bound.value
+		if amount.Minor <= 0 {
+			errs = append(errs, validate.FieldError{Field: bound.field, Message: "must be more than 0"})
+		}
+		if b.Currency != nil {
+			var currencyErrs validate.Errors
+			amount, currencyErrs = inCurrency(amount, *b.Currency)
+			errs = append(errs, currencyErrs...)
+		}
+		*bound.dst = &amount
+	}
+	if rule.Min != nil && rule.Max != nil {
+		if rule.Min.Currency != rule.Max.Currency {
+			errs = append(errs, validate.FieldError{Field: "max", Message: "differs in currency from min"})
+		} else if rule.Min.Minor > rule.Max.Minor {
+			errs = append(errs, validate.FieldError{Field: "max", Message: "must not be less than min"})
+		}
+	}
+	return rule, errs
+}
+
+// SetRules replaces the user's rules with those in the body, which are
+// tried in order on transactions entered without a category.
+func (t *Transaction) SetRules(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Set rules")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		// required, but may be empty to remove every rule, which the
+		// required rule does not allow
+		Rules []ruleBody `json:"rules" validate:"max=200"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+	if body.Rules == nil {
+		problem.WriteInvalid(w, r, validate.Errors{{Field: "rules", Message: "is required"}})
+		return
+	}
+
+	var errs validate.Errors
+	rules := make([]model.Rule, len(body.Rules))
+	for i, b := range body.Rules {
+		var itemErrs validate.Errors
+		if err := validate.Struct(b); err != nil && !errors.As(err, &itemErrs) {
+			writeError(w, r, err)
+			return
+		}
+		var ruleErrs validate.Errors
+		rules[i], ruleErrs = b.rule()
+		for _, e := range append(itemErrs, ruleErrs...) {
+			e.Field = fmt.Sprintf("rules[%d].%s", i, e.Field)
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	rules, err := t.Repo.SetRules(r.Context(), sheetref, rules)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, rules)
+}
+
+// RunRules applies the user's rules to the transactions already recorded in
+// a cycle, every cycle when omitted, and lists those whose name or category
+// they change. A dry run changes nothing.
+func (t *Transaction) RunRules(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Run rules")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		// a cycle ID, "current", or "all"
+		Cycle string `json:"cycle" validate:"max=64"`
+		// required, so past transactions are only rewritten on purpose
+		DryRun *bool `json:"dry_run" validate:"required"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+	if body.Cycle == "" {
+		body.Cycle = "all"
+	}
+
+	changes, err := t.Repo.RunRules(r.Context(), sheetref, body.Cycle, *body.DryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, struct {
+		Changes []model.RuleChange `json:"changes"`
+		Applied bool               `json:"applied"`
+	}{changes, !*body.DryRun})
+}
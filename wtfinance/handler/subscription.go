@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+// subscribed tells of a spreadsheet with subscriptions, once a request for
+// them has succeeded.
+func (t *Transaction) subscribed(sheetRef string) {
+	if t.Subscribed != nil {
+		t.Subscribed(sheetRef)
+	}
+}
+
+func (t *Transaction) Subscriptions(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	subscriptions, err := t.Repo.Subscriptions(r.Context(), sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	t.subscribed(sheetref)
+
+	writeJSON(w, r, http.StatusOK, subscriptions)
+}
+
+// AddSubscription adds a transaction that recurs. Its charges are posted on
+// each day they are due, from start, which is today when omitted.
+func (t *Transaction) AddSubscription(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Add subscription")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Name      string      `json:"name" validate:"required,max=100"`
+		Amount    model.Money `json:"amount" validate:"required"`
+		Currency  *string     `json:"currency"`
+		Category  string      `json:"category" validate:"required,max=50"`
+		Type      *string     `json:"type" validate:"oneof=expense income transfer"`
+		Frequency string      `json:"frequency" validate:"required,oneof=weekly monthly yearly"`
+		Day       *int        `json:"day" validate:"min=1,max=31"`
+		Start     *time.Time  `json:"start"`
+	}
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	subscription := model.Subscription{
+		Name:      body.Name,
+		Category:  body.Category,
+		Amount:    body.Amount,
+		Type:      model.Expense,
+		Frequency: body.Frequency,
+	}
+	var errs validate.Errors
+	if body.Amount.Minor <= 0 {
+		errs = append(errs, validate.FieldError{Field: "amount", Message: "must be more than 0"})
+	}
+	if body.Currency != nil {
+		var currencyErrs validate.Errors
+		subscription.Amount, currencyErrs = inCurrency(subscription.Amount, *body.Currency)
+		errs = append(errs, currencyErrs...)
+	}
+	if body.Type != nil {
+		subscription.Type = *body.Type
+	}
+	if body.Day != nil {
+		if body.Frequency != model.Monthly {
+			errs = append(errs, validate.FieldError{Field: "day", Message: "is only for monthly subscriptions"})
+		}
+		subscription.Day = *body.Day
+	}
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	subscription, err := t.Repo.AddSubscription(r.Context(), sheetref, subscription, body.Start)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	t.subscribed(sheetref)
+
+	writeJSON(w, r, http.StatusOK, subscription)
+}
+
+// UpcomingCharges lists the charges of active subscriptions not yet
+// posted, through the number of days in the query from today, 30 when
+// omitted.
+func (t *Transaction) UpcomingCharges(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	days := 30
+	if q := r.URL.Query().Get("days"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n < 0 || n > 366 {
+			problem.WriteInvalid(w, r, validate.Errors{{Field: "days", Message: "must be a whole number from 0 to 366"}})
+			return
+		}
+		days = n
+	}
+
+	charges, err := t.Repo.UpcomingCharges(r.Context(), sheetref, days)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	t.subscribed(sheetref)
+
+	writeJSON(w, r, http.StatusOK, charges)
+}
+
+// setSubscriptionStatus returns a handler moving the subscription in the
+// path to status.
+func (t *Transaction) setSubscriptionStatus(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logging.Logger(r.Context()).Debug("Set subscription status", "status", status)
+
+		sheetref, ok := sheetRef(w, r)
+		if !ok {
+			return
+		}
+
+		subscription, err := t.Repo.SetSubscriptionStatus(r.Context(), sheetref, r.PathValue("id"), status)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, subscription)
+	}
+}
+
+// PauseSubscription stops posting the charges of a subscription. Those due
+// while it is paused are never posted.
+func (t *Transaction) PauseSubscription(w http.ResponseWriter, r *http.Request) {
+	t.setSubscriptionStatus(model.Paused)(w, r)
+}
+
+// ResumeSubscription posts the charges of a paused subscription again, from
+// today.
+func (t *Transaction) ResumeSubscription(w http.ResponseWriter, r *http.Request) {
+	t.setSubscriptionStatus(model.Active)(w, r)
+}
+
+// CancelSubscription stops a subscription for good. It is still listed,
+// with the charges it posted.
+func (t *Transaction) CancelSubscription(w http.ResponseWriter, r *http.Request) {
+	t.setSubscriptionStatus(model.Cancelled)(w, r)
+}
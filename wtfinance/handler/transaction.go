@@ -1,129 +1,253 @@
 package handler
 
 import (
-	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
 	"github.com/NathanRJohnson/live-backend/wtfinance/model"
 	"github.com/NathanRJohnson/live-backend/wtfinance/repository/transaction"
 )
 
 type Transaction struct {
 	Repo *transaction.GoogleSheetsRepo
+	// told of spreadsheets with subscriptions, so their charges are posted;
+	// optional
+	Subscribed func(sheetRef string)
+}
+
+// transactionBody is what Create and Update accept. The date is kept as the
+// day it falls on in the user's time zone, and is today when omitted. The
+// amount is in the currency given, or named in it, or else the user's. A
+// transaction is an expense unless its type says otherwise, and without a
+// category is given one by the user's rules.
+type transactionBody struct {
+	DateCreated *time.Time  `json:"date"`
+	Name        string      `json:"name" validate:"required,max=100"`
+	Amount      model.Money `json:"amount" validate:"required"`
+	Currency    *string     `json:"currency"`
+	Category    string      `json:"category" validate:"max=50"`
+	Type        *string     `json:"type" validate:"oneof=expense income refund transfer"`
+	RefundOf    string      `json:"refund_of" validate:"max=64"`
+}
+
+// transaction is the transaction b describes, or the problems with its
+// amount.
+func (b transactionBody) transaction() (model.Transaction, validate.Errors) {
+	var errs validate.Errors
+	amount := b.Amount
+	if amount.Minor <= 0 {
+		errs = append(errs, validate.FieldError{Field: "amount", Message: "must be more than 0"})
+	}
+	if b.Currency != nil {
+		var currencyErrs validate.Errors
+		amount, currencyErrs = inCurrency(amount, *b.Currency)
+		errs = append(errs, currencyErrs...)
+	}
+
+	kind := model.Expense
+	if b.Type != nil {
+		kind = *b.Type
+	}
+	if b.RefundOf != "" && kind != model.Refund {
+		errs = append(errs, validate.FieldError{Field: "refund_of", Message: "is only for refunds"})
+	}
+
+	return model.Transaction{
+		Name:        b.Name,
+		Amount:      amount,
+		Category:    b.Category,
+		DateCreated: b.DateCreated,
+		Type:        kind,
+		RefundOf:    b.RefundOf,
+	}, errs
+}
+
+// inCurrency is amount in the currency given beside it, when the amount
+// does not name its own.
+func inCurrency(amount model.Money, currency string) (model.Money, validate.Errors) {
+	switch {
+	case !model.ValidCurrency(currency):
+		return amount, validate.Errors{{Field: "currency", Message: "must be an ISO 4217 code, like CAD"}}
+	case amount.Currency != "" && amount.Currency != currency:
+		return amount, validate.Errors{{Field: "currency", Message: "differs from the currency of amount"}}
+	}
+	converted, err := amount.WithCurrency(currency)
+	if err != nil {
+		return amount, validate.Errors{{Field: "amount", Message: err.Error()}}
+	}
+	return converted, nil
+}
+
+// sheetRef returns the spreadsheet the request is for, writing a problem
+// when the header is missing, or names a spreadsheet other than the one
+// linked to the caller's account.
+func sheetRef(w http.ResponseWriter, r *http.Request) (string, bool) {
+	ref := r.Header.Get("SheetRef")
+	if ref == "" {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "required header SheetRef not present")
+		return "", false
+	}
+
+	// the service can open every spreadsheet shared with it, so callers are
+	// kept to the one linked to their account
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return "", false
+	}
+	if principal.SheetRef == "" {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "no spreadsheet is linked to the account")
+		return "", false
+	}
+	if ref != principal.SheetRef {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "SheetRef is not the spreadsheet linked to the account")
+		return "", false
+	}
+	return ref, true
 }
 
 func (t *Transaction) Create(w http.ResponseWriter, r *http.Request) {
-	log.Println("Create transaction")
+	logging.Logger(r.Context()).Debug("Create transaction")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
+		return
+	}
+
+	var body transactionBody
+	if !problem.Decode(w, r, &body) {
+		return
+	}
 
-	sheetref := r.Header.Get("SheetRef")
-	if sheetref == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("error: required header SheetRef not present.")
+	transaction, errs := body.transaction()
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
 		return
 	}
 
-	var body struct {
-		DateCreated *time.Time `json:"date"`
-		Name        string     `json:"name"`
-		Amount      float32    `json:"amount"`
-		Category    string     `json:"category"`
+	transaction, err := t.Repo.Insert(r.Context(), transaction, sheetref)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("error unmarshaling requst:", err)
+	writeJSON(w, r, http.StatusOK, transaction)
+}
+
+func (t *Transaction) Get(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
 		return
 	}
 
-	if body.Name == "" || body.Category == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("transaction is missing required fields")
+	transaction, err := t.Repo.FetchTransaction(r.Context(), sheetref, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	if body.Amount <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("transaction value must be positive, non-zero")
+	writeJSON(w, r, http.StatusOK, transaction)
+}
+
+// Update replaces every field of the transaction, keeping its ID and row,
+// and the import ID it was recorded with. A refund updated without
+// refund_of keeps the expense it is for.
+func (t *Transaction) Update(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Update transaction")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
 		return
 	}
 
-	transaction := model.Transaction{
-		Name:        body.Name,
-		Amount:      body.Amount,
-		Category:    body.Category,
-		DateCreated: body.DateCreated,
+	var body transactionBody
+	if !problem.Decode(w, r, &body) {
+		return
 	}
 
-	err := t.Repo.Insert(r.Context(), transaction, sheetref)
-	if err != nil {
-		log.Println("failed to insert:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	transaction, errs := body.transaction()
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
 		return
 	}
+	transaction.ID = r.PathValue("id")
 
-	res, err := json.Marshal(transaction)
+	transaction, err := t.Repo.Update(r.Context(), transaction, sheetref)
 	if err != nil {
-		log.Println("failed to marshal:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Write(res)
+	writeJSON(w, r, http.StatusOK, transaction)
 }
 
-func (t *Transaction) History(w http.ResponseWriter, r *http.Request) {
-	log.Println("Transaction history this cycle")
+func (t *Transaction) Delete(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Delete transaction")
 
-	sheetRef := r.Header.Get("SheetRef")
-	if sheetRef == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("error: required header SheetRef not present.")
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
 		return
 	}
 
-	// decrypt the value here
-
-	transactions, err := t.Repo.FetchTransactions(r.Context(), sheetRef)
+	err := t.Repo.Delete(r.Context(), sheetref, r.PathValue("id"))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("Error fetching transactions: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (t *Transaction) History(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Transaction history this cycle")
+
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
 		return
 	}
 
-	res, err := json.Marshal(transactions)
+	// decrypt the value here
+
+	transactions, err := t.Repo.FetchTransactions(r.Context(), sheetref)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("Error marshalling JSON: %v", err)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Write(res)
+	writeJSON(w, r, http.StatusOK, transactions)
 }
 
 func (t *Transaction) CircleValues(w http.ResponseWriter, r *http.Request) {
-	sheetRef := r.Header.Get("SheetRef")
-	if sheetRef == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Printf("error: required header SheetRef not present.")
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
 		return
 	}
 
-	circleValues, err := t.Repo.FetchCircleAmounts(r.Context(), sheetRef)
+	circleValues, err := t.Repo.FetchCircleAmounts(r.Context(), sheetref)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("Error fetching transactions: %v", err)
+		writeError(w, r, err)
 		return
 	}
 
-	res, err := json.Marshal(circleValues)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		log.Printf("Error marshalling JSON: %v", err)
+	writeJSON(w, r, http.StatusOK, circleValues)
+
+}
+
+// Access answers whether the service can open the spreadsheet, which
+// wtfridge checks before linking it to an account.
+func (t *Transaction) Access(w http.ResponseWriter, r *http.Request) {
+	sheetref, ok := sheetRef(w, r)
+	if !ok {
 		return
 	}
 
-	w.Write(res)
+	if err := t.Repo.Ping(r.Context(), sheetref); err != nil {
+		writeError(w, r, err)
+		return
+	}
 
+	w.WriteHeader(http.StatusNoContent)
 }
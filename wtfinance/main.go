@@ -2,28 +2,16 @@ package main
 
 import (
 	"context"
-	"log"
-	"os"
-	"os/signal"
+	// the image has no zoneinfo, and dates are in the user's time zone
+	_ "time/tzdata"
 
+	"github.com/NathanRJohnson/live-backend/platform"
 	"github.com/NathanRJohnson/live-backend/wtfinance/application"
 )
 
 func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer cancel()
-
-	cfg := application.LoadConfig()
-
 	// TODO: add max idle connections via T
-	app, err := application.New(ctx, cfg)
-	if err != nil {
-		log.Println("failed to initialize app:", err)
-		return
-	}
-
-	err = app.Start(ctx)
-	if err != nil {
-		log.Println("failed to start app:", err)
-	}
+	platform.Main("wtfinance", application.LoadConfig, func(ctx context.Context, cfg application.Config) (platform.Service, error) {
+		return application.New(ctx, cfg)
+	})
 }
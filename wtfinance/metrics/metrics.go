@@ -0,0 +1,107 @@
+// Package metrics collects request and repository metrics. Everything
+// is recorded through Recorder, so code under test can be given Nop instead
+// of a Prometheus registry.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Recorder interface {
+	// ObserveRequest records a served request. route is the pattern the
+	// request matched, not its path, so IDs do not become labels.
+	ObserveRequest(method string, route string, status int, duration time.Duration)
+	// ObserveRepoCall records how long a repository method took.
+	ObserveRepoCall(method string, duration time.Duration)
+}
+
+// Nop discards everything recorded.
+type Nop struct{}
+
+func (Nop) ObserveRequest(string, string, int, time.Duration) {}
+func (Nop) ObserveRepoCall(string, time.Duration)             {}
+
+// Track starts timing a repository method. The returned func records it, so
+// a method is timed with
+//
+//	defer metrics.Track(g.Metrics, "Insert")()
+//
+// A nil recorder records nothing.
+func Track(rec Recorder, method string) func() {
+	if rec == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		rec.ObserveRepoCall(method, time.Since(start))
+	}
+}
+
+type routeKey struct{}
+
+type routeInfo struct {
+	route string
+}
+
+// Middleware records every request served by the handler it wraps. The
+// route label is set by Routes, requests no route matched are recorded as
+// "unmatched".
+func Middleware(rec Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			info := &routeInfo{route: "unmatched"}
+
+			sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sr, r.WithContext(context.WithValue(r.Context(), routeKey{}, info)))
+
+			rec.ObserveRequest(r.Method, info.route, sr.status, time.Since(start))
+		})
+	}
+}
+
+// Routes labels the requests served by mux with the pattern they matched.
+// prefix is the path mux is mounted at, so sub-routers behind
+// http.StripPrefix report the full route.
+func Routes(prefix string, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(routeKey{}).(*routeInfo); ok {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				info.route = withPrefix(prefix, pattern)
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Route returns the route label of the request ctx belongs to.
+func Route(ctx context.Context) string {
+	info, ok := ctx.Value(routeKey{}).(*routeInfo)
+	if !ok {
+		return "unmatched"
+	}
+	return info.route
+}
+
+// withPrefix turns "DELETE /{id}" mounted at /fridge into "/fridge/{id}",
+// and "GET /{$}" into "/fridge/". The method is left off, it is a label of
+// its own.
+func withPrefix(prefix string, pattern string) string {
+	if _, path, found := strings.Cut(pattern, " "); found {
+		pattern = path
+	}
+	return prefix + strings.TrimSuffix(pattern, "{$}")
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
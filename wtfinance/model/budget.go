@@ -0,0 +1,107 @@
+package model
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Budget is what a user means to spend on a category in a cycle.
+type Budget struct {
+	Category string `json:"category"`
+	// the cycle it is for, or empty for every cycle without its own
+	Cycle  string `json:"cycle,omitempty"`
+	Amount Money  `json:"amount"`
+}
+
+// MarshalJSON writes the currency of the amount alongside it.
+func (b Budget) MarshalJSON() ([]byte, error) {
+	type budget Budget
+	return json.Marshal(struct {
+		budget
+		Currency string `json:"currency"`
+	}{budget(b), b.Amount.Currency})
+}
+
+// ForCycle returns the budget of each category in the cycle with id: its
+// own budget, or else the one for every cycle.
+func ForCycle(budgets []Budget, id string) map[string]Money {
+	amounts := map[string]Money{}
+	for _, b := range budgets {
+		if b.Cycle == "" {
+			if _, ok := amounts[b.Category]; !ok {
+				amounts[b.Category] = b.Amount
+			}
+		}
+	}
+	for _, b := range budgets {
+		if b.Cycle == id {
+			amounts[b.Category] = b.Amount
+		}
+	}
+	return amounts
+}
+
+// Progress is spending on a category against its budget in a cycle.
+// Spending on a category without a budget is all overflow.
+type Progress struct {
+	Category string `json:"category"`
+	Budget   Money  `json:"budget"`
+	Spent    Money  `json:"spent"`
+	// what is left of the budget, never below 0
+	Remaining Money `json:"remaining"`
+	// what was spent past the budget
+	Overflow Money  `json:"overflow"`
+	Currency string `json:"currency"`
+}
+
+// Track returns the progress of every category that has a budget or was
+// spent on, by name. The budgets must be in the currency of totals.
+func Track(totals Totals, budgets map[string]Money) []Progress {
+	zero := Money{Currency: totals.Currency}
+	categories := map[string]bool{}
+	for c := range totals.Categories {
+		categories[c] = true
+	}
+	for c := range budgets {
+		categories[c] = true
+	}
+
+	progress := make([]Progress, 0, len(categories))
+	for c := range categories {
+		p := Progress{Category: c, Budget: zero, Spent: zero, Currency: totals.Currency}
+		if b, ok := budgets[c]; ok {
+			p.Budget = b
+		}
+		if s, ok := totals.Categories[c]; ok {
+			p.Spent = s
+		}
+		left := p.Budget.Minor - p.Spent.Minor
+		p.Remaining = Money{Minor: max(left, 0), Currency: totals.Currency}
+		p.Overflow = Money{Minor: max(-left, 0), Currency: totals.Currency}
+		progress = append(progress, p)
+	}
+	sort.Slice(progress, func(i, j int) bool { return progress[i].Category < progress[j].Category })
+	return progress
+}
+
+// Summarize adds up the progress of every category, in currency. Spent is
+// what fits in the budgets, so that spent and overflow make up the total, as
+// they did when the circle was read from the sheet.
+func Summarize(progress []Progress, currency string) CircleValues {
+	v := CircleValues{
+		Spent:     Money{Currency: currency},
+		Overflow:  Money{Currency: currency},
+		Total:     Money{Currency: currency},
+		Budget:    Money{Currency: currency},
+		Remaining: Money{Currency: currency},
+		Currency:  currency,
+	}
+	for _, p := range progress {
+		v.Spent.Minor += p.Spent.Minor - p.Overflow.Minor
+		v.Overflow.Minor += p.Overflow.Minor
+		v.Budget.Minor += p.Budget.Minor
+		v.Remaining.Minor += p.Remaining.Minor
+	}
+	v.Total.Minor = v.Spent.Minor + v.Overflow.Minor
+	return v
+}
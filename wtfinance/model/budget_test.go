@@ -0,0 +1,50 @@
+package model
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	cad := func(minor int64) Money { return Money{Minor: minor, Currency: "CAD"} }
+
+	tests := []struct {
+		name   string
+		spent  map[string]Money
+		budget map[string]Money
+		want   CircleValues
+	}{
+		{
+			name: "nothing spent",
+			budget: map[string]Money{
+				"Food": cad(50000),
+			},
+			want: CircleValues{Spent: cad(0), Overflow: cad(0), Total: cad(0), Budget: cad(50000), Remaining: cad(50000)},
+		},
+		{
+			name:   "within the budgets",
+			spent:  map[string]Money{"Food": cad(20000), "Rent": cad(100000)},
+			budget: map[string]Money{"Food": cad(50000), "Rent": cad(100000)},
+			want:   CircleValues{Spent: cad(120000), Overflow: cad(0), Total: cad(120000), Budget: cad(150000), Remaining: cad(30000)},
+		},
+		{
+			name:   "past a budget",
+			spent:  map[string]Money{"Food": cad(65000), "Rent": cad(90000)},
+			budget: map[string]Money{"Food": cad(50000), "Rent": cad(100000)},
+			want:   CircleValues{Spent: cad(140000), Overflow: cad(15000), Total: cad(155000), Budget: cad(150000), Remaining: cad(10000)},
+		},
+		{
+			name:   "category without a budget",
+			spent:  map[string]Money{"Food": cad(20000), "Games": cad(6000)},
+			budget: map[string]Money{"Food": cad(50000)},
+			want:   CircleValues{Spent: cad(20000), Overflow: cad(6000), Total: cad(26000), Budget: cad(50000), Remaining: cad(30000)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			totals := Totals{Categories: tt.spent, Currency: "CAD"}
+			got := Summarize(Track(totals, tt.budget), "CAD")
+			tt.want.Currency = "CAD"
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// Kinds of schedule a budget cycle can follow.
+const (
+	Monthly  = "monthly"
+	Biweekly = "biweekly"
+	Custom   = "custom"
+)
+
+// Schedule is when a user's budget cycles start.
+type Schedule struct {
+	// monthly, biweekly or custom
+	Kind string `json:"kind"`
+	// monthly: the day of the month cycles start on, or the last day of
+	// shorter months
+	Day int `json:"day,omitempty"`
+	// biweekly: any day a cycle starts on, like a payday
+	Anchor *time.Time `json:"anchor,omitempty"`
+	// custom: every day a cycle starts on
+	Dates []time.Time `json:"dates,omitempty"`
+}
+
+// DefaultSchedule is used until a user sets their own.
+var DefaultSchedule = Schedule{Kind: Monthly, Day: 1}
+
+// Cycle is one budget cycle, from Start until the day before End.
+type Cycle struct {
+	// ID is the day the cycle starts, as 2006-01-02
+	ID    string    `json:"id"`
+	Start time.Time `json:"start"`
+	// nil when a custom schedule has no later date, so the cycle runs until
+	// it is closed
+	End *time.Time `json:"end"`
+	// Current is the cycle transactions are recorded in
+	Current bool `json:"current"`
+	// the tab holding the cycle's transactions
+	Sheet string `json:"-"`
+}
+
+// CycleID is the ID of the cycle starting on start.
+func CycleID(start time.Time) string {
+	return start.Format(time.DateOnly)
+}
+
+// Holds reports whether the cycle holds day, the date it is written as.
+func (c Cycle) Holds(day time.Time) bool {
+	day = Day(day)
+	return !day.Before(c.Start) && (c.End == nil || day.Before(*c.End))
+}
+
+// Day is the midnight starting t's day, in UTC.
+func Day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Bounds returns the day the cycle holding day starts on, and the day the
+// next one starts on. end is zero when a custom schedule has no later date.
+// Days before the first date of a custom schedule belong to its first cycle.
+func (s Schedule) Bounds(day time.Time) (start, end time.Time) {
+	day = Day(day)
+
+	switch s.Kind {
+	case Biweekly:
+		anchor := Day(*s.Anchor)
+		days := int(day.Sub(anchor).Hours() / 24)
+		cycles := days / 14
+		if days < 0 && days%14 != 0 {
+			cycles--
+		}
+		start = anchor.AddDate(0, 0, 14*cycles)
+		return start, start.AddDate(0, 0, 14)
+
+	case Custom:
+		dates := make([]time.Time, len(s.Dates))
+		for i, d := range s.Dates {
+			dates[i] = Day(d)
+		}
+		sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+		// the first date after day
+		next := sort.Search(len(dates), func(i int) bool { return dates[i].After(day) })
+		if next == 0 {
+			next = 1
+		}
+		start = dates[next-1]
+		if next < len(dates) {
+			end = dates[next]
+		}
+		return start, end
+
+	default:
+		start = monthStart(day.Year(), day.Month(), s.Day)
+		if day.Before(start) {
+			start = monthStart(day.Year(), day.Month()-1, s.Day)
+		}
+		return start, monthStart(start.Year(), start.Month()+1, s.Day)
+	}
+}
+
+// monthStart is day of month m of year y, or the last day of the month when
+// it is shorter. m may be outside January to December, as with time.Date.
+func monthStart(y int, m time.Month, day int) time.Time {
+	first := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// Totals sums the transactions of a cycle, in the user's currency.
+type Totals struct {
+	Count int `json:"count"`
+	// what was spent: expenses less refunds
+	Total Money `json:"total"`
+	// what was spent on each category
+	Categories map[string]Money `json:"categories"`
+	Income     Money            `json:"income"`
+	Currency   string           `json:"currency"`
+	// the transactions in another currency with no rate for their day,
+	// which are left out of the sums
+	Unconverted []Transaction `json:"unconverted"`
+}
+
+// Sum totals transactions in currency, overall and by category, converting
+// those in other currencies. Transfers are counted, but not added up, and
+// so are transactions that have not been converted, which are listed.
+func Sum(transactions []Transaction, currency string) Totals {
+	totals := Totals{
+		Total:       Money{Currency: currency},
+		Categories:  map[string]Money{},
+		Income:      Money{Currency: currency},
+		Currency:    currency,
+		Unconverted: []Transaction{},
+	}
+	for _, t := range transactions {
+		totals.Count++
+		amount, ok := t.Home(currency)
+		if !ok {
+			totals.Unconverted = append(totals.Unconverted, t)
+			continue
+		}
+
+		if t.Type == Income {
+			totals.Income.Minor += amount.Minor
+		}
+		if t.Type != Expense && t.Type != Refund {
+			continue
+		}
+
+		category, ok := totals.Categories[t.Category]
+		if !ok {
+			category = Money{Currency: currency}
+		}
+		spent := t.Spending(amount)
+		totals.Total.Minor += spent
+		category.Minor += spent
+		totals.Categories[t.Category] = category
+	}
+	return totals
+}
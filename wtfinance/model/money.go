@@ -0,0 +1,312 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Money is an exact amount, in the minor units of its currency, like cents.
+// It is encoded in JSON as a plain number, as amounts were before they had
+// a currency, and decoded from a number or from text like "1.234,56 €".
+type Money struct {
+	Minor int64
+	// Currency is an ISO 4217 code, like CAD. Amounts decoded without one
+	// are given the user's currency.
+	Currency string
+}
+
+// currencies whose minor unit is not a hundredth
+var exponents = map[string]int{
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0,
+	"XOF": 0, "XPF": 0,
+}
+
+// Exponent is the number of decimals in an amount of currency.
+func Exponent(currency string) int {
+	if e, ok := exponents[currency]; ok {
+		return e
+	}
+	return 2
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat is the amount of currency closest to v, for numbers read from a
+// spreadsheet.
+func FromFloat(v float64, currency string) Money {
+	return Money{
+		Minor:    int64(math.Round(v * math.Pow10(Exponent(currency)))),
+		Currency: currency,
+	}
+}
+
+// Float is m as a number, for writing to a spreadsheet.
+func (m Money) Float() float64 {
+	return float64(m.Minor) / math.Pow10(Exponent(m.Currency))
+}
+
+// Decimal is m with as many decimals as its currency has, like -12.50.
+func (m Money) Decimal() string {
+	exp := Exponent(m.Currency)
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign, minor = "-", -minor
+	}
+
+	digits := strconv.FormatInt(minor, 10)
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+func (m Money) String() string {
+	return strings.TrimSpace(m.Decimal() + " " + m.Currency)
+}
+
+// Add returns the sum of m and o, which must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("cannot add %s to %s", o.Currency, m.Currency)
+	}
+	return Money{Minor: m.Minor + o.Minor, Currency: m.Currency}, nil
+}
+
+// WithCurrency is m in currency code, for amounts decoded without one,
+// which have two decimals. It fails when code has fewer decimals than m
+// needs.
+func (m Money) WithCurrency(code string) (Money, error) {
+	from, to := Exponent(m.Currency), Exponent(code)
+	minor := m.Minor
+	for ; from < to; from++ {
+		minor *= 10
+	}
+	for ; from > to; from-- {
+		if minor%10 != 0 {
+			return Money{}, fmt.Errorf("%s has more than %d decimals", m.Decimal(), Exponent(code))
+		}
+		minor /= 10
+	}
+	return Money{Minor: minor, Currency: code}, nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+
+	// numbers always have a decimal point, text is written as people do
+	decimal := '.'
+	if s, err := strconv.Unquote(text); err == nil {
+		text, decimal = s, 0
+	}
+	parsed, err := ParseMoney(text, "", decimal)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: "amount " + strconv.Quote(text), Type: reflect.TypeOf(m).Elem()}
+	}
+	*m = parsed
+	return nil
+}
+
+// Describe is how validation errors refer to amounts.
+func (Money) Describe() string {
+	return "an amount, like 12.50 or \"1.234,56 €\""
+}
+
+// currency symbols and the codes they stand for. "$" is left to the
+// user's currency, as so many currencies use it.
+var symbols = []struct{ symbol, code string }{
+	// longest first, so C$ is not read as $
+	{"US$", "USD"}, {"CA$", "CAD"}, {"AU$", "AUD"}, {"NZ$", "NZD"},
+	{"C$", "CAD"}, {"A$", "AUD"}, {"€", "EUR"}, {"£", "GBP"}, {"¥", "JPY"},
+	{"₹", "INR"}, {"₩", "KRW"}, {"Fr.", "CHF"}, {"$", ""},
+}
+
+// ParseMoney reads an amount as people write it, like "$900.00",
+// "1.234,56 €", "CAD 1 234,56", "-5" or "(12.50)". Its currency is taken
+// from a symbol or code in s, and is currency otherwise.
+//
+// When both "." and "," appear, the last is the decimal separator. When
+// only one does, once, it is the decimal separator unless three digits
+// follow it, which is how thousands are grouped. decimal, when not 0, is
+// the separator of the user's locale, and settles that case instead.
+func ParseMoney(s string, currency string, decimal rune) (Money, error) {
+	text := strings.TrimSpace(s)
+	if text == "" {
+		return Money{}, errors.New("amount is empty")
+	}
+
+	negative := false
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		negative, text = true, text[1:len(text)-1]
+	}
+	if t, ok := strings.CutPrefix(text, "-"); ok {
+		negative, text = true, t
+	}
+	if t, ok := strings.CutSuffix(text, "-"); ok {
+		negative, text = true, t
+	}
+
+	code, text, err := cutCurrency(strings.TrimSpace(text))
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q: %w", s, err)
+	}
+	if t, ok := strings.CutPrefix(text, "-"); ok {
+		negative, text = true, t
+	}
+	if code == "" {
+		code = currency
+	}
+
+	whole, fraction, err := splitDecimal(text, decimal, Exponent(code))
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q: %w", s, err)
+	}
+
+	exp := Exponent(code)
+	if len(fraction) > exp {
+		// zeros past the minor unit change nothing, as in 900.000
+		if strings.Trim(fraction[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("amount %q has more than %d decimals", s, exp)
+		}
+		fraction = fraction[:exp]
+	}
+	fraction += strings.Repeat("0", exp-len(fraction))
+
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is out of range", s)
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{Minor: minor, Currency: code}, nil
+}
+
+// cutCurrency removes a currency symbol or code from either end of text.
+func cutCurrency(text string) (code, rest string, err error) {
+	for _, s := range symbols {
+		if rest, ok := strings.CutPrefix(text, s.symbol); ok {
+			return s.code, strings.TrimSpace(rest), nil
+		}
+		if rest, ok := strings.CutSuffix(text, s.symbol); ok {
+			return s.code, strings.TrimSpace(rest), nil
+		}
+	}
+
+	// a code, like CAD 5 or 5 CAD
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return "", text, nil
+	}
+	first, last := fields[0], fields[len(fields)-1]
+	switch {
+	case ValidCurrency(first):
+		return first, strings.TrimSpace(strings.TrimPrefix(text, first)), nil
+	case ValidCurrency(last):
+		return last, strings.TrimSpace(strings.TrimSuffix(text, last)), nil
+	case strings.IndexFunc(text, unicode.IsLetter) >= 0:
+		return "", "", errors.New("has an unknown currency")
+	}
+	return "", text, nil
+}
+
+// splitDecimal splits the digits of text either side of its decimal
+// separator, dropping the grouping separators.
+func splitDecimal(text string, decimal rune, exp int) (whole, fraction string, err error) {
+	// spaces, narrow spaces and apostrophes only ever group thousands
+	text = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\u00a0', '\u202f', '\'', '\u2019':
+			return -1
+		}
+		return r
+	}, text)
+
+	sep := rune(0)
+	if i := strings.LastIndexAny(text, ".,"); i >= 0 {
+		last := rune(text[i])
+		other := ','
+		if last == ',' {
+			other = '.'
+		}
+		switch {
+		case strings.ContainsRune(text, other):
+			sep = last
+		case strings.Count(text, string(last)) > 1:
+			// only ever grouping, as in 1,234,567
+		case decimal != 0:
+			if last == decimal {
+				sep = last
+			}
+		case len(text)-i-1 != 3 || exp == 3:
+			sep = last
+		}
+	}
+
+	whole = text
+	if sep != 0 {
+		i := strings.LastIndex(text, string(sep))
+		whole, fraction = text[:i], text[i+1:]
+	}
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	if whole == "" {
+		whole = "0"
+	}
+
+	for _, part := range []string{whole, fraction} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return "", "", fmt.Errorf("has an unexpected %q", r)
+			}
+		}
+	}
+	return whole, fraction, nil
+}
+
+// DecimalSeparator is the decimal separator of a locale, like en_US or
+// de_DE, as spreadsheets name them.
+func DecimalSeparator(locale string) rune {
+	switch locale {
+	// exceptions to their language
+	case "de_CH", "fr_CH", "it_CH", "es_MX", "es_US":
+		return '.'
+	}
+
+	language, _, _ := strings.Cut(locale, "_")
+	switch language {
+	case "bg", "cs", "da", "de", "el", "es", "et", "fi", "fr", "hr", "hu",
+		"id", "it", "lt", "lv", "nb", "nl", "no", "pl", "pt", "ro", "ru",
+		"sk", "sl", "sr", "sv", "tr", "uk", "vi":
+		return ','
+	}
+	return '.'
+}
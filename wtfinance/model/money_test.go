@@ -0,0 +1,137 @@
+package model
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		text     string
+		currency string
+		decimal  rune
+		want     Money
+	}{
+		{"900", "CAD", 0, Money{90000, "CAD"}},
+		{"$900.00", "CAD", 0, Money{90000, "CAD"}},
+		{"12.5", "CAD", 0, Money{1250, "CAD"}},
+		{"-5", "CAD", 0, Money{-500, "CAD"}},
+		{"5-", "CAD", 0, Money{-500, "CAD"}},
+		{"(12.50)", "CAD", 0, Money{-1250, "CAD"}},
+		{"($12.50)", "CAD", 0, Money{-1250, "CAD"}},
+		{"-$12.50", "CAD", 0, Money{-1250, "CAD"}},
+		{"$-12.50", "CAD", 0, Money{-1250, "CAD"}},
+
+		// separators
+		{"1,234.56", "USD", 0, Money{123456, "USD"}},
+		{"1.234,56", "EUR", 0, Money{123456, "EUR"}},
+		{"1 234,56", "EUR", 0, Money{123456, "EUR"}},
+		{"1 234,56", "EUR", 0, Money{123456, "EUR"}},
+		{"1'234.56", "CHF", 0, Money{123456, "CHF"}},
+		{"1,234,567", "USD", 0, Money{123456700, "USD"}},
+		{"12,50", "EUR", 0, Money{1250, "EUR"}},
+		{"1,234", "USD", 0, Money{123400, "USD"}},
+		{"1.234", "EUR", 0, Money{123400, "EUR"}},
+		{"900.000", "CAD", '.', Money{90000, "CAD"}},
+
+		// the locale settles a lone separator before three digits
+		{"1,250", "EUR", ',', Money{125, "EUR"}},
+		{"1.250", "USD", '.', Money{125, "USD"}},
+		{"1,234", "USD", '.', Money{123400, "USD"}},
+
+		// currencies named in the text
+		{"1.234,56 €", "CAD", 0, Money{123456, "EUR"}},
+		{"£5", "CAD", 0, Money{500, "GBP"}},
+		{"C$5", "USD", 0, Money{500, "CAD"}},
+		{"US$5", "CAD", 0, Money{500, "USD"}},
+		{"CAD 1 234,56", "USD", 0, Money{123456, "CAD"}},
+		{"5 USD", "CAD", 0, Money{500, "USD"}},
+
+		// currencies without a hundredth
+		{"¥1,234", "CAD", 0, Money{1234, "JPY"}},
+		{"1234", "JPY", 0, Money{1234, "JPY"}},
+		{"1.234", "KWD", 0, Money{1234, "KWD"}},
+		{"1,234.567", "KWD", 0, Money{1234567, "KWD"}},
+		{"0.5", "BHD", 0, Money{500, "BHD"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseMoney(tt.text, tt.currency, tt.decimal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoneyRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		currency string
+		decimal  rune
+	}{
+		{"empty", " ", "CAD", 0},
+		{"too many decimals", "12.5051", "CAD", 0},
+		{"three decimals after the locale's separator", "12,505", "EUR", ','},
+		{"decimals of a currency without them", "12.50", "JPY", '.'},
+		{"unknown currency", "12 dollars", "CAD", 0},
+		{"letters", "12a", "CAD", 0},
+		{"out of range", "99999999999999999999", "CAD", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := ParseMoney(tt.text, tt.currency, tt.decimal); err == nil {
+				t.Errorf("ParseMoney(%q) = %v, want an error", tt.text, got)
+			}
+		})
+	}
+}
+
+func TestSplitDecimal(t *testing.T) {
+	tests := []struct {
+		text         string
+		decimal      rune
+		exp          int
+		whole, fract string
+	}{
+		{"1234", 0, 2, "1234", ""},
+		{"1234.5", 0, 2, "1234", "5"},
+		{"1,234.5", 0, 2, "1234", "5"},
+		{"1.234,5", 0, 2, "1234", "5"},
+		{"1,234", 0, 2, "1234", ""},
+		{"1,234", 0, 3, "1", "234"},
+		{"1,234", ',', 2, "1", "234"},
+		{"1.234.567,89", 0, 2, "1234567", "89"},
+		{".5", 0, 2, "0", "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			whole, fraction, err := splitDecimal(tt.text, tt.decimal, tt.exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if whole != tt.whole || fraction != tt.fract {
+				t.Errorf("got %q and %q, want %q and %q", whole, fraction, tt.whole, tt.fract)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{90000, "CAD"}, "900.00"},
+		{Money{-5, "CAD"}, "-0.05"},
+		{Money{1234, "JPY"}, "1234"},
+		{Money{1234, "KWD"}, "1.234"},
+		{Money{5, "BHD"}, "0.005"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.want {
+			t.Errorf("%d %s: got %s, want %s", tt.money.Minor, tt.money.Currency, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package model
+
+// Preferences are the settings a user keeps with their spreadsheet.
+type Preferences struct {
+	// TimeZone is an IANA name, like America/Toronto. Transaction dates and
+	// budget cycles follow it.
+	TimeZone string `json:"timezone"`
+	// Currency is the ISO 4217 code of amounts entered without one.
+	Currency string `json:"currency"`
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where a rate came from.
+const (
+	// the server's rate file
+	RateFile = "file"
+	// entered by the user
+	RateUser = "user"
+)
+
+// Rate is what one unit of From is worth in To, from Date until the next
+// rate between them.
+type Rate struct {
+	Date   time.Time `json:"date"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Rate   float64   `json:"rate"`
+	Source string    `json:"source"`
+}
+
+// Rates is a table of exchange rates, in the order they were added.
+type Rates []Rate
+
+// Find returns the rate from from to to on day: the latest one on or
+// before it, or the inverse of the latest one the other way. Of rates on
+// the same day, the one added last wins, so a user's rates are added after
+// the file's.
+func (rs Rates) Find(from, to string, day time.Time) (Rate, bool) {
+	day = Day(day)
+
+	var found Rate
+	ok := false
+	for _, r := range rs {
+		if Day(r.Date).After(day) || r.Rate <= 0 {
+			continue
+		}
+		switch {
+		case r.From == from && r.To == to:
+		case r.From == to && r.To == from:
+			r = Rate{Date: r.Date, From: from, To: to, Rate: 1 / r.Rate, Source: r.Source}
+		default:
+			continue
+		}
+		if !ok || !Day(r.Date).Before(Day(found.Date)) {
+			found, ok = r, true
+		}
+	}
+	return found, ok
+}
+
+// Convert returns m in currency to on day, and the rate it was converted
+// at. It fails when no rate is known.
+func (rs Rates) Convert(m Money, to string, day time.Time) (Money, Rate, error) {
+	if m.Currency == to {
+		return m, Rate{Date: Day(day), From: to, To: to, Rate: 1}, nil
+	}
+	rate, ok := rs.Find(m.Currency, to, day)
+	if !ok {
+		return Money{}, Rate{}, fmt.Errorf("no %s to %s rate on or before %s", m.Currency, to, day.Format(time.DateOnly))
+	}
+	return rate.Apply(m), rate, nil
+}
+
+// Apply converts m, which is in r.From, to r.To.
+func (r Rate) Apply(m Money) Money {
+	scale := math.Pow10(Exponent(r.To) - Exponent(m.Currency))
+	return Money{
+		Minor:    int64(math.Round(float64(m.Minor) * r.Rate * scale)),
+		Currency: r.To,
+	}
+}
+
+// Sorted returns the rates by date, then currencies.
+func (rs Rates) Sorted() Rates {
+	sorted := append(Rates{}, rs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+	return sorted
+}
+
+// ReadRates reads a rate file: CSV with a header, and a date, the two
+// currencies and the rate on each line, like
+//
+//	date,from,to,rate
+//	2024-05-01,EUR,CAD,1.4712
+func ReadRates(r io.Reader) (Rates, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("rates: missing the header")
+	}
+
+	var rates Rates
+	for i, record := range records[1:] {
+		rate, err := ParseRate(record)
+		if err != nil {
+			return nil, fmt.Errorf("rates: line %d: %w", i+2, err)
+		}
+		rate.Source = RateFile
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// ParseRate reads a rate from its date, currencies and rate, as text.
+func ParseRate(fields []string) (Rate, error) {
+	if len(fields) < 4 {
+		return Rate{}, fmt.Errorf("has %d of 4 fields", len(fields))
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+
+	date, err := time.Parse(time.DateOnly, fields[0])
+	if err != nil {
+		return Rate{}, fmt.Errorf("bad date %q", fields[0])
+	}
+	for _, code := range fields[1:3] {
+		if !ValidCurrency(code) {
+			return Rate{}, fmt.Errorf("bad currency %q", code)
+		}
+	}
+	rate, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return Rate{}, fmt.Errorf("bad rate %q", fields[3])
+	}
+	return Rate{Date: date, From: fields[1], To: fields[2], Rate: rate}, nil
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestRatesFind(t *testing.T) {
+	rates := Rates{
+		{Date: date("2024-05-01"), From: "EUR", To: "CAD", Rate: 1.47, Source: RateFile},
+		{Date: date("2024-05-10"), From: "EUR", To: "CAD", Rate: 1.50, Source: RateFile},
+		{Date: date("2024-05-10"), From: "EUR", To: "CAD", Rate: 1.52, Source: RateUser},
+		{Date: date("2024-05-15"), From: "CAD", To: "EUR", Rate: 0.5, Source: RateFile},
+		{Date: date("2024-05-20"), From: "USD", To: "CAD", Rate: 0, Source: RateUser},
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		day      string
+		want     float64
+		source   string
+		ok       bool
+	}{
+		{"before any rate", "EUR", "CAD", "2024-04-30", 0, "", false},
+		{"on the day of a rate", "EUR", "CAD", "2024-05-01", 1.47, RateFile, true},
+		{"between rates", "EUR", "CAD", "2024-05-05", 1.47, RateFile, true},
+		{"the last added wins on the same day", "EUR", "CAD", "2024-05-12", 1.52, RateUser, true},
+		{"a later rate the other way", "EUR", "CAD", "2024-05-15", 2, RateFile, true},
+		{"inverted", "CAD", "EUR", "2024-05-12", 1 / 1.52, RateUser, true},
+		{"not inverted", "CAD", "EUR", "2024-05-16", 0.5, RateFile, true},
+		{"unknown currencies", "GBP", "CAD", "2024-05-16", 0, "", false},
+		{"a rate of zero is ignored", "USD", "CAD", "2024-05-21", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rates.Find(tt.from, tt.to, date(tt.day))
+			if ok != tt.ok {
+				t.Fatalf("found %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if got.From != tt.from || got.To != tt.to {
+				t.Errorf("got a %s to %s rate, want %s to %s", got.From, got.To, tt.from, tt.to)
+			}
+			if got.Rate != tt.want || got.Source != tt.source {
+				t.Errorf("got %v from %s, want %v from %s", got.Rate, got.Source, tt.want, tt.source)
+			}
+		})
+	}
+}
+
+func TestRatesConvert(t *testing.T) {
+	rates := Rates{
+		{Date: date("2024-05-01"), From: "EUR", To: "CAD", Rate: 1.4712},
+		{Date: date("2024-05-01"), From: "CAD", To: "JPY", Rate: 114.3},
+		{Date: date("2024-05-01"), From: "KWD", To: "CAD", Rate: 4.45},
+	}
+	day := date("2024-05-02")
+
+	tests := []struct {
+		money Money
+		to    string
+		want  Money
+	}{
+		{Money{1000, "CAD"}, "CAD", Money{1000, "CAD"}},
+		{Money{1000, "EUR"}, "CAD", Money{1471, "CAD"}},
+		{Money{1471, "CAD"}, "EUR", Money{1000, "EUR"}},
+		{Money{1000, "CAD"}, "JPY", Money{1143, "JPY"}},
+		{Money{1143, "JPY"}, "CAD", Money{1000, "CAD"}},
+		{Money{1000, "KWD"}, "CAD", Money{445, "CAD"}},
+	}
+	for _, tt := range tests {
+		got, _, err := rates.Convert(tt.money, tt.to, day)
+		if err != nil {
+			t.Errorf("%s %s to %s: %v", tt.money.Decimal(), tt.money.Currency, tt.to, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s %s to %s: got %v, want %v", tt.money.Decimal(), tt.money.Currency, tt.to, got, tt.want)
+		}
+	}
+
+	if _, _, err := rates.Convert(Money{1000, "GBP"}, "CAD", day); err == nil {
+		t.Error("converted GBP without a rate")
+	}
+}
+
+func TestReadRates(t *testing.T) {
+	rates, err := ReadRates(strings.NewReader("date,from,to,rate\n2024-05-01, EUR ,CAD,1.4712\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Rate{Date: date("2024-05-01"), From: "EUR", To: "CAD", Rate: 1.4712, Source: RateFile}
+	if len(rates) != 1 || rates[0] != want {
+		t.Errorf("got %+v, want %+v", rates, want)
+	}
+
+	for _, line := range []string{"2024-05-01,EUR,CAD", "05/01/2024,EUR,CAD,1.47", "2024-05-01,EURO,CAD,1.47", "2024-05-01,EUR,CAD,-1", "2024-05-01,EUR,CAD,x"} {
+		if _, err := ReadRates(strings.NewReader("date,from,to,rate\n" + line + "\n")); err == nil {
+			t.Errorf("read %q", line)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Uncategorized is the category of transactions entered without one that no
+// rule matches.
+const Uncategorized = "Uncategorized"
+
+// Rule gives the transactions it matches a category and, optionally, a
+// name, so the same spending is always labelled the same way. A rule
+// matches a transaction when every condition it has holds.
+type Rule struct {
+	// the name holds this, in any case
+	Contains string `json:"contains,omitempty"`
+	// the name matches this regular expression, in RE2 syntax
+	Pattern string `json:"pattern,omitempty"`
+	// the amount is within these, inclusive, in the user's currency when
+	// the transaction is in another
+	Min *Money `json:"min,omitempty"`
+	Max *Money `json:"max,omitempty"`
+
+	Category string `json:"category"`
+	// the name given to the transactions it matches, or empty to keep
+	// theirs
+	Rename string `json:"rename,omitempty"`
+}
+
+// Currency is the currency of the rule's amounts, or empty when it has
+// none.
+func (r Rule) Currency() string {
+	if r.Min != nil {
+		return r.Min.Currency
+	}
+	if r.Max != nil {
+		return r.Max.Currency
+	}
+	return ""
+}
+
+// MarshalJSON writes the currency of the amounts alongside them.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	type rule Rule
+	return json.Marshal(struct {
+		rule
+		Currency string `json:"currency,omitempty"`
+	}{rule(r), r.Currency()})
+}
+
+// Ruleset is a user's rules, ready to apply in order.
+type Ruleset struct {
+	rules    []Rule
+	patterns []*regexp.Regexp
+}
+
+// NewRuleset compiles rules, failing with the index of a rule whose
+// pattern is not a regular expression.
+func NewRuleset(rules []Rule) (Ruleset, error) {
+	rs := Ruleset{rules: rules, patterns: make([]*regexp.Regexp, len(rules))}
+	for i, r := range rules {
+		if r.Pattern == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return Ruleset{}, fmt.Errorf("rule %d: %w", i, err)
+		}
+		rs.patterns[i] = pattern
+	}
+	return rs, nil
+}
+
+// Match returns the index of the first rule matching t, or -1 when none
+// does.
+func (rs Ruleset) Match(t Transaction) int {
+	for i, r := range rs.rules {
+		if r.Contains != "" && !strings.Contains(strings.ToLower(t.Name), strings.ToLower(r.Contains)) {
+			continue
+		}
+		if rs.patterns[i] != nil && !rs.patterns[i].MatchString(t.Name) {
+			continue
+		}
+		if (r.Min != nil || r.Max != nil) && !r.inRange(t) {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// inRange reports whether the amount of t is within the rule's.
+func (r Rule) inRange(t Transaction) bool {
+	amount := t.Amount
+	if amount.Currency != r.Currency() {
+		if t.Converted == nil || t.Converted.Amount.Currency != r.Currency() {
+			return false
+		}
+		amount = t.Converted.Amount
+	}
+	return (r.Min == nil || amount.Minor >= r.Min.Minor) && (r.Max == nil || amount.Minor <= r.Max.Minor)
+}
+
+// Apply gives t the category and name of the first rule matching it,
+// returning the rule's index, or -1 and t as it is when none does.
+func (rs Ruleset) Apply(t Transaction) (Transaction, int) {
+	i := rs.Match(t)
+	if i < 0 {
+		return t, -1
+	}
+	t.Category = rs.rules[i].Category
+	if rs.rules[i].Rename != "" {
+		t.Name = rs.rules[i].Rename
+	}
+	return t, i
+}
+
+// Labels are what rules give a transaction.
+type Labels struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+// RuleChange is a transaction whose labels running the rules changes.
+type RuleChange struct {
+	Transaction string    `json:"transaction"`
+	Date        time.Time `json:"date"`
+	// the index of the rule that matched
+	Rule   int    `json:"rule"`
+	Before Labels `json:"before"`
+	After  Labels `json:"after"`
+}
@@ -0,0 +1,52 @@
+package model
+
+import "testing"
+
+func TestRulesetApply(t *testing.T) {
+	cad := func(minor int64) *Money { return &Money{Minor: minor, Currency: "CAD"} }
+	rules := []Rule{
+		{Contains: "amzn", Max: cad(2000), Category: "Books"},
+		{Pattern: `^UBER\s*\*\s*EATS`, Category: "Takeout", Rename: "Uber Eats"},
+		{Contains: "uber", Category: "Transit"},
+		{Contains: "amzn", Category: "Shopping", Rename: "Amazon"},
+		{Min: cad(100000), Category: "Big"},
+	}
+	rs, err := NewRuleset(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		tx       Transaction
+		rule     int
+		category string
+		rename   string
+	}{
+		{"first rule within its range", Transaction{Name: "AMZN Mktp", Amount: Money{1500, "CAD"}}, 0, "Books", "AMZN Mktp"},
+		{"next rule past the range", Transaction{Name: "AMZN Mktp", Amount: Money{2500, "CAD"}}, 3, "Shopping", "Amazon"},
+		{"pattern before a broader rule", Transaction{Name: "UBER *EATS 1234", Amount: Money{3000, "CAD"}}, 1, "Takeout", "Uber Eats"},
+		{"pattern is case sensitive", Transaction{Name: "uber *eats", Amount: Money{3000, "CAD"}}, 2, "Transit", "uber *eats"},
+		{"converted amount in range", Transaction{Name: "AMZN.com", Amount: Money{1000, "USD"}, Converted: &Conversion{Amount: Money{1370, "CAD"}}}, 0, "Books", "AMZN.com"},
+		{"unconverted amount out of range", Transaction{Name: "AMZN.com", Amount: Money{1000, "USD"}}, 3, "Shopping", "Amazon"},
+		{"only an amount", Transaction{Name: "Landlord", Amount: Money{150000, "CAD"}}, 4, "Big", "Landlord"},
+		{"no rule", Transaction{Name: "Landlord", Amount: Money{500, "CAD"}, Category: "Rent"}, -1, "Rent", "Landlord"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, i := rs.Apply(tt.tx)
+			if i != tt.rule {
+				t.Errorf("matched rule %d, want %d", i, tt.rule)
+			}
+			if got.Category != tt.category || got.Name != tt.rename {
+				t.Errorf("got %q named %q, want %q named %q", got.Category, got.Name, tt.category, tt.rename)
+			}
+		})
+	}
+}
+
+func TestNewRulesetRejectsBadPatterns(t *testing.T) {
+	if _, err := NewRuleset([]Rule{{Contains: "a", Category: "A"}, {Pattern: "(", Category: "B"}}); err == nil {
+		t.Error("compiled the pattern (")
+	}
+}
@@ -0,0 +1,52 @@
+package model
+
+import "strings"
+
+// Mapping says where a bank puts each field in the CSV statements it
+// exports. Columns are named by their header.
+type Mapping struct {
+	Bank string `json:"bank"`
+	// the field separator, a comma when empty
+	Delimiter string `json:"delimiter,omitempty"`
+	Date      string `json:"date"`
+	// how dates are written, like DD/MM/YYYY. YYYY-MM-DD when empty.
+	DateFormat string `json:"date_format,omitempty"`
+	Name       string `json:"name"`
+	// a signed amount, negative for money spent, or else debit and credit
+	// columns holding money spent and money received
+	Amount string `json:"amount,omitempty"`
+	Debit  string `json:"debit,omitempty"`
+	Credit string `json:"credit,omitempty"`
+	// optional columns
+	Category string `json:"category,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	// the amount column has money spent as positive numbers
+	ExpensesPositive bool `json:"expenses_positive,omitempty"`
+}
+
+// Layout is the Go time layout of the mapping's date format.
+func (m Mapping) Layout() string {
+	if m.DateFormat == "" {
+		return "2006-01-02"
+	}
+	return strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02", "M", "1", "D", "2").
+		Replace(strings.ToUpper(m.DateFormat))
+}
+
+// How an imported line compares with the transactions already recorded.
+const (
+	// nothing like it was recorded
+	ImportNew = "new"
+	// it was imported before
+	ImportDuplicate = "duplicate"
+	// a transaction entered by hand has its day and amount
+	ImportPossibleDuplicate = "possible_duplicate"
+)
+
+// ImportLine is a transaction read from a statement, before it is recorded.
+type ImportLine struct {
+	Transaction Transaction `json:"transaction"`
+	Status      string      `json:"status"`
+	// the ID of the transaction it may duplicate
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
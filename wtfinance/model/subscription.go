@@ -0,0 +1,141 @@
+package model
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// How often a subscription is charged, besides Monthly.
+const (
+	Weekly = "weekly"
+	Yearly = "yearly"
+)
+
+// Frequencies is every frequency a subscription can be charged at.
+var Frequencies = []string{Weekly, Monthly, Yearly}
+
+// States of a subscription.
+const (
+	Active = "active"
+	// charges are not posted until it is resumed, and those due meanwhile
+	// are never posted
+	Paused    = "paused"
+	Cancelled = "cancelled"
+)
+
+// Subscription is a transaction that recurs, like rent or a phone bill,
+// posted on each day it is due.
+type Subscription struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Amount   Money  `json:"amount"`
+	Type     string `json:"type"`
+	// weekly, monthly or yearly
+	Frequency string `json:"frequency"`
+	// the first day it is charged; weekly and yearly charges fall on its
+	// weekday and its day of the year
+	Start time.Time `json:"start"`
+	// monthly: the day of the month it is charged, or the last day of
+	// shorter months
+	Day    int    `json:"day,omitempty"`
+	Status string `json:"status"`
+	// the day of the last charge posted, nil before the first
+	Posted *time.Time `json:"posted"`
+}
+
+// MarshalJSON writes the currency of the amount alongside it.
+func (s Subscription) MarshalJSON() ([]byte, error) {
+	type subscription Subscription
+	return json.Marshal(struct {
+		subscription
+		Currency string `json:"currency"`
+	}{subscription(s), s.Amount.Currency})
+}
+
+// occurrence is the nth day s is charged on, counting from 0 for the first
+// on or after its start.
+func (s Subscription) occurrence(n int) time.Time {
+	start := Day(s.Start)
+	switch s.Frequency {
+	case Weekly:
+		return start.AddDate(0, 0, 7*n)
+	case Yearly:
+		return monthStart(start.Year()+n, start.Month(), start.Day())
+	default:
+		first := monthStart(start.Year(), start.Month(), s.Day)
+		if first.Before(start) {
+			n++
+		}
+		return monthStart(start.Year(), start.Month()+time.Month(n), s.Day)
+	}
+}
+
+// Charges are the days s is charged on from from to through, inclusive,
+// as model.Day gives them.
+func (s Subscription) Charges(from, through time.Time) []time.Time {
+	from, through = Day(from), Day(through)
+	var days []time.Time
+	for n := 0; ; n++ {
+		day := s.occurrence(n)
+		if day.After(through) {
+			return days
+		}
+		if !day.Before(from) {
+			days = append(days, day)
+		}
+	}
+}
+
+// Due are the days s is charged on that have not been posted, up to and
+// including today. None are due unless it is active.
+func (s Subscription) Due(today time.Time) []time.Time {
+	if s.Status != Active {
+		return nil
+	}
+	from := s.Start
+	if s.Posted != nil {
+		from = Day(*s.Posted).AddDate(0, 0, 1)
+	}
+	return s.Charges(from, today)
+}
+
+// Charge is a day a subscription will be charged on.
+type Charge struct {
+	Subscription string    `json:"subscription"`
+	Date         time.Time `json:"date"`
+	Name         string    `json:"name"`
+	Category     string    `json:"category"`
+	Amount       Money     `json:"amount"`
+	Type         string    `json:"type"`
+}
+
+// MarshalJSON writes the currency of the amount alongside it.
+func (c Charge) MarshalJSON() ([]byte, error) {
+	type charge Charge
+	return json.Marshal(struct {
+		charge
+		Currency string `json:"currency"`
+	}{charge(c), c.Amount.Currency})
+}
+
+// Upcoming lists the charges of the active subscriptions from the first
+// not yet posted through until, by day.
+func Upcoming(subscriptions []Subscription, until time.Time) []Charge {
+	charges := []Charge{}
+	for _, s := range subscriptions {
+		for _, day := range s.Due(until) {
+			charges = append(charges, Charge{
+				Subscription: s.ID,
+				Date:         day,
+				Name:         s.Name,
+				Category:     s.Category,
+				Amount:       s.Amount,
+				Type:         s.Type,
+			})
+		}
+	}
+	sort.SliceStable(charges, func(i, j int) bool { return charges[i].Date.Before(charges[j].Date) })
+	return charges
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func dates(days ...string) []time.Time {
+	var ts []time.Time
+	for _, d := range days {
+		ts = append(ts, date(d))
+	}
+	return ts
+}
+
+func TestSubscriptionCharges(t *testing.T) {
+	tests := []struct {
+		name          string
+		subscription  Subscription
+		from, through string
+		want          []time.Time
+	}{
+		{
+			name:         "weekly on the start's weekday",
+			subscription: Subscription{Frequency: Weekly, Start: date("2024-05-03")},
+			from:         "2024-05-01", through: "2024-05-24",
+			want: dates("2024-05-03", "2024-05-10", "2024-05-17", "2024-05-24"),
+		},
+		{
+			name:         "monthly from the day after the start",
+			subscription: Subscription{Frequency: Monthly, Start: date("2024-05-10"), Day: 15},
+			from:         "2024-05-01", through: "2024-07-31",
+			want: dates("2024-05-15", "2024-06-15", "2024-07-15"),
+		},
+		{
+			name:         "monthly with the day before the start",
+			subscription: Subscription{Frequency: Monthly, Start: date("2024-05-20"), Day: 15},
+			from:         "2024-05-01", through: "2024-07-31",
+			want: dates("2024-06-15", "2024-07-15"),
+		},
+		{
+			name:         "monthly on the last day of shorter months",
+			subscription: Subscription{Frequency: Monthly, Start: date("2024-01-31"), Day: 31},
+			from:         "2024-01-01", through: "2024-04-30",
+			want: dates("2024-01-31", "2024-02-29", "2024-03-31", "2024-04-30"),
+		},
+		{
+			name:         "yearly on a leap day",
+			subscription: Subscription{Frequency: Yearly, Start: date("2024-02-29")},
+			from:         "2024-01-01", through: "2028-12-31",
+			want: dates("2024-02-29", "2025-02-28", "2026-02-28", "2027-02-28", "2028-02-29"),
+		},
+		{
+			name:         "only within the days asked for",
+			subscription: Subscription{Frequency: Weekly, Start: date("2024-01-05")},
+			from:         "2024-05-04", through: "2024-05-16",
+			want: dates("2024-05-10"),
+		},
+		{
+			name:         "none before the start",
+			subscription: Subscription{Frequency: Monthly, Start: date("2024-06-01"), Day: 1},
+			from:         "2024-01-01", through: "2024-05-31",
+		},
+		{
+			name:         "the time of day is ignored",
+			subscription: Subscription{Frequency: Weekly, Start: date("2024-05-03").Add(20 * time.Hour)},
+			from:         "2024-05-03", through: "2024-05-03",
+			want: dates("2024-05-03"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.subscription.Charges(date(tt.from), date(tt.through))
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionDue(t *testing.T) {
+	posted := date("2024-06-15")
+
+	tests := []struct {
+		name   string
+		status string
+		posted *time.Time
+		want   []time.Time
+	}{
+		{"never posted", Active, nil, dates("2024-05-15", "2024-06-15", "2024-07-15")},
+		{"after the last posted", Active, &posted, dates("2024-07-15")},
+		{"paused", Paused, nil, nil},
+		{"cancelled", Cancelled, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Subscription{Frequency: Monthly, Start: date("2024-05-01"), Day: 15, Status: tt.status, Posted: tt.posted}
+			got := s.Due(date("2024-07-15"))
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpcoming(t *testing.T) {
+	subscriptions := []Subscription{
+		{ID: "rent", Frequency: Monthly, Start: date("2024-05-01"), Day: 1, Status: Active},
+		{ID: "gym", Frequency: Weekly, Start: date("2024-05-08"), Status: Active},
+		{ID: "paper", Frequency: Weekly, Start: date("2024-05-01"), Status: Paused},
+	}
+
+	var got []string
+	for _, c := range Upcoming(subscriptions, date("2024-06-05")) {
+		got = append(got, c.Date.Format(time.DateOnly)+" "+c.Subscription)
+	}
+	want := []string{
+		"2024-05-01 rent", "2024-05-08 gym", "2024-05-15 gym", "2024-05-22 gym",
+		"2024-05-29 gym", "2024-06-01 rent", "2024-06-05 gym",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
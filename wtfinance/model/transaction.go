@@ -1,10 +1,107 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of transaction. Amounts are never negative; the type says which way
+// the money went.
+const (
+	// money spent, which counts against budgets
+	Expense = "expense"
+	// money earned, which is not spending
+	Income = "income"
+	// money given back for an expense, which undoes that much spending
+	Refund = "refund"
+	// money moved between the user's own accounts, which is not spending
+	Transfer = "transfer"
+)
+
+// Types are the types of transaction, in the order they are listed.
+var Types = []string{Expense, Income, Refund, Transfer}
 
 type Transaction struct {
+	ID          string     `json:"id"`
 	DateCreated *time.Time `json:"date"`
 	Name        string     `json:"name"`
 	Category    string     `json:"category"`
-	Amount      float32    `json:"amount"`
+	Amount      Money      `json:"amount"`
+	Type        string     `json:"type"`
+	// the ID of the expense a refund gives money back for, when known
+	RefundOf string `json:"refund_of,omitempty"`
+	// identifies the statement line it was imported from
+	ImportID string `json:"import_id,omitempty"`
+	// Converted is the amount in the user's currency, when it is in another
+	// and a rate is known
+	Converted *Conversion `json:"converted,omitempty"`
+}
+
+// MarshalJSON writes the currency of the amount alongside it, so amounts
+// stay plain numbers.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	type transaction Transaction
+	return json.Marshal(struct {
+		transaction
+		Currency string `json:"currency"`
+	}{transaction(t), t.Amount.Currency})
+}
+
+// Conversion is an amount converted to the user's currency.
+type Conversion struct {
+	Amount Money `json:"amount"`
+	// the rate it was converted at
+	Rate Rate `json:"rate"`
+}
+
+// MarshalJSON writes the currency of the amount alongside it.
+func (c Conversion) MarshalJSON() ([]byte, error) {
+	type conversion Conversion
+	return json.Marshal(struct {
+		conversion
+		Currency string `json:"currency"`
+	}{conversion(c), c.Amount.Currency})
+}
+
+// Home is the transaction's amount in the user's currency, which is
+// currency: the amount itself, or its conversion.
+func (t Transaction) Home(currency string) (Money, bool) {
+	switch {
+	case t.Amount.Currency == currency:
+		return t.Amount, true
+	case t.Converted != nil && t.Converted.Amount.Currency == currency:
+		return t.Converted.Amount, true
+	}
+	return Money{}, false
+}
+
+// Spending is what the transaction adds to spending, given its amount in
+// the user's currency: all of it for an expense, less it for a refund, and
+// nothing for income or a transfer.
+func (t Transaction) Spending(amount Money) int64 {
+	switch t.Type {
+	case Expense:
+		return amount.Minor
+	case Refund:
+		return -amount.Minor
+	}
+	return 0
+}
+
+// CircleValues is spending against the budget in a cycle, over every
+// category.
+type CircleValues struct {
+	// spent within the budgets of categories
+	Spent Money `json:"spent"`
+	// spent past the budgets of categories, or on categories without one
+	Overflow Money `json:"overflow"`
+	// spent and overflow
+	Total Money `json:"total"`
+	// the budgets of every category
+	Budget    Money  `json:"budget"`
+	Remaining Money  `json:"remaining"`
+	Currency  string `json:"currency"`
+	// how many transactions and budgets in another currency were left out,
+	// for want of a rate
+	Unconverted int `json:"unconverted"`
 }
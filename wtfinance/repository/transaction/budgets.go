@@ -0,0 +1,271 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/sheets/v4"
+)
+
+// The budget tab holds one budget to a row below a header: the category,
+// the cycle it is for or nothing for every cycle, the amount and its
+// currency. Deleting a budget clears its row.
+
+// budgetRow is a budget and the row it is kept in.
+type budgetRow struct {
+	budget model.Budget
+	row    int
+}
+
+// readBudgets reads the budget tab. A spreadsheet without one has no
+// budgets.
+func (g *GoogleSheetsRepo) readBudgets(ctx context.Context, sheetRef string, s settings) ([]budgetRow, error) {
+	readRange := fmt.Sprintf("%s!A2:D", g.layout().BudgetSheet)
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, readRange).ValueRenderOption("UNFORMATTED_VALUE").Context(ctx).Do()
+	if missingSheet(err) {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve budgets", "err", err)
+		return nil, sheetsError(err)
+	}
+
+	var budgets []budgetRow
+	for i, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		budget, err := parseBudgetRow(row, s)
+		if err != nil {
+			logging.Logger(ctx).Warn("skipping budget", "row", i+2, "err", err)
+			continue
+		}
+		budgets = append(budgets, budgetRow{budget: budget, row: i + 2})
+	}
+	return budgets, nil
+}
+
+func parseBudgetRow(row []interface{}, s settings) (model.Budget, error) {
+	if len(row) < 3 {
+		return model.Budget{}, fmt.Errorf("row has %d of 3 columns", len(row))
+	}
+	currency := s.currency
+	if len(row) > 3 && model.ValidCurrency(fmt.Sprintf("%v", row[3])) {
+		currency = fmt.Sprintf("%v", row[3])
+	}
+	amount, err := parseAmount(row[2], currency, s.decimal)
+	if err != nil {
+		return model.Budget{}, fmt.Errorf("bad value %v for field amount: %w", row[2], err)
+	}
+	return model.Budget{
+		Category: fmt.Sprintf("%v", row[0]),
+		Cycle:    fmt.Sprintf("%v", row[1]),
+		Amount:   amount,
+	}, nil
+}
+
+// Budgets lists the budgets of sheetRef.
+func (g *GoogleSheetsRepo) Budgets(ctx context.Context, sheetRef string) ([]model.Budget, error) {
+	defer metrics.Track(g.Metrics, "Budgets")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Budgets")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.readBudgets(ctx, sheetRef, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	budgets := []model.Budget{}
+	for _, r := range rows {
+		budgets = append(budgets, r.budget)
+	}
+	return budgets, nil
+}
+
+// SetBudget sets the budget of a category, for one cycle or for every
+// cycle, replacing the one it had. An amount without a currency is in the
+// user's.
+func (g *GoogleSheetsRepo) SetBudget(ctx context.Context, sheetRef string, budget model.Budget) (model.Budget, error) {
+	defer metrics.Track(g.Metrics, "SetBudget")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.SetBudget")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Budget{}, err
+	}
+	if budget.Amount.Currency == "" {
+		if budget.Amount, err = budget.Amount.WithCurrency(settings.currency); err != nil {
+			return model.Budget{}, fmt.Errorf("%w: amount %v", ErrInvalid, err)
+		}
+	}
+	rows, err := g.readBudgets(ctx, sheetRef, settings)
+	if err != nil {
+		return model.Budget{}, err
+	}
+
+	layout := g.layout()
+	values := []interface{}{budget.Category, budget.Cycle, budget.Amount.Float(), budget.Amount.Currency}
+	for _, r := range rows {
+		if r.budget.Category != budget.Category || r.budget.Cycle != budget.Cycle {
+			continue
+		}
+		vr := &sheets.ValueRange{Values: [][]interface{}{values}}
+		writeRange := fmt.Sprintf("%s!A%d:D%d", layout.BudgetSheet, r.row, r.row)
+		_, err := g.Service.Spreadsheets.Values.Update(sheetRef, writeRange, vr).ValueInputOption("RAW").Context(ctx).Do()
+		if err != nil {
+			logging.Logger(ctx).Error("Unable to update budget", "err", err)
+			return model.Budget{}, sheetsError(err)
+		}
+		return budget, nil
+	}
+
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return model.Budget{}, err
+	}
+	var rowsToAdd [][]interface{}
+	if _, ok := sheetIDs[layout.BudgetSheet]; !ok {
+		if _, err := g.addSheet(ctx, sheetRef, layout.BudgetSheet); err != nil {
+			return model.Budget{}, err
+		}
+		rowsToAdd = append(rowsToAdd, []interface{}{"Category", "Cycle", "Amount", "Currency"})
+	}
+	rowsToAdd = append(rowsToAdd, values)
+
+	vr := &sheets.ValueRange{Values: rowsToAdd}
+	_, err = g.Service.Spreadsheets.Values.Append(sheetRef, layout.BudgetSheet+"!A:D", vr).
+		ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to add budget", "err", err)
+		return model.Budget{}, sheetsError(err)
+	}
+	return budget, nil
+}
+
+// DeleteBudget removes the budget of category for the cycle with id, or
+// for every cycle when id is empty.
+func (g *GoogleSheetsRepo) DeleteBudget(ctx context.Context, sheetRef, category, id string) error {
+	defer metrics.Track(g.Metrics, "DeleteBudget")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.DeleteBudget")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return err
+	}
+	rows, err := g.readBudgets(ctx, sheetRef, settings)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		if r.budget.Category != category || r.budget.Cycle != id {
+			continue
+		}
+		clearRange := fmt.Sprintf("%s!A%d:D%d", g.layout().BudgetSheet, r.row, r.row)
+		_, err := g.Service.Spreadsheets.Values.Clear(sheetRef, clearRange, &sheets.ClearValuesRequest{}).Context(ctx).Do()
+		if err != nil {
+			logging.Logger(ctx).Error("Unable to clear budget", "err", err)
+			return sheetsError(err)
+		}
+		return nil
+	}
+	return fmt.Errorf("budget for %s: %w", category, ErrNotFound)
+}
+
+// CycleProgress returns the progress of every category in the cycle with
+// id against its budget.
+func (g *GoogleSheetsRepo) CycleProgress(ctx context.Context, sheetRef, id string) ([]model.Progress, error) {
+	defer metrics.Track(g.Metrics, "CycleProgress")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.CycleProgress")
+	defer span.End()
+
+	progress, _, _, err := g.cycleProgress(ctx, sheetRef, id)
+	return progress, err
+}
+
+// CycleCircleAmounts returns what was spent in the cycle with id against
+// the budgets of every category.
+func (g *GoogleSheetsRepo) CycleCircleAmounts(ctx context.Context, sheetRef, id string) (model.CircleValues, error) {
+	defer metrics.Track(g.Metrics, "CycleCircleAmounts")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.CycleCircleAmounts")
+	defer span.End()
+
+	return g.circleValues(ctx, sheetRef, id)
+}
+
+// circleValues adds up the progress of the cycle with id.
+func (g *GoogleSheetsRepo) circleValues(ctx context.Context, sheetRef, id string) (model.CircleValues, error) {
+	progress, unconverted, settings, err := g.cycleProgress(ctx, sheetRef, id)
+	if err != nil {
+		return model.CircleValues{}, err
+	}
+	values := model.Summarize(progress, settings.currency)
+	values.Unconverted = unconverted
+	return values, nil
+}
+
+// cycleProgress adds up the transactions of the cycle with id by category,
+// in the user's currency, and compares them with the budgets of the cycle.
+// Budgets in another currency are converted at the rate of the day the
+// cycle starts. Transactions and budgets without a rate are left out, and
+// counted in unconverted.
+func (g *GoogleSheetsRepo) cycleProgress(ctx context.Context, sheetRef, id string) (progress []model.Progress, unconverted int, s settings, err error) {
+	cycle, err := g.Cycle(ctx, sheetRef, id)
+	if err != nil {
+		return nil, 0, settings{}, err
+	}
+	s, err = g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, 0, settings{}, err
+	}
+	transactions, err := g.cycleTransactions(ctx, sheetRef, cycle, s)
+	if err != nil {
+		return nil, 0, settings{}, err
+	}
+	totals := model.Sum(transactions, s.currency)
+	unconverted = len(totals.Unconverted)
+
+	rows, err := g.readBudgets(ctx, sheetRef, s)
+	if err != nil {
+		return nil, 0, settings{}, err
+	}
+	var budgets []model.Budget
+	for _, r := range rows {
+		budgets = append(budgets, r.budget)
+	}
+	amounts := model.ForCycle(budgets, cycle.ID)
+
+	var rates model.Rates
+	read := false
+	for category, amount := range amounts {
+		if amount.Currency == s.currency {
+			continue
+		}
+		if !read {
+			if rates, err = g.rates(ctx, sheetRef); err != nil {
+				return nil, 0, settings{}, err
+			}
+			read = true
+		}
+		converted, _, err := rates.Convert(amount, s.currency, cycle.Start)
+		if err != nil {
+			logging.Logger(ctx).Warn("leaving out budget", "category", category, "err", err)
+			delete(amounts, category)
+			unconverted++
+			continue
+		}
+		amounts[category] = converted
+	}
+
+	return model.Track(totals, amounts), unconverted, s, nil
+}
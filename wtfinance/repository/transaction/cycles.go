@@ -0,0 +1,548 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+// The cycle tab holds the schedule in its first row, as its kind and then
+// the day, the anchor or the dates, and below a header, one row for each
+// closed cycle: its start, its end and the tab its transactions were moved
+// to. The current cycle is not listed; it starts where the last closed one
+// ended, and its transactions are in the transaction tab.
+const (
+	scheduleRow = 1
+	headerRow   = 2
+)
+
+// now is replaced in tests.
+var now = time.Now
+
+// cycleSheet is what the cycle tab of a spreadsheet holds.
+type cycleSheet struct {
+	schedule model.Schedule
+	closed   []model.Cycle
+	// rows in use, including the schedule and the header
+	rows int
+}
+
+// readCycleSheet reads the cycle tab. A spreadsheet without one has the
+// default schedule and no closed cycles.
+func (g *GoogleSheetsRepo) readCycleSheet(ctx context.Context, sheetRef string, layout SheetLayout) (cycleSheet, error) {
+	sheet := cycleSheet{schedule: model.DefaultSchedule}
+
+	readRange := fmt.Sprintf("%s!A%d:C", layout.CycleSheet, scheduleRow)
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, readRange).Context(ctx).Do()
+	if missingSheet(err) {
+		return sheet, nil
+	}
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve budget cycles", "err", err)
+		return cycleSheet{}, sheetsError(err)
+	}
+
+	sheet.rows = len(resp.Values)
+	if len(resp.Values) > 0 && len(resp.Values[0]) > 1 {
+		sheet.schedule, err = parseSchedule(resp.Values[0][1:])
+		if err != nil {
+			return cycleSheet{}, fmt.Errorf("%w: schedule in %s: %v", ErrInvalid, layout.CycleSheet, err)
+		}
+	}
+
+	for i := headerRow; i < len(resp.Values); i++ {
+		cycle, err := parseCycleRow(resp.Values[i])
+		if err != nil {
+			logging.Logger(ctx).Warn("skipping budget cycle", "row", i+1, "err", err)
+			continue
+		}
+		sheet.closed = append(sheet.closed, cycle)
+	}
+	return sheet, nil
+}
+
+// cycles lists every cycle, the current one last. today, in the user's time
+// zone, is used to place the current cycle until one has been closed.
+func (c cycleSheet) cycles(layout SheetLayout, today time.Time) []model.Cycle {
+	start, _ := c.schedule.Bounds(today)
+	if len(c.closed) > 0 {
+		start = *c.closed[len(c.closed)-1].End
+	}
+
+	current := model.Cycle{
+		ID:      model.CycleID(start),
+		Start:   start,
+		Current: true,
+		Sheet:   layout.Sheet,
+	}
+	if _, end := c.schedule.Bounds(start); end.After(start) {
+		current.End = &end
+	}
+
+	return append(c.closed[:len(c.closed):len(c.closed)], current)
+}
+
+func scheduleCells(s model.Schedule) []string {
+	switch s.Kind {
+	case model.Biweekly:
+		return []string{s.Kind, model.CycleID(*s.Anchor)}
+	case model.Custom:
+		dates := make([]string, len(s.Dates))
+		for i, d := range s.Dates {
+			dates[i] = model.CycleID(d)
+		}
+		return []string{s.Kind, strings.Join(dates, " ")}
+	default:
+		return []string{s.Kind, strconv.Itoa(s.Day)}
+	}
+}
+
+func parseSchedule(cells []interface{}) (model.Schedule, error) {
+	s := model.Schedule{Kind: fmt.Sprintf("%v", cells[0])}
+	var arg string
+	if len(cells) > 1 {
+		arg = strings.TrimSpace(fmt.Sprintf("%v", cells[1]))
+	}
+
+	switch s.Kind {
+	case model.Monthly:
+		day, err := strconv.Atoi(arg)
+		if err != nil || day < 1 || day > 31 {
+			return model.Schedule{}, fmt.Errorf("bad day of the month %q", arg)
+		}
+		s.Day = day
+	case model.Biweekly:
+		anchor, err := time.Parse(time.DateOnly, arg)
+		if err != nil {
+			return model.Schedule{}, fmt.Errorf("bad anchor %q", arg)
+		}
+		s.Anchor = &anchor
+	case model.Custom:
+		for _, field := range strings.Fields(arg) {
+			date, err := time.Parse(time.DateOnly, field)
+			if err != nil {
+				return model.Schedule{}, fmt.Errorf("bad date %q", field)
+			}
+			s.Dates = append(s.Dates, date)
+		}
+		if len(s.Dates) == 0 {
+			return model.Schedule{}, errors.New("no dates")
+		}
+	default:
+		return model.Schedule{}, fmt.Errorf("unknown kind %q", s.Kind)
+	}
+	return s, nil
+}
+
+func parseCycleRow(row []interface{}) (model.Cycle, error) {
+	if len(row) < 3 {
+		return model.Cycle{}, fmt.Errorf("row has %d of 3 columns", len(row))
+	}
+	start, err := time.Parse(time.DateOnly, fmt.Sprintf("%v", row[0]))
+	if err != nil {
+		return model.Cycle{}, fmt.Errorf("bad start %v", row[0])
+	}
+	end, err := time.Parse(time.DateOnly, fmt.Sprintf("%v", row[1]))
+	if err != nil {
+		return model.Cycle{}, fmt.Errorf("bad end %v", row[1])
+	}
+	return model.Cycle{
+		ID:    model.CycleID(start),
+		Start: start,
+		End:   &end,
+		Sheet: fmt.Sprintf("%v", row[2]),
+	}, nil
+}
+
+func stringCells(values ...string) *sheets.RowData {
+	row := &sheets.RowData{}
+	for _, v := range values {
+		v := v
+		row.Values = append(row.Values, &sheets.CellData{
+			UserEnteredValue: &sheets.ExtendedValue{StringValue: &v},
+		})
+	}
+	return row
+}
+
+// Schedule returns when the budget cycles of sheetRef start.
+func (g *GoogleSheetsRepo) Schedule(ctx context.Context, sheetRef string) (model.Schedule, error) {
+	defer metrics.Track(g.Metrics, "Schedule")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Schedule")
+	defer span.End()
+
+	sheet, err := g.readCycleSheet(ctx, sheetRef, g.layout())
+	if err != nil {
+		return model.Schedule{}, err
+	}
+	return sheet.schedule, nil
+}
+
+// SetSchedule changes when the budget cycles of sheetRef start. Closed
+// cycles keep their dates, and the current one keeps its start.
+func (g *GoogleSheetsRepo) SetSchedule(ctx context.Context, sheetRef string, schedule model.Schedule) error {
+	defer metrics.Track(g.Metrics, "SetSchedule")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.SetSchedule")
+	defer span.End()
+
+	layout := g.layout()
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return err
+	}
+	if _, ok := sheetIDs[layout.CycleSheet]; !ok {
+		if _, err := g.addSheet(ctx, sheetRef, layout.CycleSheet); err != nil {
+			return err
+		}
+	}
+
+	cells := scheduleCells(schedule)
+	vr := &sheets.ValueRange{
+		Values: [][]interface{}{
+			{"Schedule", cells[0], cells[1]},
+			{"Start", "End", "Sheet"},
+		},
+	}
+	writeRange := fmt.Sprintf("%s!A%d:C%d", layout.CycleSheet, scheduleRow, headerRow)
+	_, err = g.Service.Spreadsheets.Values.Update(sheetRef, writeRange, vr).ValueInputOption("RAW").Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to update the budget cycle schedule", "err", err)
+		return sheetsError(err)
+	}
+	return nil
+}
+
+// addSheet adds a tab named title to sheetRef, and returns its ID.
+func (g *GoogleSheetsRepo) addSheet(ctx context.Context, sheetRef, title string) (int64, error) {
+	req := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			AddSheet: &sheets.AddSheetRequest{
+				Properties: &sheets.SheetProperties{Title: title},
+			},
+		}},
+	}
+	resp, err := g.Service.Spreadsheets.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to add sheet", "sheet", title, "err", err)
+		return 0, sheetsError(err)
+	}
+	if len(resp.Replies) == 0 || resp.Replies[0].AddSheet == nil {
+		return 0, nil
+	}
+	return resp.Replies[0].AddSheet.Properties.SheetId, nil
+}
+
+// Cycles lists the budget cycles of sheetRef, oldest first, ending with the
+// current one.
+func (g *GoogleSheetsRepo) Cycles(ctx context.Context, sheetRef string) ([]model.Cycle, error) {
+	defer metrics.Track(g.Metrics, "Cycles")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Cycles")
+	defer span.End()
+
+	layout := g.layout()
+	sheet, err := g.readCycleSheet(ctx, sheetRef, layout)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	return sheet.cycles(layout, now().In(settings.loc)), nil
+}
+
+// Cycle returns the cycle with id, which may also be "current".
+func (g *GoogleSheetsRepo) Cycle(ctx context.Context, sheetRef, id string) (model.Cycle, error) {
+	cycles, err := g.Cycles(ctx, sheetRef)
+	if err != nil {
+		return model.Cycle{}, err
+	}
+
+	for _, cycle := range cycles {
+		if cycle.ID == id || (id == "current" && cycle.Current) {
+			return cycle, nil
+		}
+	}
+	return model.Cycle{}, fmt.Errorf("budget cycle %s: %w", id, ErrNotFound)
+}
+
+// CycleTransactions returns every transaction dated in the cycle with id.
+func (g *GoogleSheetsRepo) CycleTransactions(ctx context.Context, sheetRef, id string) ([]model.Transaction, error) {
+	defer metrics.Track(g.Metrics, "CycleTransactions")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.CycleTransactions")
+	defer span.End()
+
+	cycle, err := g.Cycle(ctx, sheetRef, id)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	return g.cycleTransactions(ctx, sheetRef, cycle, settings)
+}
+
+func (g *GoogleSheetsRepo) cycleTransactions(ctx context.Context, sheetRef string, cycle model.Cycle, s settings) ([]model.Transaction, error) {
+	asOf := *localDay(nil, s.loc)
+	if !cycle.Current {
+		asOf = lastDay(cycle, s.loc)
+	}
+
+	layout := g.layout()
+	layout.Sheet = cycle.Sheet
+	found, err := g.fetchTransactions(ctx, sheetRef, layout, asOf, s)
+	if err != nil {
+		return nil, err
+	}
+
+	// rows dated outside the cycle, like the history a spreadsheet held
+	// before its first cycle was closed, belong to none. The current cycle
+	// lasts until it is closed, so it keeps days after its scheduled end.
+	within := cycle
+	if cycle.Current {
+		within.End = nil
+	}
+	transactions := []model.Transaction{}
+	for _, t := range found {
+		if within.Holds(*t.DateCreated) {
+			transactions = append(transactions, t)
+		}
+	}
+	return transactions, nil
+}
+
+// lastDay is the last day of cycle, which is closed, as midnight in loc. A
+// closed cycle holds nothing after it.
+func lastDay(cycle model.Cycle, loc *time.Location) time.Time {
+	last := cycle.End.AddDate(0, 0, -1)
+	return startOfDay(last.Year(), last.Month(), last.Day(), loc)
+}
+
+// CycleTotals sums the transactions of the cycle with id, in the user's
+// currency. Those in another that cannot be converted are listed instead.
+func (g *GoogleSheetsRepo) CycleTotals(ctx context.Context, sheetRef, id string) (model.Totals, error) {
+	defer metrics.Track(g.Metrics, "CycleTotals")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.CycleTotals")
+	defer span.End()
+
+	cycle, err := g.Cycle(ctx, sheetRef, id)
+	if err != nil {
+		return model.Totals{}, err
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Totals{}, err
+	}
+	transactions, err := g.cycleTransactions(ctx, sheetRef, cycle, settings)
+	if err != nil {
+		return model.Totals{}, err
+	}
+
+	return model.Sum(transactions, settings.currency), nil
+}
+
+// CloseCycle archives the current cycle and starts the next one. The
+// transaction tab is copied to a new tab named after it, with its circle
+// values. The copy keeps the transactions dated before the cycle's end, and
+// the transaction tab those dated after, so a cycle closed late hands the
+// days past its end to the next one. All of it is one update, so a cycle
+// is never half closed.
+//
+// The cycle ends when the schedule says, even when it is closed early or
+// late, so the next one starts on time. A cycle of a custom schedule with
+// no later date ends the day it is closed.
+func (g *GoogleSheetsRepo) CloseCycle(ctx context.Context, sheetRef string) (closed, current model.Cycle, err error) {
+	defer metrics.Track(g.Metrics, "CloseCycle")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.CloseCycle")
+	defer span.End()
+
+	layout := g.layout()
+	sheet, err := g.readCycleSheet(ctx, sheetRef, layout)
+	if err != nil {
+		return model.Cycle{}, model.Cycle{}, err
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Cycle{}, model.Cycle{}, err
+	}
+	today := now().In(settings.loc)
+	cycles := sheet.cycles(layout, today)
+
+	closed = cycles[len(cycles)-1]
+	closed.Current = false
+	if closed.End == nil {
+		end := model.Day(today)
+		if !end.After(closed.Start) {
+			end = closed.Start.AddDate(0, 0, 1)
+		}
+		closed.End = &end
+	}
+	closed.Sheet = fmt.Sprintf("%s %s", layout.Sheet, closed.ID)
+
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return model.Cycle{}, model.Cycle{}, err
+	}
+	transactionSheet, ok := sheetIDs[layout.Sheet]
+	if !ok {
+		return model.Cycle{}, model.Cycle{}, fmt.Errorf("sheet %s: %w", layout.Sheet, ErrNotFound)
+	}
+	if _, ok := sheetIDs[closed.Sheet]; ok {
+		return model.Cycle{}, model.Cycle{}, fmt.Errorf("budget cycle %s is already closed: %w", closed.ID, ErrConflict)
+	}
+	sheetCount := len(sheetIDs)
+	// the copy is given an ID up front, so the rows it keeps can be
+	// cleared in the same update
+	var archiveSheet int64
+	for _, id := range sheetIDs {
+		archiveSheet = max(archiveSheet, id+1)
+	}
+	cycleSheetID, ok := sheetIDs[layout.CycleSheet]
+	if !ok {
+		cycleSheetID, err = g.addSheet(ctx, sheetRef, layout.CycleSheet)
+		if err != nil {
+			return model.Cycle{}, model.Cycle{}, err
+		}
+		sheetCount++
+	}
+
+	// a new or empty cycle tab needs its schedule and header first
+	var rows []*sheets.RowData
+	firstRow := sheet.rows
+	if sheet.rows < headerRow {
+		rows = append(rows,
+			stringCells(append([]string{"Schedule"}, scheduleCells(sheet.schedule)...)...),
+			stringCells("Start", "End", "Sheet"),
+		)
+		firstRow = 0
+	}
+	rows = append(rows, stringCells(closed.ID, model.CycleID(*closed.End), closed.Sheet))
+
+	later, err := g.rowsFrom(ctx, sheetRef, layout, *closed.End, *localDay(nil, settings.loc))
+	if err != nil {
+		return model.Cycle{}, model.Cycle{}, err
+	}
+	earlier := make([]bool, len(later))
+	for i := range later {
+		earlier[i] = !later[i]
+	}
+
+	req := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{
+			{
+				DuplicateSheet: &sheets.DuplicateSheetRequest{
+					SourceSheetId:    transactionSheet,
+					NewSheetId:       archiveSheet,
+					NewSheetName:     closed.Sheet,
+					InsertSheetIndex: int64(sheetCount),
+				},
+			},
+			{
+				UpdateCells: &sheets.UpdateCellsRequest{
+					Start: &sheets.GridCoordinate{
+						SheetId:  cycleSheetID,
+						RowIndex: int64(firstRow),
+					},
+					Rows:   rows,
+					Fields: "userEnteredValue",
+				},
+			},
+		},
+	}
+	req.Requests = append(req.Requests, clearRows(archiveSheet, layout, later)...)
+	req.Requests = append(req.Requests, clearRows(transactionSheet, layout, earlier)...)
+	_, err = g.Service.Spreadsheets.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "already exists") {
+		// closed by another request since the tabs were listed
+		return model.Cycle{}, model.Cycle{}, fmt.Errorf("budget cycle %s is already closed: %w", closed.ID, ErrConflict)
+	}
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to close the budget cycle", "err", err)
+		return model.Cycle{}, model.Cycle{}, sheetsError(err)
+	}
+
+	sheet.closed = append(sheet.closed, closed)
+	cycles = sheet.cycles(layout, today)
+	logging.Logger(ctx).Info("closed budget cycle", "cycle", closed.ID, "sheet", closed.Sheet)
+	return closed, cycles[len(cycles)-1], nil
+}
+
+// rowsFrom reports, for each row of the tab of layout from its first
+// transaction, whether it holds a transaction dated on or after day. Rows
+// without a date, empty or not, are before it. asOf places dates without a
+// year, as parseRow does.
+func (g *GoogleSheetsRepo) rowsFrom(ctx context.Context, sheetRef string, layout SheetLayout, day, asOf time.Time) ([]bool, error) {
+	readRange := fmt.Sprintf("%s!A%d:A", layout.Sheet, layout.FirstRow)
+	resp, err := readDates(g.Service.Spreadsheets.Values.Get(sheetRef, readRange)).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve transaction dates", "err", err)
+		return nil, sheetsError(err)
+	}
+
+	from := make([]bool, len(resp.Values))
+	for i, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		if date, _, err := parseDate(row[0], asOf); err == nil {
+			from[i] = !model.Day(date).Before(day)
+		}
+	}
+	return from, nil
+}
+
+// clearRows returns the requests clearing the transactions in the rows of
+// the tab with sheetID, from its first transaction, that are set in rows.
+// Each run of rows is cleared by one request.
+func clearRows(sheetID int64, layout SheetLayout, rows []bool) []*sheets.Request {
+	var reqs []*sheets.Request
+	for i := 0; i < len(rows); i++ {
+		if !rows[i] {
+			continue
+		}
+		end := i
+		for end < len(rows) && rows[end] {
+			end++
+		}
+		// without rows, the values in the range are cleared
+		reqs = append(reqs, &sheets.Request{
+			UpdateCells: &sheets.UpdateCellsRequest{
+				Range: &sheets.GridRange{
+					SheetId:          sheetID,
+					StartRowIndex:    int64(layout.FirstRow - 1 + i),
+					EndRowIndex:      int64(layout.FirstRow - 1 + end),
+					StartColumnIndex: 0,
+					EndColumnIndex:   columnCount,
+				},
+				Fields: "userEnteredValue",
+			},
+		})
+		i = end
+	}
+	return reqs
+}
+
+// tab returns layout with the tab a transaction dated day is written to:
+// that of the closed cycle holding day, so a transaction backdated into a
+// closed cycle is counted in it, or else the transaction tab.
+func (c cycleSheet) tab(layout SheetLayout, day time.Time) SheetLayout {
+	for _, cycle := range c.closed {
+		if cycle.Holds(day) {
+			layout.Sheet = cycle.Sheet
+			break
+		}
+	}
+	return layout
+}
@@ -0,0 +1,190 @@
+package transaction
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func transactionRow(day, name string, amount float64, id string) []interface{} {
+	return []interface{}{serial(day), name, "Home", amount, id, "USD", "expense"}
+}
+
+func TestCycleTransactionsAreDatedInTheCycle(t *testing.T) {
+	header := [][]interface{}{{"Date", "Name"}, {}}
+	closedCycles := [][]interface{}{
+		{"Schedule", "monthly", "1"},
+		{"Start", "End", "Sheet"},
+		{"2024-04-01", "2024-05-01", "Sheet1 2024-04-01"},
+	}
+
+	tests := []struct {
+		name  string
+		today string
+		tabs  map[string][][]interface{}
+		cycle string
+		want  []string
+	}{
+		{
+			name:  "no cycle closed yet",
+			today: "2024-05-20",
+			tabs: map[string][][]interface{}{
+				"Sheet1": append(header,
+					transactionRow("2024-03-31", "March", 10, "m1"),
+					transactionRow("2024-04-30", "April", 20, "a1"),
+					transactionRow("2024-05-01", "May", 30, "y1"),
+					transactionRow("2024-05-20", "Today", 40, "y2"),
+				),
+			},
+			cycle: "current",
+			want:  []string{"y1", "y2"},
+		},
+		{
+			name:  "closed cycle holding the history before it",
+			today: "2024-05-20",
+			tabs: map[string][][]interface{}{
+				"Cycles": closedCycles,
+				"Sheet1": append(header, transactionRow("2024-05-02", "May", 30, "y1")),
+				"Sheet1 2024-04-01": append(header,
+					transactionRow("2024-03-31", "March", 10, "m1"),
+					transactionRow("2024-04-30", "April", 20, "a1"),
+				),
+			},
+			cycle: "2024-04-01",
+			want:  []string{"a1"},
+		},
+		{
+			name:  "current cycle past its scheduled end",
+			today: "2024-06-03",
+			tabs: map[string][][]interface{}{
+				"Cycles": closedCycles,
+				"Sheet1": append(header,
+					transactionRow("2024-04-30", "April", 20, "a1"),
+					transactionRow("2024-05-31", "May", 30, "y1"),
+					transactionRow("2024-06-02", "June", 40, "j1"),
+				),
+				"Sheet1 2024-04-01": header,
+			},
+			cycle: "current",
+			want:  []string{"y1", "j1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := newFakeSheets(t, tt.today, tt.tabs)
+			ctx := context.Background()
+
+			transactions, err := repo.CycleTransactions(ctx, testSheet, tt.cycle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, tr := range transactions {
+				ids = append(ids, tr.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+
+			totals, err := repo.CycleTotals(ctx, testSheet, tt.cycle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if totals.Count != len(tt.want) {
+				t.Errorf("totals count %d transactions, want %d", totals.Count, len(tt.want))
+			}
+
+			if tt.cycle == "current" {
+				current, err := repo.FetchTransactions(ctx, testSheet)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(current) != len(tt.want) {
+					t.Errorf("FetchTransactions returned %d transactions, want %d", len(current), len(tt.want))
+				}
+			}
+		})
+	}
+}
+
+func TestCloseCycleLate(t *testing.T) {
+	repo, _ := newFakeSheets(t, "2024-06-03", map[string][][]interface{}{
+		"Sheet1": {
+			{"Date", "Name"}, {},
+			transactionRow("2024-05-31", "May", 30, "y1"),
+			transactionRow("2024-06-02", "June", 40, "j1"),
+		},
+		"Cycles": {
+			{"Schedule", "monthly", "1"},
+			{"Start", "End", "Sheet"},
+			{"2024-04-01", "2024-05-01", "Sheet1 2024-04-01"},
+		},
+		"Sheet1 2024-04-01": {{"Date", "Name"}, {}},
+	})
+	ctx := context.Background()
+
+	closed, current, err := repo.CloseCycle(ctx, testSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.ID != "2024-05-01" || current.ID != "2024-06-01" {
+		t.Fatalf("closed %s and started %s, want 2024-05-01 and 2024-06-01", closed.ID, current.ID)
+	}
+
+	ids := func(cycle string) []string {
+		t.Helper()
+		transactions, err := repo.CycleTransactions(ctx, testSheet, cycle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, tr := range transactions {
+			ids = append(ids, tr.ID)
+		}
+		return ids
+	}
+	if got := ids("2024-05-01"); !slices.Equal(got, []string{"y1"}) {
+		t.Errorf("closed cycle holds %v, want [y1]", got)
+	}
+	if got := ids("current"); !slices.Equal(got, []string{"j1"}) {
+		t.Errorf("current cycle holds %v, want [j1]", got)
+	}
+
+	// a transaction backdated into the closed cycle is written to its tab,
+	// and can be read, moved and deleted there
+	day := time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC)
+	backdated, err := repo.Insert(ctx, model.Transaction{
+		DateCreated: &day, Name: "Late bill", Category: "Home", Amount: model.Money{Minor: 1000, Currency: "USD"}, Type: model.Expense,
+	}, testSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids("2024-05-01"); !slices.Equal(got, []string{"y1", backdated.ID}) {
+		t.Errorf("closed cycle holds %v, want [y1 %s]", got, backdated.ID)
+	}
+	if _, err := repo.FetchTransaction(ctx, testSheet, backdated.ID); err != nil {
+		t.Errorf("fetching the backdated transaction: %v", err)
+	}
+
+	moved := time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC)
+	backdated.DateCreated = &moved
+	if _, err := repo.Update(ctx, backdated, testSheet); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids("2024-05-01"); !slices.Equal(got, []string{"y1"}) {
+		t.Errorf("closed cycle holds %v after the move, want [y1]", got)
+	}
+	if got := ids("current"); !slices.Equal(got, []string{"j1", backdated.ID}) {
+		t.Errorf("current cycle holds %v after the move, want [j1 %s]", got, backdated.ID)
+	}
+
+	if err := repo.Delete(ctx, testSheet, "y1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids("2024-05-01"); len(got) != 0 {
+		t.Errorf("closed cycle holds %v after deleting y1, want none", got)
+	}
+}
@@ -0,0 +1,96 @@
+package transaction
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Dates are written as 2006-01-02, which Sheets takes as a date in any
+// locale, and read back as serial numbers, the days since sheetsEpoch, so
+// how the spreadsheet displays them does not matter. A transaction's date
+// is the day it happened on in the user's time zone, which is the time zone
+// of their spreadsheet.
+
+// sheetsEpoch is day 0 of Sheets' serial dates.
+var sheetsEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// readDates sets the options rows holding dates are read with. Amounts are
+// read as numbers too.
+func readDates(call *sheets.SpreadsheetsValuesGetCall) *sheets.SpreadsheetsValuesGetCall {
+	return call.ValueRenderOption("UNFORMATTED_VALUE").DateTimeRenderOption("SERIAL_NUMBER")
+}
+
+// localDay is midnight of the day t falls on in loc, or of today when t is
+// nil.
+func localDay(t *time.Time, loc *time.Location) *time.Time {
+	day := now()
+	if t != nil {
+		day = *t
+	}
+	y, m, d := day.In(loc).Date()
+	local := startOfDay(y, m, d, loc)
+	return &local
+}
+
+// calendarDay is midnight in loc of the date t is written as, wherever it
+// is. Dates read from a bank statement are days, not instants, so they are
+// kept as they are rather than moved into the user's time zone.
+func calendarDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.Date()
+	return startOfDay(y, m, d, loc)
+}
+
+// startOfDay is midnight of y-m-d in loc. Where clocks move forward at
+// midnight, the day starts at the change instead: time.Date would put the
+// missing midnight at 11pm the day before.
+func startOfDay(y int, m time.Month, d int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	if t.Day() != d && t.Hour() != 0 {
+		_, t = t.ZoneBounds()
+	}
+	return t
+}
+
+// parseDate reads the date cell of a row, as midnight in the location of
+// asOf. Cells Sheets did not take as a date are read as text. Rows written
+// before dates had a year are M/D, and are placed in the latest year that
+// puts them on or before asOf; legacy reports whether the cell was one of
+// those.
+func parseDate(cell interface{}, asOf time.Time) (date time.Time, legacy bool, err error) {
+	loc := asOf.Location()
+
+	var y, d int
+	var m time.Month
+	switch v := cell.(type) {
+	case float64:
+		y, m, d = sheetsEpoch.AddDate(0, 0, int(math.Floor(v))).Date()
+	case string:
+		if t, err := time.Parse(time.DateOnly, v); err == nil {
+			y, m, d = t.Date()
+			break
+		}
+		if t, err := time.Parse("1/2/2006", v); err == nil {
+			y, m, d = t.Date()
+			break
+		}
+		t, err := time.Parse("1/2", v)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		_, m, d = t.Date()
+		for y = asOf.Year(); ; y-- {
+			date := startOfDay(y, m, d, loc)
+			// a 2/29 is only a date in leap years
+			if !date.After(asOf) && date.Day() == d {
+				break
+			}
+		}
+		legacy = true
+	default:
+		return time.Time{}, false, fmt.Errorf("%v is not a date", cell)
+	}
+	return startOfDay(y, m, d, loc), legacy, nil
+}
@@ -0,0 +1,116 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(value string) time.Time {
+		d, err := time.ParseInLocation(time.DateOnly, value, toronto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	tests := []struct {
+		name   string
+		cell   interface{}
+		asOf   time.Time
+		want   string
+		legacy bool
+	}{
+		{"serial", float64(45413), at("2024-06-01"), "2024-05-01", false},
+		{"serial with a time", 45413.75, at("2024-06-01"), "2024-05-01", false},
+		{"text", "2024-05-01", at("2024-06-01"), "2024-05-01", false},
+		{"text with a year", "5/1/2024", at("2024-06-01"), "2024-05-01", false},
+		{"legacy earlier this year", "5/1", at("2024-06-01"), "2024-05-01", true},
+		{"legacy today", "12/31", at("2024-12-31"), "2024-12-31", true},
+		{"legacy in late December, read in January", "12/30", at("2025-01-02"), "2024-12-30", true},
+		{"legacy in January, read on New Year's Eve", "1/2", at("2024-12-31"), "2024-01-02", true},
+		{"legacy tomorrow is last year's", "12/31", at("2024-12-30"), "2023-12-31", true},
+		// late on New Year's Eve in Toronto it is already January in UTC
+		{"legacy on New Year's Eve, late at night", "12/31", time.Date(2025, time.January, 1, 4, 0, 0, 0, time.UTC).In(toronto), "2024-12-31", true},
+		{"legacy leap day in a leap year", "2/29", at("2024-03-01"), "2024-02-29", true},
+		{"legacy leap day in a later year", "2/29", at("2025-03-15"), "2024-02-29", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, legacy, err := parseDate(tt.cell, tt.asOf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format(time.DateOnly) != tt.want || got.Location() != toronto || !got.Equal(at(tt.want)) {
+				t.Errorf("got %v, want midnight of %s in Toronto", got, tt.want)
+			}
+			if legacy != tt.legacy {
+				t.Errorf("got legacy %v, want %v", legacy, tt.legacy)
+			}
+		})
+	}
+
+	for _, cell := range []interface{}{"May 1", "13/1", true, nil} {
+		if _, _, err := parseDate(cell, at("2024-06-01")); err == nil {
+			t.Errorf("read %#v as a date", cell)
+		}
+	}
+}
+
+func TestLocalDayAcrossDaylightSavingTime(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Havana moves its clocks at midnight, so some days start at 1am
+	havana, err := time.LoadLocation("America/Havana")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		loc  *time.Location
+		want string
+	}{
+		// Toronto moved from EST to EDT at 2am on 2024-03-10, 07:00 UTC
+		{"just before the spring change", time.Date(2024, time.March, 10, 6, 59, 0, 0, time.UTC), toronto, "2024-03-10"},
+		{"just after the spring change", time.Date(2024, time.March, 10, 7, 0, 0, 0, time.UTC), toronto, "2024-03-10"},
+		{"the evening before the spring change", time.Date(2024, time.March, 10, 4, 59, 0, 0, time.UTC), toronto, "2024-03-09"},
+		// and back at 2am on 2024-11-03, 06:00 UTC, so midnight was EDT
+		{"midnight before the fall change", time.Date(2024, time.November, 3, 4, 0, 0, 0, time.UTC), toronto, "2024-11-03"},
+		{"a minute before that midnight", time.Date(2024, time.November, 3, 3, 59, 0, 0, time.UTC), toronto, "2024-11-02"},
+		{"the evening after the fall change", time.Date(2024, time.November, 4, 4, 30, 0, 0, time.UTC), toronto, "2024-11-03"},
+		// Havana skipped from midnight to 1am on 2024-03-10
+		{"a day without a midnight", time.Date(2024, time.March, 10, 5, 30, 0, 0, time.UTC), havana, "2024-03-10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := localDay(&tt.t, tt.loc)
+			if got.Format(time.DateOnly) != tt.want || got.Location() != tt.loc {
+				t.Errorf("got %v, want %s in %s", got, tt.want, tt.loc)
+			}
+			if got.In(tt.loc).Hour() > 1 || got.After(tt.t) {
+				t.Errorf("got %v, want the start of the day %v falls on", got, tt.t)
+			}
+			// a day read back from the sheet is the same day
+			if read, _, err := parseDate(got.Format(time.DateOnly), *got); err != nil || !read.Equal(*got) {
+				t.Errorf("read back as %v, %v", read, err)
+			}
+		})
+	}
+
+	// a statement's day is kept as written, whatever its time zone
+	written := time.Date(2024, time.November, 3, 0, 0, 0, 0, time.UTC)
+	if got := calendarDay(written, toronto); got.Format(time.DateOnly) != "2024-11-03" || got.Location() != toronto {
+		t.Errorf("got %v, want 2024-11-03 in Toronto", got)
+	}
+	if got := calendarDay(written.In(toronto), time.UTC); got.Format(time.DateOnly) != "2024-11-02" {
+		t.Errorf("got %v, want the day the time is written on in Toronto", got)
+	}
+}
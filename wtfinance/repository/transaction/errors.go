@@ -0,0 +1,57 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Errors returned by the repository wrap one of these, so callers can tell
+// what went wrong with errors.Is.
+var (
+	// ErrNotFound is returned when the spreadsheet or range asked for does not
+	// exist, or has not been shared with the service.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write clashes with the spreadsheet.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid is returned when the arguments cannot be used as given.
+	ErrInvalid = errors.New("invalid")
+	// ErrUnavailable is returned when Google Sheets cannot be reached in time.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// sheetsError turns an error returned by the Sheets API into the repository
+// error it amounts to, keeping only the message of the API error so it can
+// be shown to clients. Errors without an equivalent are returned as they are.
+func sheetsError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	var kind error
+	switch {
+	// the API answers forbidden for spreadsheets not shared with the service
+	case apiErr.Code == http.StatusNotFound, apiErr.Code == http.StatusForbidden:
+		kind = ErrNotFound
+	case apiErr.Code == http.StatusConflict:
+		kind = ErrConflict
+	case apiErr.Code == http.StatusBadRequest:
+		kind = ErrInvalid
+	case apiErr.Code == http.StatusTooManyRequests, apiErr.Code >= http.StatusInternalServerError:
+		kind = ErrUnavailable
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %s", kind, apiErr.Message)
+}
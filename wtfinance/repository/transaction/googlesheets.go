@@ -2,146 +2,718 @@ package transaction
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
-	"strconv"
-	"strings"
+	"net/http"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
 	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/sheets/v4"
 )
 
 type GoogleSheetsRepo struct {
 	Service *sheets.Service
+	// optional, nothing is recorded when nil
+	Metrics metrics.Recorder
+	// DefaultLayout is used when not set
+	Layout SheetLayout
+	// the currency of users who have not chosen one, USD when empty
+	Currency string
+	// exchange rates every user can convert with
+	ServerRates model.Rates
+
+	// spreadsheets whose ID column has been hidden
+	hidden sync.Map
 }
 
-func (g *GoogleSheetsRepo) Insert(ctx context.Context, transaction model.Transaction, sheetRef string) error {
+// SheetLayout is where transactions are kept in each spreadsheet.
+type SheetLayout struct {
+	// name of the tab holding transactions
+	Sheet string
+	// first row holding a transaction, below the headers
+	FirstRow int
+	// name of the tab holding the cycle schedule and the closed cycles
+	CycleSheet string
+	// name of the tab holding the exchange rates the user entered
+	RateSheet string
+	// name of the tab holding the budget of each category
+	BudgetSheet string
+	// name of the tab holding how each bank lays out its CSV statements
+	MappingSheet string
+	// name of the tab holding recurring transactions
+	SubscriptionSheet string
+	// name of the tab holding the rules categorizing transactions
+	RuleSheet string
+}
 
-	columnRange := "Sheet1!A3:A"
+var DefaultLayout = SheetLayout{
+	Sheet:             "Sheet1",
+	FirstRow:          3,
+	CycleSheet:        "Cycles",
+	RateSheet:         "Rates",
+	BudgetSheet:       "Budgets",
+	MappingSheet:      "Mappings",
+	SubscriptionSheet: "Subscriptions",
+	RuleSheet:         "Rules",
+}
 
-	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, columnRange).Do()
-	if err != nil {
-		log.Printf("Unable to retrieve data from column: %v", err)
+func (g *GoogleSheetsRepo) layout() SheetLayout {
+	if g.Layout == (SheetLayout{}) {
+		return DefaultLayout
+	}
+	return g.Layout
+}
+
+// Ping fetches the ID of sheetRef, the smallest piece of metadata the Sheets
+// API returns, to check it can be reached with the service's credentials.
+// Without a sheetRef a spreadsheet that cannot exist is asked for instead: a
+// not found response still shows the credentials were accepted.
+func (g *GoogleSheetsRepo) Ping(ctx context.Context, sheetRef string) error {
+	defer metrics.Track(g.Metrics, "Ping")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Ping")
+	defer span.End()
+
+	if sheetRef == "" {
+		_, err := g.Service.Spreadsheets.Get("wtfinance-readiness-probe").Fields("spreadsheetId").Context(ctx).Do()
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil
+		}
 		return err
 	}
-	nextEmptyRow := len(resp.Values) + 3
 
-	values := [][]interface{}{
-		{
-			transaction.DateCreated.Format("1/2"),
-			transaction.Name,
-			transaction.Category,
-			transaction.Amount,
-		},
+	_, err := g.Service.Spreadsheets.Get(sheetRef).Fields("spreadsheetId").Context(ctx).Do()
+	return sheetsError(err)
+}
+
+// Transactions are kept one to a row: date, name, category and amount in
+// columns A to D, the ID in column E, which is hidden once the first
+// transaction has been written, the currency in column F, the type in G,
+// the expense a refund is for in H and, for a transaction imported from a
+// bank statement or posted for a subscription, its import ID in I. A
+// transaction in another currency than the user's has its conversion in J
+// to N. Deleting a transaction clears its row rather than removing it, so
+// the rows of other transactions never move.
+const (
+	lastColumn           = "N"
+	columnCount          = 14
+	idColumnIndex        = 4
+	currencyColumnIndex  = 5
+	typeColumnIndex      = 6
+	refundColumnIndex    = 7
+	importColumnIndex    = 8
+	convertedColumnIndex = 9
+)
+
+// rowRange is the A1 range of the transaction in row.
+func (l SheetLayout) rowRange(row int) string {
+	return fmt.Sprintf("%s!A%d:%s%d", l.Sheet, row, lastColumn, row)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// toRow is the row of transaction, written with USER_ENTERED so the date
+// is taken as one. The amount is written as a number, which Sheets keeps as
+// it is in any locale.
+func toRow(transaction model.Transaction) []interface{} {
+	row := []interface{}{
+		transaction.DateCreated.Format(time.DateOnly),
+		transaction.Name,
+		transaction.Category,
+		transaction.Amount.Float(),
+		textCell(transaction.ID),
+		transaction.Amount.Currency,
+		transaction.Type,
+		textCell(transaction.RefundOf),
+		textCell(transaction.ImportID),
+	}
+	return append(row, conversionCells(transaction.Converted)...)
+}
+
+// textCell keeps a USER_ENTERED value as text, so an ID of digits is not
+// turned into a number.
+func textCell(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "'" + value
+}
+
+// stale is what a row written by hand, or by an older version, lacks.
+type stale struct {
+	// the date has no year
+	date bool
+	// there is no currency, so it is the user's
+	currency bool
+}
+
+// parseRow reads a transaction back from its row, read with readDates.
+// Rows written by hand may not have an ID yet, and old rows may have a date
+// without a year, which is placed on or before asOf, and no currency. Rows
+// without a type are expenses, or refunds when their amount is negative,
+// which is how money coming back was entered before there were types.
+func parseRow(row []interface{}, asOf time.Time, s settings) (model.Transaction, stale, error) {
+	if len(row) < 4 {
+		return model.Transaction{}, stale{}, fmt.Errorf("row has %d of 4 columns", len(row))
+	}
+
+	var old stale
+	currency := s.currency
+	if len(row) > currencyColumnIndex && model.ValidCurrency(fmt.Sprintf("%v", row[currencyColumnIndex])) {
+		currency = fmt.Sprintf("%v", row[currencyColumnIndex])
+	} else {
+		old.currency = true
+	}
+	amount, err := parseAmount(row[3], currency, s.decimal)
+	if err != nil {
+		return model.Transaction{}, stale{}, fmt.Errorf("bad value %v for field amount: %w", row[3], err)
+	}
+	date, legacyDate, err := parseDate(row[0], asOf)
+	if err != nil {
+		return model.Transaction{}, stale{}, fmt.Errorf("bad value %v for field date: %w", row[0], err)
+	}
+	old.date = legacyDate
+
+	transaction := model.Transaction{
+		DateCreated: &date,
+		Name:        fmt.Sprintf("%v", row[1]),
+		Category:    fmt.Sprintf("%v", row[2]),
+		Amount:      amount,
+	}
+	if len(row) > idColumnIndex {
+		transaction.ID = fmt.Sprintf("%v", row[idColumnIndex])
+	}
+	if len(row) > refundColumnIndex {
+		transaction.RefundOf = fmt.Sprintf("%v", row[refundColumnIndex])
+	}
+	if len(row) > importColumnIndex {
+		transaction.ImportID = fmt.Sprintf("%v", row[importColumnIndex])
+	}
+	if len(row) > convertedColumnIndex {
+		transaction.Converted = parseConversion(row[convertedColumnIndex:], currency, s.decimal)
+	}
+
+	transaction.Type = model.Expense
+	if len(row) > typeColumnIndex && row[typeColumnIndex] != "" {
+		transaction.Type = fmt.Sprintf("%v", row[typeColumnIndex])
+		if !slices.Contains(model.Types, transaction.Type) {
+			return model.Transaction{}, stale{}, fmt.Errorf("bad value %v for field type", row[typeColumnIndex])
+		}
+	} else if amount.Minor < 0 {
+		transaction.Type = model.Refund
+		transaction.Amount.Minor = -amount.Minor
+	}
+	return transaction, old, nil
+}
+
+// parseAmount reads an amount cell: a number, or text written in the
+// user's locale, which may name another currency.
+func parseAmount(cell interface{}, currency string, decimal rune) (model.Money, error) {
+	if v, ok := cell.(float64); ok {
+		return model.FromFloat(v, currency), nil
+	}
+	return model.ParseMoney(fmt.Sprintf("%v", cell), currency, decimal)
+}
+
+// withCurrency gives transaction the user's currency, when it was entered
+// without one.
+func withCurrency(transaction model.Transaction, s settings) (model.Transaction, error) {
+	if transaction.Amount.Currency != "" {
+		return transaction, nil
+	}
+	amount, err := transaction.Amount.WithCurrency(s.currency)
+	if err != nil {
+		return model.Transaction{}, fmt.Errorf("%w: amount %v", ErrInvalid, err)
+	}
+	transaction.Amount = amount
+	return transaction, nil
+}
+
+// Insert writes transaction below the last one, and returns it with the ID
+// it was given and its date as the user's day, today when it has none.
+// Without a category, it is given one by the user's rules. A transaction
+// dated in a closed cycle is written to the tab of that cycle.
+func (g *GoogleSheetsRepo) Insert(ctx context.Context, transaction model.Transaction, sheetRef string) (model.Transaction, error) {
+	defer metrics.Track(g.Metrics, "Insert")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Insert")
+	defer span.End()
+
+	id, err := newID()
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	transaction.ID = id
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	transaction.DateCreated = localDay(transaction.DateCreated, settings.loc)
+	if transaction, err = withCurrency(transaction, settings); err != nil {
+		return model.Transaction{}, err
+	}
+	if transaction, err = g.categorized(ctx, sheetRef, settings, transaction); err != nil {
+		return model.Transaction{}, err
+	}
+	if err := g.checkRefund(ctx, sheetRef, transaction, settings); err != nil {
+		return model.Transaction{}, err
+	}
+	if transaction, err = g.converted(ctx, sheetRef, settings, transaction); err != nil {
+		return model.Transaction{}, err
+	}
+
+	sheet, err := g.readCycleSheet(ctx, sheetRef, g.layout())
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	layout := sheet.tab(g.layout(), *transaction.DateCreated)
+	nextEmptyRow, err := g.nextRow(ctx, sheetRef, layout)
+	if err != nil {
+		return model.Transaction{}, err
 	}
 
 	// Prepare the value range
 	vr := &sheets.ValueRange{
-		Values: values,
+		Values: [][]interface{}{toRow(transaction)},
 	}
 
-	writeRange := "Sheet1!A" + strconv.Itoa(nextEmptyRow)
-
 	// Call the Sheets API to update the range
-	_, err = g.Service.Spreadsheets.Values.Update(sheetRef, writeRange, vr).ValueInputOption("USER_ENTERED").Do()
+	_, err = g.Service.Spreadsheets.Values.Update(sheetRef, layout.rowRange(nextEmptyRow), vr).ValueInputOption("USER_ENTERED").Context(ctx).Do()
 	if err != nil {
-		log.Printf("Unable to update data: %v", err)
-		return err
+		logging.Logger(ctx).Error("Unable to update data", "err", err)
+		return model.Transaction{}, sheetsError(err)
+	}
+
+	g.hideIDColumn(ctx, sheetRef)
+
+	logging.Logger(ctx).Debug("spreadsheet updated")
+	return transaction, nil
+}
+
+// nextRow is the row below the last transaction in the tab of layout.
+func (g *GoogleSheetsRepo) nextRow(ctx context.Context, sheetRef string, layout SheetLayout) (int, error) {
+	columnRange := fmt.Sprintf("%s!A%d:A", layout.Sheet, layout.FirstRow)
+
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, columnRange).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve data from column", "err", err)
+		return 0, sheetsError(err)
+	}
+	return len(resp.Values) + layout.FirstRow, nil
+}
+
+// hideIDColumn hides the ID column of sheetRef, the first time it is written
+// to since the service started. The IDs are still there when it fails, so
+// it is only logged.
+func (g *GoogleSheetsRepo) hideIDColumn(ctx context.Context, sheetRef string) {
+	if _, done := g.hidden.Load(sheetRef); done {
+		return
+	}
+
+	layout := g.layout()
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		logging.Logger(ctx).Warn("unable to find the sheet to hide transaction IDs in", "err", err)
+		return
+	}
+	sheetID, ok := sheetIDs[layout.Sheet]
+	if !ok {
+		logging.Logger(ctx).Warn("no sheet to hide transaction IDs in", "sheet", layout.Sheet)
+		return
 	}
 
-	fmt.Println("Spreadsheet updated successfully!")
-	return err
+	req := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			UpdateDimensionProperties: &sheets.UpdateDimensionPropertiesRequest{
+				Range: &sheets.DimensionRange{
+					SheetId:    sheetID,
+					Dimension:  "COLUMNS",
+					StartIndex: idColumnIndex,
+					EndIndex:   idColumnIndex + 1,
+				},
+				Properties: &sheets.DimensionProperties{HiddenByUser: true},
+				Fields:     "hiddenByUser",
+			},
+		}},
+	}
+	_, err = g.Service.Spreadsheets.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Warn("unable to hide transaction IDs", "err", err)
+		return
+	}
+	g.hidden.Store(sheetRef, true)
 }
 
-func parseAmountToFloat(amount string) (float64, error) {
-	amount = strings.Replace(amount, "$", "", 1)
-	amount = strings.ReplaceAll(amount, ",", "")
-	return strconv.ParseFloat(amount, 2)
+// sheetIDs returns the ID of every tab in sheetRef, by name.
+func (g *GoogleSheetsRepo) sheetIDs(ctx context.Context, sheetRef string) (map[string]int64, error) {
+	spreadsheet, err := g.Service.Spreadsheets.Get(sheetRef).Fields("sheets.properties(sheetId,title)").Context(ctx).Do()
+	if err != nil {
+		return nil, sheetsError(err)
+	}
 
+	ids := map[string]int64{}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties != nil {
+			ids[sheet.Properties.Title] = sheet.Properties.SheetId
+		}
+	}
+	return ids, nil
 }
 
+// FetchTransactions returns every transaction in the current cycle.
+// Transactions entered by hand are given an ID the first time they are
+// fetched.
 func (g *GoogleSheetsRepo) FetchTransactions(ctx context.Context, sheetRef string) ([]model.Transaction, error) {
-	readRange := "Sheet1!A:D"
+	defer metrics.Track(g.Metrics, "FetchTransactions")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.FetchTransactions")
+	defer span.End()
 
-	// Read the values from the specified range
-	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, readRange).Do()
+	cycle, err := g.Cycle(ctx, sheetRef, "current")
+	if err != nil {
+		return nil, err
+	}
+	settings, err := g.settings(ctx, sheetRef)
 	if err != nil {
-		log.Printf("Unable to retrieve data from range: %v", err)
 		return nil, err
 	}
+	return g.cycleTransactions(ctx, sheetRef, cycle, settings)
+}
+
+// fetchTransactions returns every transaction in the tab of layout. asOf is
+// the last day the tab can hold a transaction for, in the user's time zone.
+// Rows without an ID are given one, dates without a year are rewritten with
+// the year they were placed in, amounts without a currency are given the
+// user's, and those in another currency are written with their conversion
+// once a rate is known for their day.
+func (g *GoogleSheetsRepo) fetchTransactions(ctx context.Context, sheetRef string, layout SheetLayout, asOf time.Time, s settings) ([]model.Transaction, error) {
+	readRange := fmt.Sprintf("%s!A%d:%s", layout.Sheet, layout.FirstRow, lastColumn)
+
+	// Read the values from the specified range
+	resp, err := readDates(g.Service.Spreadsheets.Values.Get(sheetRef, readRange)).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve data from range", "err", err)
+		return nil, sheetsError(err)
+	}
 
 	// Check if any values were returned
 	if len(resp.Values) == 0 {
-		fmt.Println("No data found.")
+		logging.Logger(ctx).Info("No data found")
 	}
 
-	var transactions []model.Transaction
-	for _, row := range resp.Values {
-		log.Println(len(row), "Row:", row)
-		if len(row) < 4 {
+	transactions := []model.Transaction{}
+	var rows []int
+	var fixes []*sheets.ValueRange
+	for i, row := range resp.Values {
+		// deleted transactions leave an empty row behind
+		if len(row) == 0 {
 			continue
 		}
-		amount64, err := parseAmountToFloat(fmt.Sprintf("%v", row[3]))
+		transaction, old, err := parseRow(row, asOf, s)
 		if err != nil {
-			log.Printf("Bad value for field 'amount': %v: %v", row[3], err)
+			logging.Logger(ctx).Warn("skipping row", "row", layout.FirstRow+i, "err", err)
 			continue
 		}
-		date, err := time.Parse("1/2", fmt.Sprintf("%v", row[0]))
-		if err != nil {
-			log.Printf("Bad value for field date: %v: %v", row[0], err)
-			continue
+
+		if old.currency {
+			fixes = append(fixes, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s!F%d", layout.Sheet, layout.FirstRow+i),
+				Values: [][]interface{}{{transaction.Amount.Currency}},
+			})
+		}
+		if old.date {
+			fixes = append(fixes, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s!A%d", layout.Sheet, layout.FirstRow+i),
+				Values: [][]interface{}{{transaction.DateCreated.Format(time.DateOnly)}},
+			})
 		}
-		transactions = append(transactions, model.Transaction{
-			DateCreated: &date,
-			Name:        fmt.Sprintf("%v", row[1]),
-			Category:    fmt.Sprintf("%v", row[2]),
-			Amount:      float32(amount64),
+		if transaction.ID == "" {
+			transaction.ID, err = newID()
+			if err != nil {
+				return nil, err
+			}
+			fixes = append(fixes, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s!E%d", layout.Sheet, layout.FirstRow+i),
+				Values: [][]interface{}{{textCell(transaction.ID)}},
+			})
+		}
+		transactions = append(transactions, transaction)
+		rows = append(rows, layout.FirstRow+i)
+	}
+
+	converted, err := g.convert(ctx, sheetRef, s, transactions)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range converted {
+		fixes = append(fixes, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!J%d:N%d", layout.Sheet, rows[i], rows[i]),
+			Values: [][]interface{}{conversionCells(transactions[i].Converted)},
 		})
 	}
 
-	return transactions, err
+	if len(fixes) > 0 {
+		req := &sheets.BatchUpdateValuesRequest{
+			ValueInputOption: "USER_ENTERED",
+			Data:             fixes,
+		}
+		_, err := g.Service.Spreadsheets.Values.BatchUpdate(sheetRef, req).Context(ctx).Do()
+		if err != nil {
+			logging.Logger(ctx).Error("Unable to fill in transactions", "err", err)
+			return nil, sheetsError(err)
+		}
+		logging.Logger(ctx).Info("filled in transactions", "cells", len(fixes))
+	}
+	return transactions, nil
 }
 
-func (g *GoogleSheetsRepo) FetchCircleAmounts(ctx context.Context, sheetRef string) (interface{}, error) {
-	readRange := "Sheet1!H43:H44"
-	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, readRange).Do()
+// findRow returns the row of the tab of layout holding the transaction
+// with id.
+func (g *GoogleSheetsRepo) findRow(ctx context.Context, sheetRef string, layout SheetLayout, id string) (int, error) {
+	idRange := fmt.Sprintf("%s!E%d:E", layout.Sheet, layout.FirstRow)
+
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, idRange).Context(ctx).Do()
 	if err != nil {
-		log.Printf("Unable to retrieve data from range: %v", err)
-		return nil, err
+		logging.Logger(ctx).Error("Unable to retrieve transaction IDs", "err", err)
+		return 0, sheetsError(err)
 	}
 
-	var amounts [2]float32
+	for i, row := range resp.Values {
+		if len(row) > 0 && fmt.Sprintf("%v", row[0]) == id {
+			return layout.FirstRow + i, nil
+		}
+	}
+	return 0, fmt.Errorf("transaction %s: %w", id, ErrNotFound)
+}
+
+// locate returns the tab and row holding the transaction with id, looking
+// in the transaction tab, then in the tabs of the closed cycles of sheet,
+// latest first. Tabs deleted by hand are skipped.
+func (g *GoogleSheetsRepo) locate(ctx context.Context, sheetRef string, sheet cycleSheet, id string) (SheetLayout, int, error) {
+	layout := g.layout()
+	row, err := g.findRow(ctx, sheetRef, layout, id)
+	if !errors.Is(err, ErrNotFound) {
+		return layout, row, err
+	}
+	for i := len(sheet.closed) - 1; i >= 0; i-- {
+		closed := layout
+		closed.Sheet = sheet.closed[i].Sheet
+		row, err := g.findRow(ctx, sheetRef, closed, id)
+		if errors.Is(err, ErrNotFound) || missingSheet(err) {
+			continue
+		}
+		return closed, row, err
+	}
+	return SheetLayout{}, 0, fmt.Errorf("transaction %s: %w", id, ErrNotFound)
+}
+
+// FetchTransaction returns the transaction with id, in the current cycle
+// or a closed one.
+func (g *GoogleSheetsRepo) FetchTransaction(ctx context.Context, sheetRef, id string) (model.Transaction, error) {
+	defer metrics.Track(g.Metrics, "FetchTransaction")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.FetchTransaction")
+	defer span.End()
+
+	sheet, err := g.readCycleSheet(ctx, sheetRef, g.layout())
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	layout, row, err := g.locate(ctx, sheetRef, sheet, id)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	transaction, err := g.readRow(ctx, sheetRef, layout, row, settings)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	return g.converted(ctx, sheetRef, settings, transaction)
+}
+
+// readRow reads the transaction in row of the tab of layout.
+func (g *GoogleSheetsRepo) readRow(ctx context.Context, sheetRef string, layout SheetLayout, row int, s settings) (model.Transaction, error) {
+	resp, err := readDates(g.Service.Spreadsheets.Values.Get(sheetRef, layout.rowRange(row))).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve transaction", "err", err)
+		return model.Transaction{}, sheetsError(err)
+	}
 	if len(resp.Values) == 0 {
-		fmt.Println("No data found.")
-		return nil, err
+		return model.Transaction{}, fmt.Errorf("transaction in row %d: %w", row, ErrNotFound)
 	}
 
-	for i, row := range resp.Values {
-		dollar_amount := fmt.Sprintf("%v", row[0])
-		formatted_amount := strings.Replace(dollar_amount, "$", "", 1)
-		amount := strings.Replace(formatted_amount, ",", "", 1)
-		a, err := strconv.ParseFloat(amount, 2)
+	transaction, _, err := parseRow(resp.Values[0], *localDay(nil, s.loc), s)
+	return transaction, err
+}
+
+// checkRefund checks the expense a refund is for exists, in the current
+// cycle or a closed one. It fails with ErrInvalid when it does not, or is
+// not an expense.
+func (g *GoogleSheetsRepo) checkRefund(ctx context.Context, sheetRef string, transaction model.Transaction, s settings) error {
+	if transaction.RefundOf == "" {
+		return nil
+	}
+	if transaction.Type != model.Refund {
+		return fmt.Errorf("%w: only a refund can be for an expense", ErrInvalid)
+	}
+
+	sheet, err := g.readCycleSheet(ctx, sheetRef, g.layout())
+	if err != nil {
+		return err
+	}
+	layout, row, err := g.locate(ctx, sheetRef, sheet, transaction.RefundOf)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("%w: no expense %s to refund", ErrInvalid, transaction.RefundOf)
+	}
+	if err != nil {
+		return err
+	}
+	expense, err := g.readRow(ctx, sheetRef, layout, row, s)
+	if err != nil {
+		return err
+	}
+	if expense.Type != model.Expense {
+		return fmt.Errorf("%w: transaction %s is a refund for a %s", ErrInvalid, expense.ID, expense.Type)
+	}
+	return nil
+}
+
+// converted returns transaction converted to the user's currency, when it
+// is in another.
+func (g *GoogleSheetsRepo) converted(ctx context.Context, sheetRef string, s settings, transaction model.Transaction) (model.Transaction, error) {
+	transactions := []model.Transaction{transaction}
+	if _, err := g.convert(ctx, sheetRef, s, transactions); err != nil {
+		return model.Transaction{}, err
+	}
+	return transactions[0], nil
+}
+
+// Update replaces the transaction with the ID of transaction, in the
+// current cycle or a closed one, and returns it with its date as the user's
+// day, today when it has none. Without a category, it is given one by the
+// user's rules. The import ID it was recorded with is kept, so importing
+// its statement again still finds it, and so is the expense a refund is for
+// when transaction names none. It stays in place, unless its new date is
+// in another cycle, when it is moved to the tab of that cycle.
+func (g *GoogleSheetsRepo) Update(ctx context.Context, transaction model.Transaction, sheetRef string) (model.Transaction, error) {
+	defer metrics.Track(g.Metrics, "Update")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Update")
+	defer span.End()
+
+	sheet, err := g.readCycleSheet(ctx, sheetRef, g.layout())
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	layout, row, err := g.locate(ctx, sheetRef, sheet, transaction.ID)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	recorded, err := g.readRow(ctx, sheetRef, layout, row, settings)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	transaction.ImportID = recorded.ImportID
+	if transaction.RefundOf == "" && transaction.Type == model.Refund {
+		transaction.RefundOf = recorded.RefundOf
+	}
+	transaction.DateCreated = localDay(transaction.DateCreated, settings.loc)
+	if transaction, err = withCurrency(transaction, settings); err != nil {
+		return model.Transaction{}, err
+	}
+	if transaction, err = g.categorized(ctx, sheetRef, settings, transaction); err != nil {
+		return model.Transaction{}, err
+	}
+	if transaction.RefundOf == transaction.ID {
+		return model.Transaction{}, fmt.Errorf("%w: a transaction cannot refund itself", ErrInvalid)
+	}
+	if err := g.checkRefund(ctx, sheetRef, transaction, settings); err != nil {
+		return model.Transaction{}, err
+	}
+	if transaction, err = g.converted(ctx, sheetRef, settings, transaction); err != nil {
+		return model.Transaction{}, err
+	}
+
+	data := []*sheets.ValueRange{{
+		Range:  layout.rowRange(row),
+		Values: [][]interface{}{toRow(transaction)},
+	}}
+	if to := sheet.tab(g.layout(), *transaction.DateCreated); to.Sheet != layout.Sheet {
+		// written below the last transaction of the other tab, with its
+		// old row cleared in the same update
+		next, err := g.nextRow(ctx, sheetRef, to)
 		if err != nil {
-			fmt.Printf("Bad value for spent: %v", err)
-			return nil, err
+			return model.Transaction{}, err
+		}
+		cleared := make([]interface{}, columnCount)
+		for i := range cleared {
+			cleared[i] = ""
 		}
-		amounts[i] = float32(a)
+		data = append(data, &sheets.ValueRange{Range: layout.rowRange(row), Values: [][]interface{}{cleared}})
+		data[0].Range = to.rowRange(next)
+	}
+
+	req := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             data,
+	}
+	_, err = g.Service.Spreadsheets.Values.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to update transaction", "err", err)
+		return model.Transaction{}, sheetsError(err)
 	}
+	return transaction, nil
+}
 
-	total := amounts[0] + amounts[1]
+// Delete clears the row of the transaction with id, in the current cycle
+// or a closed one, leaving it empty so no other transaction moves.
+func (g *GoogleSheetsRepo) Delete(ctx context.Context, sheetRef, id string) error {
+	defer metrics.Track(g.Metrics, "Delete")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Delete")
+	defer span.End()
 
-	type CircleValues struct {
-		Spent    float32 `json:"spent"`
-		Overflow float32 `json:"overflow"`
-		Total    float32 `json:"total"`
+	sheet, err := g.readCycleSheet(ctx, sheetRef, g.layout())
+	if err != nil {
+		return err
+	}
+	layout, row, err := g.locate(ctx, sheetRef, sheet, id)
+	if err != nil {
+		return err
 	}
 
-	cv := CircleValues{
-		Spent:    amounts[0],
-		Overflow: amounts[1],
-		Total:    total,
+	_, err = g.Service.Spreadsheets.Values.Clear(sheetRef, layout.rowRange(row), &sheets.ClearValuesRequest{}).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to clear transaction", "err", err)
+		return sheetsError(err)
 	}
+	return nil
+}
+
+// FetchCircleAmounts returns what has been spent in the current cycle
+// against the budgets of every category.
+func (g *GoogleSheetsRepo) FetchCircleAmounts(ctx context.Context, sheetRef string) (model.CircleValues, error) {
+	defer metrics.Track(g.Metrics, "FetchCircleAmounts")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.FetchCircleAmounts")
+	defer span.End()
 
-	return cv, err
+	return g.circleValues(ctx, sheetRef, "current")
 }
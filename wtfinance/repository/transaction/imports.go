@@ -0,0 +1,276 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/sheets/v4"
+)
+
+// Transactions imported from a bank statement keep the import ID of their
+// line, so importing the statement again finds them. Those entered by hand
+// have none, and are matched by their day and amount instead.
+
+// recorded returns the transactions dated from first to last, which are
+// days as model.Day gives them, in the transaction tab and the tabs of the
+// closed cycles. Every tab is read, rather than those of the cycles whose
+// bounds hold the days, as a tab can hold days outside its cycle, like the
+// history a spreadsheet held before its first cycle was closed.
+func (g *GoogleSheetsRepo) recorded(ctx context.Context, sheetRef string, first, last time.Time, s settings) ([]model.Transaction, error) {
+	layout := g.layout()
+	sheet, err := g.readCycleSheet(ctx, sheetRef, layout)
+	if err != nil {
+		return nil, err
+	}
+	found, err := g.fetchTransactions(ctx, sheetRef, layout, *localDay(nil, s.loc), s)
+	if err != nil {
+		return nil, err
+	}
+	closed, err := g.closedTransactions(ctx, sheetRef, sheet.closed, s)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []model.Transaction
+	for _, t := range append(found, closed...) {
+		if day := model.Day(*t.DateCreated); !day.Before(first) && !day.After(last) {
+			transactions = append(transactions, t)
+		}
+	}
+	return transactions, nil
+}
+
+// closedTransactions reads every transaction in the tabs of cycles, which
+// are closed, in one call. Tabs deleted by hand are skipped.
+func (g *GoogleSheetsRepo) closedTransactions(ctx context.Context, sheetRef string, cycles []model.Cycle, s settings) ([]model.Transaction, error) {
+	if len(cycles) == 0 {
+		return nil, nil
+	}
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := g.layout()
+	var ranges []string
+	var asOf []time.Time
+	for _, cycle := range cycles {
+		if _, ok := sheetIDs[cycle.Sheet]; !ok {
+			continue
+		}
+		ranges = append(ranges, fmt.Sprintf("%s!A%d:%s", cycle.Sheet, layout.FirstRow, lastColumn))
+		asOf = append(asOf, lastDay(cycle, s.loc))
+	}
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+
+	// read as readDates reads a single range
+	resp, err := g.Service.Spreadsheets.Values.BatchGet(sheetRef).Ranges(ranges...).
+		ValueRenderOption("UNFORMATTED_VALUE").DateTimeRenderOption("SERIAL_NUMBER").Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve closed budget cycles", "err", err)
+		return nil, sheetsError(err)
+	}
+
+	var transactions []model.Transaction
+	for i, vr := range resp.ValueRanges {
+		for _, row := range vr.Values {
+			if len(row) == 0 {
+				continue
+			}
+			t, _, err := parseRow(row, asOf[i], s)
+			if err != nil {
+				continue
+			}
+			transactions = append(transactions, t)
+		}
+	}
+	return transactions, nil
+}
+
+// importSpan is the first and last days of transactions.
+func importSpan(transactions []model.Transaction) (first, last time.Time) {
+	for i, t := range transactions {
+		day := model.Day(*t.DateCreated)
+		if i == 0 || day.Before(first) {
+			first = day
+		}
+		if i == 0 || day.After(last) {
+			last = day
+		}
+	}
+	return first, last
+}
+
+// PreviewImport compares transactions read from a statement with those
+// recorded in the cycles their days fall in, and returns each with whether
+// it is new, was imported before, or may have been entered by hand. Their
+// dates are taken as days in the user's time zone, and amounts without a
+// currency are in the user's. Those without a category are given one by the
+// user's rules. Nothing is written.
+func (g *GoogleSheetsRepo) PreviewImport(ctx context.Context, sheetRef string, transactions []model.Transaction) ([]model.ImportLine, error) {
+	defer metrics.Track(g.Metrics, "PreviewImport")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.PreviewImport")
+	defer span.End()
+
+	lines := []model.ImportLine{}
+	if len(transactions) == 0 {
+		return lines, nil
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range transactions {
+		day := calendarDay(*t.DateCreated, settings.loc)
+		t.DateCreated = &day
+		if transactions[i], err = withCurrency(t, settings); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.categorize(ctx, sheetRef, settings, transactions); err != nil {
+		return nil, err
+	}
+
+	first, last := importSpan(transactions)
+	recorded, err := g.recorded(ctx, sheetRef, first, last, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := map[string]string{}
+	// transactions entered by hand, by day and amount, each matched once
+	byHand := map[string][]string{}
+	for _, t := range recorded {
+		if t.ImportID != "" {
+			imported[t.ImportID] = t.ID
+			continue
+		}
+		key := handKey(t)
+		byHand[key] = append(byHand[key], t.ID)
+	}
+
+	for _, t := range transactions {
+		line := model.ImportLine{Transaction: t, Status: model.ImportNew}
+		if id, ok := imported[t.ImportID]; ok {
+			line.Status, line.DuplicateOf = model.ImportDuplicate, id
+		} else if ids := byHand[handKey(t)]; len(ids) > 0 {
+			line.Status, line.DuplicateOf = model.ImportPossibleDuplicate, ids[0]
+			byHand[handKey(t)] = ids[1:]
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func handKey(t model.Transaction) string {
+	return fmt.Sprintf("%s|%s|%s", t.DateCreated.Format(time.DateOnly), t.Amount, t.Type)
+}
+
+// Import writes transactions below the last one, all in one update, giving
+// each an ID. Those dated in a closed cycle are written to the tab of that
+// cycle. Those whose import ID is already recorded are skipped, so a
+// preview confirmed twice is imported once; their import IDs are returned.
+func (g *GoogleSheetsRepo) Import(ctx context.Context, sheetRef string, transactions []model.Transaction) (written []model.Transaction, skipped []string, err error) {
+	defer metrics.Track(g.Metrics, "Import")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Import")
+	defer span.End()
+
+	written, skipped = []model.Transaction{}, []string{}
+	if len(transactions) == 0 {
+		return written, skipped, nil
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, t := range transactions {
+		t.DateCreated = localDay(t.DateCreated, settings.loc)
+		if transactions[i], err = withCurrency(t, settings); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := g.categorize(ctx, sheetRef, settings, transactions); err != nil {
+		return nil, nil, err
+	}
+	if _, err := g.convert(ctx, sheetRef, settings, transactions); err != nil {
+		return nil, nil, err
+	}
+
+	first, last := importSpan(transactions)
+	recorded, err := g.recorded(ctx, sheetRef, first, last, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	imported := map[string]bool{}
+	for _, t := range recorded {
+		if t.ImportID != "" {
+			imported[t.ImportID] = true
+		}
+	}
+
+	sheet, err := g.readCycleSheet(ctx, sheetRef, g.layout())
+	if err != nil {
+		return nil, nil, err
+	}
+	// the rows for each tab, in the order the tabs are first written to
+	var tabs []SheetLayout
+	rows := map[string][][]interface{}{}
+	count := 0
+	for _, t := range transactions {
+		if t.ImportID != "" && imported[t.ImportID] {
+			skipped = append(skipped, t.ImportID)
+			continue
+		}
+		if err := g.checkRefund(ctx, sheetRef, t, settings); err != nil {
+			return nil, nil, err
+		}
+		if t.ID, err = newID(); err != nil {
+			return nil, nil, err
+		}
+		imported[t.ImportID] = t.ImportID != ""
+		written = append(written, t)
+		layout := sheet.tab(g.layout(), *t.DateCreated)
+		if _, ok := rows[layout.Sheet]; !ok {
+			tabs = append(tabs, layout)
+		}
+		rows[layout.Sheet] = append(rows[layout.Sheet], toRow(t))
+		count++
+	}
+	if count == 0 {
+		return written, skipped, nil
+	}
+
+	// transactions dated in closed cycles go to their tabs, all of them
+	// still in one update
+	var data []*sheets.ValueRange
+	for _, layout := range tabs {
+		row, err := g.nextRow(ctx, sheetRef, layout)
+		if err != nil {
+			return nil, nil, err
+		}
+		values := rows[layout.Sheet]
+		data = append(data, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!A%d:%s%d", layout.Sheet, row, lastColumn, row+len(values)-1),
+			Values: values,
+		})
+	}
+	req := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "USER_ENTERED",
+		Data:             data,
+	}
+	_, err = g.Service.Spreadsheets.Values.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to import transactions", "err", err)
+		return nil, nil, sheetsError(err)
+	}
+	g.hideIDColumn(ctx, sheetRef)
+	logging.Logger(ctx).Info("imported transactions", "count", count, "skipped", len(skipped))
+	return written, skipped, nil
+}
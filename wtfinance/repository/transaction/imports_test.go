@@ -0,0 +1,138 @@
+package transaction
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+// statement is a statement of two expenses from April, dated as a preview
+// in Toronto dates them.
+func statement() []model.Transaction {
+	loc, _ := time.LoadLocation("America/Toronto")
+	day := func(s string) *time.Time {
+		t, _ := time.ParseInLocation(time.DateOnly, s, loc)
+		return &t
+	}
+	return []model.Transaction{
+		{DateCreated: day("2024-04-03"), Name: "Groceries", Category: "Food", Amount: model.Money{Minor: 4250, Currency: "USD"}, Type: model.Expense, ImportID: "line-1"},
+		{DateCreated: day("2024-04-28"), Name: "Gas", Category: "Transport", Amount: model.Money{Minor: 6000, Currency: "USD"}, Type: model.Expense, ImportID: "line-2"},
+	}
+}
+
+func TestImportingAStatementAgainSkipsIt(t *testing.T) {
+	header := [][]interface{}{{"Date", "Name"}, {}}
+	tests := []struct {
+		name  string
+		today string
+		tabs  map[string][][]interface{}
+	}{
+		{
+			name:  "no cycle closed yet",
+			today: "2024-05-20",
+			tabs:  map[string][][]interface{}{"Sheet1": header},
+		},
+		{
+			name:  "statement of the current cycle",
+			today: "2024-04-29",
+			tabs:  map[string][][]interface{}{"Sheet1": header},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := newFakeSheets(t, tt.today, tt.tabs)
+			ctx := context.Background()
+
+			written, skipped, err := repo.Import(ctx, testSheet, statement())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(written) != 2 || len(skipped) != 0 {
+				t.Fatalf("first import wrote %d and skipped %v, want 2 and none", len(written), skipped)
+			}
+
+			lines, err := repo.PreviewImport(ctx, testSheet, statement())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range lines {
+				if line.Status != model.ImportDuplicate {
+					t.Errorf("%s previewed as %s, want %s", line.Transaction.ImportID, line.Status, model.ImportDuplicate)
+				}
+			}
+
+			written, skipped, err = repo.Import(ctx, testSheet, statement())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(written) != 0 || !slices.Equal(skipped, []string{"line-1", "line-2"}) {
+				t.Errorf("second import wrote %d and skipped %v, want none and both", len(written), skipped)
+			}
+		})
+	}
+}
+
+func TestImportFindsTransactionsInClosedCycles(t *testing.T) {
+	header := [][]interface{}{{"Date", "Name"}, {}}
+	imported := func(day, id, importID string) []interface{} {
+		return []interface{}{serial(day), "Groceries", "Food", 42.5, id, "USD", "expense", "", importID}
+	}
+	repo, _ := newFakeSheets(t, "2024-06-10", map[string][][]interface{}{
+		"Sheet1": header,
+		"Cycles": {
+			{"Schedule", "monthly", "1"},
+			{"Start", "End", "Sheet"},
+			{"2024-05-01", "2024-06-01", "Sheet1 2024-05-01"},
+		},
+		// closed in May, holding April too, from before cycles were closed
+		"Sheet1 2024-05-01": append(header, imported("2024-04-03", "t1", "line-1"), imported("2024-04-28", "t2", "line-2")),
+	})
+
+	written, skipped, err := repo.Import(context.Background(), testSheet, statement())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 0 || len(skipped) != 2 {
+		t.Errorf("wrote %d and skipped %v, want none and both", len(written), skipped)
+	}
+}
+
+func TestUpdatingAnImportedTransactionKeepsItsImportID(t *testing.T) {
+	header := [][]interface{}{{"Date", "Name"}, {}}
+	repo, sheet := newFakeSheets(t, "2024-05-20", map[string][][]interface{}{
+		"Sheet1": append(header,
+			[]interface{}{serial("2024-04-03"), "Groceries", "Food", 42.5, "t1", "USD", "expense", "", "line-1"},
+			[]interface{}{serial("2024-04-05"), "Returned", "Food", 10.0, "t2", "USD", "refund", "t1"},
+		),
+	})
+	ctx := context.Background()
+
+	edited := statement()[0]
+	edited.ID, edited.Name, edited.ImportID = "t1", "Market", ""
+	if _, err := repo.Update(ctx, edited, testSheet); err != nil {
+		t.Fatal(err)
+	}
+	refund := model.Transaction{ID: "t2", DateCreated: edited.DateCreated, Name: "Returned milk", Category: "Food", Amount: model.Money{Minor: 1000, Currency: "USD"}, Type: model.Refund}
+	if _, err := repo.Update(ctx, refund, testSheet); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := sheet.rows("Sheet1")
+	if got := rows[2][importColumnIndex]; got != "line-1" {
+		t.Errorf("import ID is %v, want line-1", got)
+	}
+	if got := rows[3][refundColumnIndex]; got != "t1" {
+		t.Errorf("refund is for %v, want t1", got)
+	}
+
+	written, skipped, err := repo.Import(ctx, testSheet, statement()[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 0 || len(skipped) != 1 {
+		t.Errorf("import wrote %d and skipped %v, want none and line-1", len(written), skipped)
+	}
+}
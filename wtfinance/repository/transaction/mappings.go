@@ -0,0 +1,143 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/sheets/v4"
+)
+
+// The mapping tab holds how each bank lays out its CSV statements, one bank
+// to a row below a header: its name, then the mapping as JSON.
+
+// mappingRow is a mapping and the row it is kept in.
+type mappingRow struct {
+	mapping model.Mapping
+	row     int
+}
+
+// readMappings reads the mapping tab. A spreadsheet without one has no
+// mappings.
+func (g *GoogleSheetsRepo) readMappings(ctx context.Context, sheetRef string) ([]mappingRow, error) {
+	readRange := fmt.Sprintf("%s!A2:B", g.layout().MappingSheet)
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, readRange).Context(ctx).Do()
+	if missingSheet(err) {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve statement mappings", "err", err)
+		return nil, sheetsError(err)
+	}
+
+	var mappings []mappingRow
+	for i, row := range resp.Values {
+		if len(row) < 2 {
+			continue
+		}
+		var mapping model.Mapping
+		if err := json.Unmarshal([]byte(fmt.Sprintf("%v", row[1])), &mapping); err != nil {
+			logging.Logger(ctx).Warn("skipping statement mapping", "row", i+2, "err", err)
+			continue
+		}
+		mapping.Bank = fmt.Sprintf("%v", row[0])
+		mappings = append(mappings, mappingRow{mapping: mapping, row: i + 2})
+	}
+	return mappings, nil
+}
+
+// Mappings lists how each bank of sheetRef lays out its CSV statements.
+func (g *GoogleSheetsRepo) Mappings(ctx context.Context, sheetRef string) ([]model.Mapping, error) {
+	defer metrics.Track(g.Metrics, "Mappings")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Mappings")
+	defer span.End()
+
+	rows, err := g.readMappings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	mappings := []model.Mapping{}
+	for _, r := range rows {
+		mappings = append(mappings, r.mapping)
+	}
+	return mappings, nil
+}
+
+// Mapping returns how bank lays out its CSV statements. Banks are named
+// without regard to case.
+func (g *GoogleSheetsRepo) Mapping(ctx context.Context, sheetRef, bank string) (model.Mapping, error) {
+	defer metrics.Track(g.Metrics, "Mapping")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Mapping")
+	defer span.End()
+
+	rows, err := g.readMappings(ctx, sheetRef)
+	if err != nil {
+		return model.Mapping{}, err
+	}
+	for _, r := range rows {
+		if strings.EqualFold(r.mapping.Bank, bank) {
+			return r.mapping, nil
+		}
+	}
+	return model.Mapping{}, fmt.Errorf("statement mapping %s: %w", bank, ErrNotFound)
+}
+
+// SetMapping saves how a bank lays out its CSV statements, replacing the
+// mapping it had.
+func (g *GoogleSheetsRepo) SetMapping(ctx context.Context, sheetRef string, mapping model.Mapping) (model.Mapping, error) {
+	defer metrics.Track(g.Metrics, "SetMapping")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.SetMapping")
+	defer span.End()
+
+	encoded, err := json.Marshal(mapping)
+	if err != nil {
+		return model.Mapping{}, err
+	}
+	rows, err := g.readMappings(ctx, sheetRef)
+	if err != nil {
+		return model.Mapping{}, err
+	}
+
+	layout := g.layout()
+	values := []interface{}{mapping.Bank, string(encoded)}
+	for _, r := range rows {
+		if !strings.EqualFold(r.mapping.Bank, mapping.Bank) {
+			continue
+		}
+		vr := &sheets.ValueRange{Values: [][]interface{}{values}}
+		writeRange := fmt.Sprintf("%s!A%d:B%d", layout.MappingSheet, r.row, r.row)
+		_, err := g.Service.Spreadsheets.Values.Update(sheetRef, writeRange, vr).ValueInputOption("RAW").Context(ctx).Do()
+		if err != nil {
+			logging.Logger(ctx).Error("Unable to update statement mapping", "err", err)
+			return model.Mapping{}, sheetsError(err)
+		}
+		return mapping, nil
+	}
+
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return model.Mapping{}, err
+	}
+	var rowsToAdd [][]interface{}
+	if _, ok := sheetIDs[layout.MappingSheet]; !ok {
+		if _, err := g.addSheet(ctx, sheetRef, layout.MappingSheet); err != nil {
+			return model.Mapping{}, err
+		}
+		rowsToAdd = append(rowsToAdd, []interface{}{"Bank", "Mapping"})
+	}
+	rowsToAdd = append(rowsToAdd, values)
+
+	vr := &sheets.ValueRange{Values: rowsToAdd}
+	_, err = g.Service.Spreadsheets.Values.Append(sheetRef, layout.MappingSheet+"!A:B", vr).
+		ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to add statement mapping", "err", err)
+		return model.Mapping{}, sheetsError(err)
+	}
+	return mapping, nil
+}
@@ -0,0 +1,140 @@
+package transaction
+
+import (
+	"context"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/sheets/v4"
+)
+
+// A user's time zone is the time zone of their spreadsheet, and the way
+// they write numbers follows its locale. Their currency is kept in the
+// spreadsheet's developer metadata.
+const currencyKey = "wtfinance.currency"
+
+// settings are what reading and writing a user's transactions depends on.
+type settings struct {
+	loc *time.Location
+	// the decimal separator of the spreadsheet's locale
+	decimal  rune
+	currency string
+
+	timeZone string
+	// the developer metadata holding the currency, 0 when it is not set
+	currencyID int64
+}
+
+// settings reads the settings of sheetRef. A time zone Go does not know is
+// taken as UTC.
+func (g *GoogleSheetsRepo) settings(ctx context.Context, sheetRef string) (settings, error) {
+	spreadsheet, err := g.Service.Spreadsheets.Get(sheetRef).
+		Fields("properties(timeZone,locale),developerMetadata(metadataId,metadataKey,metadataValue)").
+		Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve the spreadsheet settings", "err", err)
+		return settings{}, sheetsError(err)
+	}
+
+	s := settings{loc: time.UTC, decimal: '.', currency: g.currency()}
+	if spreadsheet.Properties != nil {
+		s.timeZone = spreadsheet.Properties.TimeZone
+		s.decimal = model.DecimalSeparator(spreadsheet.Properties.Locale)
+	}
+	if loc, err := time.LoadLocation(s.timeZone); err == nil && s.timeZone != "" {
+		s.loc = loc
+	} else {
+		logging.Logger(ctx).Warn("unknown spreadsheet time zone, using UTC", "time_zone", s.timeZone)
+	}
+	for _, m := range spreadsheet.DeveloperMetadata {
+		if m.MetadataKey == currencyKey && model.ValidCurrency(m.MetadataValue) {
+			s.currency, s.currencyID = m.MetadataValue, m.MetadataId
+		}
+	}
+	return s, nil
+}
+
+// currency is the currency of users who have not chosen one.
+func (g *GoogleSheetsRepo) currency() string {
+	if g.Currency == "" {
+		return "USD"
+	}
+	return g.Currency
+}
+
+// Preferences returns the settings the user of sheetRef can change.
+func (g *GoogleSheetsRepo) Preferences(ctx context.Context, sheetRef string) (model.Preferences, error) {
+	defer metrics.Track(g.Metrics, "Preferences")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Preferences")
+	defer span.End()
+
+	s, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Preferences{}, err
+	}
+	return model.Preferences{TimeZone: s.timeZone, Currency: s.currency}, nil
+}
+
+// SetPreferences changes the settings of sheetRef that are set in p. The
+// time zone is the spreadsheet's, which Sheets uses for its own date
+// functions too.
+func (g *GoogleSheetsRepo) SetPreferences(ctx context.Context, sheetRef string, p model.Preferences) (model.Preferences, error) {
+	defer metrics.Track(g.Metrics, "SetPreferences")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.SetPreferences")
+	defer span.End()
+
+	s, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Preferences{}, err
+	}
+
+	var requests []*sheets.Request
+	if p.TimeZone != "" {
+		requests = append(requests, &sheets.Request{
+			UpdateSpreadsheetProperties: &sheets.UpdateSpreadsheetPropertiesRequest{
+				Properties: &sheets.SpreadsheetProperties{TimeZone: p.TimeZone},
+				Fields:     "timeZone",
+			},
+		})
+		s.timeZone = p.TimeZone
+	}
+	switch {
+	case p.Currency == "":
+	case s.currencyID != 0:
+		requests = append(requests, &sheets.Request{
+			UpdateDeveloperMetadata: &sheets.UpdateDeveloperMetadataRequest{
+				DataFilters: []*sheets.DataFilter{{
+					DeveloperMetadataLookup: &sheets.DeveloperMetadataLookup{MetadataId: s.currencyID},
+				}},
+				DeveloperMetadata: &sheets.DeveloperMetadata{MetadataValue: p.Currency},
+				Fields:            "metadataValue",
+			},
+		})
+		s.currency = p.Currency
+	default:
+		requests = append(requests, &sheets.Request{
+			CreateDeveloperMetadata: &sheets.CreateDeveloperMetadataRequest{
+				DeveloperMetadata: &sheets.DeveloperMetadata{
+					MetadataKey:   currencyKey,
+					MetadataValue: p.Currency,
+					Location:      &sheets.DeveloperMetadataLocation{Spreadsheet: true},
+					Visibility:    "DOCUMENT",
+				},
+			},
+		})
+		s.currency = p.Currency
+	}
+
+	if len(requests) > 0 {
+		req := &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}
+		_, err := g.Service.Spreadsheets.BatchUpdate(sheetRef, req).Context(ctx).Do()
+		if err != nil {
+			logging.Logger(ctx).Error("Unable to update preferences", "err", err)
+			return model.Preferences{}, sheetsError(err)
+		}
+	}
+	return model.Preferences{TimeZone: s.timeZone, Currency: s.currency}, nil
+}
@@ -0,0 +1,202 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sheets/v4"
+)
+
+// The rate tab holds the exchange rates a user entered, below a header:
+// the day, the two currencies and the rate. They are used along with the
+// server's rates, and win over them on the same day.
+
+// readRates reads the rates of the rate tab. A spreadsheet without one has
+// none.
+func (g *GoogleSheetsRepo) readRates(ctx context.Context, sheetRef string, layout SheetLayout) (model.Rates, error) {
+	readRange := fmt.Sprintf("%s!A2:D", layout.RateSheet)
+	resp, err := readDates(g.Service.Spreadsheets.Values.Get(sheetRef, readRange)).Context(ctx).Do()
+	if missingSheet(err) {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve exchange rates", "err", err)
+		return nil, sheetsError(err)
+	}
+
+	var rates model.Rates
+	for i, row := range resp.Values {
+		rate, err := parseRateRow(row)
+		if err != nil {
+			logging.Logger(ctx).Warn("skipping exchange rate", "row", i+2, "err", err)
+			continue
+		}
+		rate.Source = model.RateUser
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+func parseRateRow(row []interface{}) (model.Rate, error) {
+	if len(row) < 4 {
+		return model.Rate{}, fmt.Errorf("row has %d of 4 columns", len(row))
+	}
+	date, _, err := parseDate(row[0], now().UTC())
+	if err != nil {
+		return model.Rate{}, fmt.Errorf("bad date %v", row[0])
+	}
+	return model.ParseRate([]string{
+		date.Format(time.DateOnly),
+		fmt.Sprintf("%v", row[1]),
+		fmt.Sprintf("%v", row[2]),
+		fmt.Sprintf("%v", row[3]),
+	})
+}
+
+// missingSheet reports whether err is Sheets refusing a range on a tab
+// that does not exist.
+func missingSheet(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Message, "Unable to parse range")
+}
+
+// rates is every rate the user of sheetRef can convert with: the server's,
+// then their own.
+func (g *GoogleSheetsRepo) rates(ctx context.Context, sheetRef string) (model.Rates, error) {
+	own, err := g.readRates(ctx, sheetRef, g.layout())
+	if err != nil {
+		return nil, err
+	}
+	return append(append(model.Rates(nil), g.ServerRates...), own...), nil
+}
+
+// Rates lists the exchange rates of sheetRef, the server's and the user's,
+// by date.
+func (g *GoogleSheetsRepo) Rates(ctx context.Context, sheetRef string) (model.Rates, error) {
+	defer metrics.Track(g.Metrics, "Rates")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Rates")
+	defer span.End()
+
+	rates, err := g.rates(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	return rates.Sorted(), nil
+}
+
+// AddRate adds a rate to the rate tab of sheetRef, adding the tab when it
+// is missing.
+func (g *GoogleSheetsRepo) AddRate(ctx context.Context, sheetRef string, rate model.Rate) (model.Rate, error) {
+	defer metrics.Track(g.Metrics, "AddRate")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.AddRate")
+	defer span.End()
+
+	layout := g.layout()
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return model.Rate{}, err
+	}
+
+	var values [][]interface{}
+	if _, ok := sheetIDs[layout.RateSheet]; !ok {
+		if _, err := g.addSheet(ctx, sheetRef, layout.RateSheet); err != nil {
+			return model.Rate{}, err
+		}
+		values = append(values, []interface{}{"Date", "From", "To", "Rate"})
+	}
+	rate.Date = model.Day(rate.Date)
+	rate.Source = model.RateUser
+	values = append(values, []interface{}{rate.Date.Format(time.DateOnly), rate.From, rate.To, rate.Rate})
+
+	vr := &sheets.ValueRange{Values: values}
+	_, err = g.Service.Spreadsheets.Values.Append(sheetRef, layout.RateSheet+"!A:D", vr).
+		ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to add exchange rate", "err", err)
+		return model.Rate{}, sheetsError(err)
+	}
+	return rate, nil
+}
+
+// convert converts the transactions not in the user's currency, at the
+// rate of their day, unless a conversion to it was recorded with them. It
+// returns the indexes of those it converted; those without a known rate
+// are left as they are.
+func (g *GoogleSheetsRepo) convert(ctx context.Context, sheetRef string, s settings, transactions []model.Transaction) ([]int, error) {
+	var rates model.Rates
+	var converted []int
+	read := false
+	for i, t := range transactions {
+		if _, ok := t.Home(s.currency); ok {
+			continue
+		}
+		if !read {
+			var err error
+			if rates, err = g.rates(ctx, sheetRef); err != nil {
+				return nil, err
+			}
+			read = true
+		}
+
+		amount, rate, err := rates.Convert(t.Amount, s.currency, *t.DateCreated)
+		if err != nil {
+			logging.Logger(ctx).Debug("unable to convert transaction", "id", t.ID, "err", err)
+			continue
+		}
+		transactions[i].Converted = &model.Conversion{Amount: amount, Rate: rate}
+		converted = append(converted, i)
+	}
+	return converted, nil
+}
+
+// A transaction in another currency than the user's is written with its
+// conversion, in the columns after its import ID: the converted amount, its
+// currency, and the rate, its day and where it came from, so a rate added
+// later never changes what it was worth.
+
+// conversionCells are the cells of conversion, empty when there is none.
+func conversionCells(conversion *model.Conversion) []interface{} {
+	if conversion == nil {
+		return []interface{}{"", "", "", "", ""}
+	}
+	return []interface{}{
+		conversion.Amount.Float(),
+		conversion.Amount.Currency,
+		conversion.Rate.Rate,
+		conversion.Rate.Date.Format(time.DateOnly),
+		conversion.Rate.Source,
+	}
+}
+
+// parseConversion reads the conversion of an amount in from back from its
+// cells, read with readDates. Cells that do not hold one are read as none,
+// so the transaction is converted again.
+func parseConversion(cells []interface{}, from string, decimal rune) *model.Conversion {
+	if len(cells) < 5 {
+		return nil
+	}
+	to := fmt.Sprintf("%v", cells[1])
+	source := fmt.Sprintf("%v", cells[4])
+	if !model.ValidCurrency(to) || to == from || (source != model.RateFile && source != model.RateUser) {
+		return nil
+	}
+	amount, err := parseAmount(cells[0], to, decimal)
+	if err != nil {
+		return nil
+	}
+	rate, err := parseRateRow([]interface{}{cells[3], from, to, cells[2]})
+	if err != nil {
+		return nil
+	}
+	rate.Source = source
+	return &model.Conversion{Amount: amount, Rate: rate}
+}
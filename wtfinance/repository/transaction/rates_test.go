@@ -0,0 +1,91 @@
+package transaction
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func rate(day, from, to string, r float64) model.Rate {
+	date, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		panic(err)
+	}
+	return model.Rate{Date: date, From: from, To: to, Rate: r, Source: model.RateFile}
+}
+
+func TestConversionsAreKeptWithTheTransaction(t *testing.T) {
+	repo, fake := newFakeSheets(t, "2024-05-20", map[string][][]interface{}{
+		"Sheet1": {{"Date", "Name"}, {}},
+	})
+	repo.ServerRates = model.Rates{rate("2024-05-01", "EUR", "USD", 1.1)}
+	ctx := context.Background()
+
+	day := time.Date(2024, time.May, 10, 0, 0, 0, 0, time.UTC)
+	inserted, err := repo.Insert(ctx, model.Transaction{
+		DateCreated: &day, Name: "Hotel", Category: "Travel", Amount: model.Money{Minor: 10000, Currency: "EUR"}, Type: model.Expense,
+	}, testSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inserted.Converted == nil || inserted.Converted.Amount != (model.Money{Minor: 11000, Currency: "USD"}) {
+		t.Fatalf("inserted with conversion %+v, want 110.00 USD", inserted.Converted)
+	}
+
+	// a rate added later for an earlier day does not change it
+	repo.ServerRates = append(repo.ServerRates, rate("2024-05-05", "EUR", "USD", 1.5))
+	got, err := repo.FetchTransaction(ctx, testSheet, inserted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Converted == nil || got.Converted.Amount.Minor != 11000 || got.Converted.Rate != inserted.Converted.Rate {
+		t.Errorf("read back with conversion %+v, want %+v", got.Converted, inserted.Converted)
+	}
+
+	// a row entered by hand is converted once, and kept
+	fake.tabs["Sheet1"] = append(fake.tabs["Sheet1"], []interface{}{serial("2024-05-12"), "Dinner", "Food", 20, "h1", "EUR", "expense"})
+	if _, err := repo.FetchTransactions(ctx, testSheet); err != nil {
+		t.Fatal(err)
+	}
+	repo.ServerRates = append(repo.ServerRates, rate("2024-05-11", "EUR", "USD", 2))
+	transactions, err := repo.FetchTransactions(ctx, testSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range transactions {
+		if tr.ID == "h1" && (tr.Converted == nil || tr.Converted.Amount.Minor != 3000) {
+			t.Errorf("hand entered row has conversion %+v, want 30.00 USD", tr.Converted)
+		}
+	}
+}
+
+func TestSumsLeaveOutUnconvertedTransactions(t *testing.T) {
+	repo, _ := newFakeSheets(t, "2024-05-20", map[string][][]interface{}{
+		"Sheet1": {
+			{"Date", "Name"}, {},
+			{serial("2024-05-02"), "Groceries", "Food", 40, "u1", "USD", "expense"},
+			{serial("2024-05-03"), "Museum", "Fun", 25, "g1", "GBP", "expense"},
+		},
+		"Budgets": {{"Category", "Cycle", "Amount", "Currency"}, {"Food", "", 100, "USD"}, {"Fun", "", 50, "GBP"}},
+	})
+	ctx := context.Background()
+
+	totals, err := repo.CycleTotals(ctx, testSheet, "current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.Count != 2 || totals.Total.Minor != 4000 || len(totals.Unconverted) != 1 || totals.Unconverted[0].ID != "g1" {
+		t.Errorf("got %d transactions totalling %s, with %d unconverted, want 2 totalling 40.00 with g1 unconverted",
+			totals.Count, totals.Total.Decimal(), len(totals.Unconverted))
+	}
+
+	circle, err := repo.FetchCircleAmounts(ctx, testSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if circle.Spent.Minor != 4000 || circle.Budget.Minor != 10000 || circle.Unconverted != 2 {
+		t.Errorf("got %+v, want 40.00 spent of 100.00, with a transaction and a budget unconverted", circle)
+	}
+}
@@ -0,0 +1,340 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/sheets/v4"
+)
+
+// The rule tab holds the user's rules in the order they are tried, one to a
+// row below a header: the text the name contains, the pattern it matches,
+// the least and most amount, their currency, then the category and name
+// given. Saving the rules rewrites the tab.
+
+// readRules reads the rule tab. A spreadsheet without one has no rules.
+// Rules whose pattern no longer compiles, because it was edited by hand,
+// are skipped.
+func (g *GoogleSheetsRepo) readRules(ctx context.Context, sheetRef string, s settings) ([]model.Rule, error) {
+	readRange := fmt.Sprintf("%s!A2:G", g.layout().RuleSheet)
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, readRange).ValueRenderOption("UNFORMATTED_VALUE").Context(ctx).Do()
+	if missingSheet(err) {
+		return []model.Rule{}, nil
+	}
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve rules", "err", err)
+		return nil, sheetsError(err)
+	}
+
+	rules := []model.Rule{}
+	for i, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		rule, err := parseRuleRow(row, s)
+		if err == nil {
+			_, err = model.NewRuleset([]model.Rule{rule})
+		}
+		if err != nil {
+			logging.Logger(ctx).Warn("skipping rule", "row", i+2, "err", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRuleRow(row []interface{}, s settings) (model.Rule, error) {
+	if len(row) < 6 {
+		return model.Rule{}, fmt.Errorf("row has %d of 6 columns", len(row))
+	}
+	cell := func(i int) string {
+		if i >= len(row) {
+			return ""
+		}
+		return fmt.Sprintf("%v", row[i])
+	}
+
+	currency := s.currency
+	if model.ValidCurrency(cell(4)) {
+		currency = cell(4)
+	}
+	rule := model.Rule{
+		Contains: cell(0),
+		Pattern:  cell(1),
+		Category: cell(5),
+		Rename:   cell(6),
+	}
+	for _, bound := range []struct {
+		field string
+		cell  int
+		dst   **model.Money
+	}{{"min", 2, &rule.Min}, {"max", 3, &rule.Max}} {
+		if cell(bound.cell) == "" {
+			continue
+		}
+		amount, err := parseAmount(row[bound.cell], currency, s.decimal)
+		if err != nil {
+			return model.Rule{}, fmt.Errorf("bad value %v for field %s: %w", row[bound.cell], bound.field, err)
+		}
+		*bound.dst = &amount
+	}
+	if rule.Category == "" {
+		return model.Rule{}, fmt.Errorf("no category")
+	}
+	return rule, nil
+}
+
+// ruleRow is the row of rule. Text is written as it is, so a pattern
+// starting with = is not taken for a formula.
+func ruleRow(rule model.Rule) *sheets.RowData {
+	row := stringCells(rule.Contains, rule.Pattern, "", "", rule.Currency(), rule.Category, rule.Rename)
+	for i, bound := range []*model.Money{rule.Min, rule.Max} {
+		cell := &sheets.CellData{}
+		if bound != nil {
+			amount := bound.Float()
+			cell.UserEnteredValue = &sheets.ExtendedValue{NumberValue: &amount}
+		}
+		row.Values[2+i] = cell
+	}
+	return row
+}
+
+// Rules lists the rules of sheetRef, in the order they are tried.
+func (g *GoogleSheetsRepo) Rules(ctx context.Context, sheetRef string) ([]model.Rule, error) {
+	defer metrics.Track(g.Metrics, "Rules")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Rules")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	return g.readRules(ctx, sheetRef, settings)
+}
+
+// SetRules replaces the rules of sheetRef, adding the tab when it is
+// missing. Amounts without a currency are in the user's.
+func (g *GoogleSheetsRepo) SetRules(ctx context.Context, sheetRef string, rules []model.Rule) ([]model.Rule, error) {
+	defer metrics.Track(g.Metrics, "SetRules")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.SetRules")
+	defer span.End()
+
+	if _, err := model.NewRuleset(rules); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	for i, rule := range rules {
+		for _, bound := range []*model.Money{rule.Min, rule.Max} {
+			if bound == nil || bound.Currency != "" {
+				continue
+			}
+			if *bound, err = bound.WithCurrency(settings.currency); err != nil {
+				return nil, fmt.Errorf("%w: rule %d: %v", ErrInvalid, i, err)
+			}
+		}
+	}
+
+	layout := g.layout()
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	ruleSheet, ok := sheetIDs[layout.RuleSheet]
+	if !ok {
+		if ruleSheet, err = g.addSheet(ctx, sheetRef, layout.RuleSheet); err != nil {
+			return nil, err
+		}
+	}
+
+	header := stringCells("Contains", "Pattern", "Min", "Max", "Currency", "Category", "Rename")
+	rows := []*sheets.RowData{header}
+	for _, rule := range rules {
+		rows = append(rows, ruleRow(rule))
+	}
+	// one request writes the rules over the whole tab, and clears the cells
+	// below them, so a failure cannot leave the tab empty or half written
+	req := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			UpdateCells: &sheets.UpdateCellsRequest{
+				Range: &sheets.GridRange{
+					SheetId:          ruleSheet,
+					StartRowIndex:    0,
+					StartColumnIndex: 0,
+					EndColumnIndex:   int64(len(header.Values)),
+				},
+				Rows:   rows,
+				Fields: "userEnteredValue",
+			},
+		}},
+	}
+	_, err = g.Service.Spreadsheets.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to write rules", "err", err)
+		return nil, sheetsError(err)
+	}
+	return rules, nil
+}
+
+// categorize gives the transactions entered without a category the
+// category and name of the first rule matching them, or Uncategorized. The
+// rules are only read when one has no category.
+func (g *GoogleSheetsRepo) categorize(ctx context.Context, sheetRef string, s settings, transactions []model.Transaction) error {
+	var rules *model.Ruleset
+	for i, t := range transactions {
+		if t.Category != "" {
+			continue
+		}
+		if rules == nil {
+			found, err := g.readRules(ctx, sheetRef, s)
+			if err != nil {
+				return err
+			}
+			rs, err := model.NewRuleset(found)
+			if err != nil {
+				return err
+			}
+			rules = &rs
+			// amounts in other currencies are matched converted
+			if _, err := g.convert(ctx, sheetRef, s, transactions); err != nil {
+				return err
+			}
+			t = transactions[i]
+		}
+
+		t, _ = rules.Apply(t)
+		if t.Category == "" {
+			t.Category = model.Uncategorized
+		}
+		transactions[i] = t
+	}
+	return nil
+}
+
+// categorized is transaction, categorized as categorize does.
+func (g *GoogleSheetsRepo) categorized(ctx context.Context, sheetRef string, s settings, transaction model.Transaction) (model.Transaction, error) {
+	transactions := []model.Transaction{transaction}
+	if err := g.categorize(ctx, sheetRef, s, transactions); err != nil {
+		return model.Transaction{}, err
+	}
+	return transactions[0], nil
+}
+
+// RunRules applies the rules of sheetRef to the transactions of the cycle
+// with id, which may also be "current", or of every cycle when id is "all",
+// and returns the transactions whose name or category they change. Unless
+// dryRun, the changes are written.
+func (g *GoogleSheetsRepo) RunRules(ctx context.Context, sheetRef, id string, dryRun bool) ([]model.RuleChange, error) {
+	defer metrics.Track(g.Metrics, "RunRules")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.RunRules")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	found, err := g.readRules(ctx, sheetRef, settings)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := model.NewRuleset(found)
+	if err != nil {
+		return nil, err
+	}
+
+	var cycles []model.Cycle
+	if id == "all" {
+		if cycles, err = g.Cycles(ctx, sheetRef); err != nil {
+			return nil, err
+		}
+	} else {
+		cycle, err := g.Cycle(ctx, sheetRef, id)
+		if err != nil {
+			return nil, err
+		}
+		cycles = []model.Cycle{cycle}
+	}
+
+	changes := []model.RuleChange{}
+	for _, cycle := range cycles {
+		transactions, err := g.cycleTransactions(ctx, sheetRef, cycle, settings)
+		// a closed cycle's tab may have been deleted by hand
+		if missingSheet(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var cycleChanges []model.RuleChange
+		for _, t := range transactions {
+			after, rule := rules.Apply(t)
+			if rule < 0 || (after.Name == t.Name && after.Category == t.Category) {
+				continue
+			}
+			cycleChanges = append(cycleChanges, model.RuleChange{
+				Transaction: t.ID,
+				Date:        *t.DateCreated,
+				Rule:        rule,
+				Before:      model.Labels{Name: t.Name, Category: t.Category},
+				After:       model.Labels{Name: after.Name, Category: after.Category},
+			})
+		}
+		if !dryRun && len(cycleChanges) > 0 {
+			if err := g.relabel(ctx, sheetRef, cycle.Sheet, cycleChanges); err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, cycleChanges...)
+	}
+	return changes, nil
+}
+
+// relabel writes the names and categories of changes to the tab named
+// sheet, in one update.
+func (g *GoogleSheetsRepo) relabel(ctx context.Context, sheetRef, sheet string, changes []model.RuleChange) error {
+	layout := g.layout()
+	idRange := fmt.Sprintf("%s!E%d:E", sheet, layout.FirstRow)
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, idRange).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve transaction IDs", "err", err)
+		return sheetsError(err)
+	}
+	rows := map[string]int{}
+	for i, row := range resp.Values {
+		if len(row) > 0 {
+			rows[fmt.Sprintf("%v", row[0])] = layout.FirstRow + i
+		}
+	}
+
+	var data []*sheets.ValueRange
+	for _, c := range changes {
+		row, ok := rows[c.Transaction]
+		if !ok {
+			continue
+		}
+		data = append(data, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!B%d:C%d", sheet, row, row),
+			Values: [][]interface{}{{c.After.Name, c.After.Category}},
+		})
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	req := &sheets.BatchUpdateValuesRequest{ValueInputOption: "RAW", Data: data}
+	_, err = g.Service.Spreadsheets.Values.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to relabel transactions", "err", err)
+		return sheetsError(err)
+	}
+	logging.Logger(ctx).Info("relabelled transactions", "sheet", sheet, "count", len(data))
+	return nil
+}
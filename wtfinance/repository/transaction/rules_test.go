@@ -0,0 +1,70 @@
+package transaction
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func categories(rules []model.Rule) []string {
+	var names []string
+	for _, r := range rules {
+		names = append(names, r.Category)
+	}
+	return names
+}
+
+func TestSetRulesReplacesTheTabInOneWrite(t *testing.T) {
+	repo, fake := newFakeSheets(t, "2024-05-20", map[string][][]interface{}{
+		"Sheet1": {{"Date", "Name"}, {}},
+	})
+	ctx := context.Background()
+
+	first := []model.Rule{{Contains: "grocer", Category: "Food"}, {Contains: "hydro", Category: "Home"}, {Contains: "bus", Category: "Transit"}}
+	if _, err := repo.SetRules(ctx, testSheet, first); err != nil {
+		t.Fatal(err)
+	}
+
+	var writes []string
+	fake.fail = func(r *http.Request) bool {
+		if r.Method != http.MethodGet {
+			writes = append(writes, r.URL.Path)
+		}
+		return false
+	}
+	limit := model.Money{Minor: 1250}
+	if _, err := repo.SetRules(ctx, testSheet, []model.Rule{{Contains: "cafe", Max: &limit, Category: "Coffee"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(writes) != 1 || !strings.HasSuffix(writes[0], ":batchUpdate") {
+		t.Errorf("rules were written with %v, want a single batch update", writes)
+	}
+	rules, err := repo.Rules(ctx, testSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := categories(rules); !slices.Equal(got, []string{"Coffee"}) {
+		t.Fatalf("got rules for %v, want only the new one", got)
+	}
+	if rules[0].Min != nil || rules[0].Max == nil || rules[0].Max.Minor != 1250 {
+		t.Errorf("got bounds %v and %v, want at most 12.50", rules[0].Min, rules[0].Max)
+	}
+
+	// a failed write leaves the rules as they were
+	fake.fail = func(r *http.Request) bool { return strings.HasSuffix(r.URL.Path, ":batchUpdate") }
+	if _, err := repo.SetRules(ctx, testSheet, first); err == nil {
+		t.Fatal("SetRules succeeded although the write failed")
+	}
+	fake.fail = nil
+	rules, err = repo.Rules(ctx, testSheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := categories(rules); !slices.Equal(got, []string{"Coffee"}) {
+		t.Errorf("got rules for %v after a failed write, want %v", got, []string{"Coffee"})
+	}
+}
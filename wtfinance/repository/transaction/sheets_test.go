@@ -0,0 +1,362 @@
+package transaction
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+const testSheet = "test-sheet"
+
+// fakeSheets is one spreadsheet, in memory, behind as much of the Sheets API
+// as the repository calls. Values written USER_ENTERED are taken as Sheets
+// takes them: a leading ' keeps text as it is, and dates become serial
+// numbers.
+type fakeSheets struct {
+	mu       sync.Mutex
+	timeZone string
+	// the tabs, in order, and their rows
+	titles []string
+	tabs   map[string][][]interface{}
+	// fail, when set, makes the calls it returns true for fail
+	fail func(r *http.Request) bool
+}
+
+// newFakeSheets returns a repository of a spreadsheet in Toronto holding
+// tabs, and the spreadsheet. It is today at noon on today.
+func newFakeSheets(t *testing.T, today string, tabs map[string][][]interface{}) (*GoogleSheetsRepo, *fakeSheets) {
+	t.Helper()
+	loc, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day, err := time.ParseInLocation(time.DateOnly, today, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = func() time.Time { return day.Add(12 * time.Hour) }
+	t.Cleanup(func() { now = time.Now })
+
+	f := &fakeSheets{timeZone: "America/Toronto", tabs: map[string][][]interface{}{}}
+	for _, title := range []string{"Sheet1", "Cycles", "Rates", "Budgets", "Mappings", "Subscriptions", "Rules"} {
+		if rows, ok := tabs[title]; ok {
+			f.titles = append(f.titles, title)
+			f.tabs[title] = rows
+		}
+	}
+	for title, rows := range tabs {
+		if _, ok := f.tabs[title]; !ok {
+			f.titles = append(f.titles, title)
+			f.tabs[title] = rows
+		}
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	service, err := sheets.NewService(context.Background(),
+		option.WithEndpoint(srv.URL),
+		option.WithoutAuthentication(),
+		option.WithHTTPClient(srv.Client()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &GoogleSheetsRepo{Service: service}, f
+}
+
+// rows returns the rows of the tab title, trimmed as Sheets trims them.
+func (f *fakeSheets) rows(title string) [][]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read(a1{tab: title, row0: 1, col1: 25})
+}
+
+func (f *fakeSheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v4/spreadsheets/"+testSheet)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "Requested entity was not found.")
+		return
+	}
+	if f.fail != nil && f.fail(r) {
+		writeAPIError(w, http.StatusInternalServerError, "Internal error encountered.")
+		return
+	}
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		f.spreadsheet(w)
+	case rest == ":batchUpdate":
+		f.batchUpdate(w, r)
+	case rest == "/values:batchUpdate":
+		var req sheets.BatchUpdateValuesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, vr := range req.Data {
+			if !f.write(w, parseA1(vr.Range), vr.Values, req.ValueInputOption) {
+				return
+			}
+		}
+		w.Write([]byte(`{}`))
+	case rest == "/values:batchGet":
+		resp := &sheets.BatchGetValuesResponse{}
+		for _, rng := range r.URL.Query()["ranges"] {
+			at := parseA1(rng)
+			if !f.exists(w, at) {
+				return
+			}
+			resp.ValueRanges = append(resp.ValueRanges, &sheets.ValueRange{Range: rng, Values: f.read(at)})
+		}
+		json.NewEncoder(w).Encode(resp)
+	case strings.HasPrefix(rest, "/values/"):
+		f.values(w, r, strings.TrimPrefix(rest, "/values/"))
+	default:
+		writeAPIError(w, http.StatusNotFound, "Requested entity was not found.")
+	}
+}
+
+func (f *fakeSheets) spreadsheet(w http.ResponseWriter) {
+	var tabs []*sheets.Sheet
+	for i, title := range f.titles {
+		tabs = append(tabs, &sheets.Sheet{Properties: &sheets.SheetProperties{SheetId: int64(i), Title: title}})
+	}
+	json.NewEncoder(w).Encode(&sheets.Spreadsheet{
+		Properties: &sheets.SpreadsheetProperties{TimeZone: f.timeZone, Locale: "en_US"},
+		Sheets:     tabs,
+	})
+}
+
+func (f *fakeSheets) values(w http.ResponseWriter, r *http.Request, rng string) {
+	switch {
+	case strings.HasSuffix(rng, ":clear"):
+		at := parseA1(strings.TrimSuffix(rng, ":clear"))
+		if !f.exists(w, at) {
+			return
+		}
+		rows := f.tabs[at.tab]
+		for i := at.row0 - 1; i < len(rows) && (at.row1 == 0 || i < at.row1); i++ {
+			for j := at.col0; j <= at.col1 && j < len(rows[i]); j++ {
+				rows[i][j] = ""
+			}
+		}
+		w.Write([]byte(`{}`))
+	case strings.HasSuffix(rng, ":append"):
+		at := parseA1(strings.TrimSuffix(rng, ":append"))
+		if !f.exists(w, at) {
+			return
+		}
+		var vr sheets.ValueRange
+		json.NewDecoder(r.Body).Decode(&vr)
+		at.row0 = len(f.read(a1{tab: at.tab, row0: 1, col1: 25})) + 1
+		if f.write(w, at, vr.Values, r.URL.Query().Get("valueInputOption")) {
+			w.Write([]byte(`{}`))
+		}
+	case r.Method == http.MethodPut:
+		var vr sheets.ValueRange
+		json.NewDecoder(r.Body).Decode(&vr)
+		if f.write(w, parseA1(rng), vr.Values, r.URL.Query().Get("valueInputOption")) {
+			w.Write([]byte(`{}`))
+		}
+	default:
+		at := parseA1(rng)
+		if !f.exists(w, at) {
+			return
+		}
+		json.NewEncoder(w).Encode(&sheets.ValueRange{Range: rng, Values: f.read(at)})
+	}
+}
+
+func (f *fakeSheets) batchUpdate(w http.ResponseWriter, r *http.Request) {
+	var req sheets.BatchUpdateSpreadsheetRequest
+	json.NewDecoder(r.Body).Decode(&req)
+
+	resp := &sheets.BatchUpdateSpreadsheetResponse{}
+	for _, q := range req.Requests {
+		reply := &sheets.Response{}
+		switch {
+		case q.AddSheet != nil:
+			title := q.AddSheet.Properties.Title
+			if _, ok := f.tabs[title]; ok {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("A sheet with the name %q already exists.", title))
+				return
+			}
+			f.titles = append(f.titles, title)
+			f.tabs[title] = nil
+			reply.AddSheet = &sheets.AddSheetResponse{Properties: &sheets.SheetProperties{SheetId: int64(len(f.titles) - 1), Title: title}}
+		case q.DuplicateSheet != nil:
+			title := q.DuplicateSheet.NewSheetName
+			if _, ok := f.tabs[title]; ok {
+				writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("A sheet with the name %q already exists.", title))
+				return
+			}
+			var rows [][]interface{}
+			for _, row := range f.tabs[f.titles[q.DuplicateSheet.SourceSheetId]] {
+				rows = append(rows, append([]interface{}{}, row...))
+			}
+			f.titles = append(f.titles, title)
+			f.tabs[title] = rows
+		case q.UpdateCells != nil:
+			start := q.UpdateCells.Start
+			if g := q.UpdateCells.Range; g != nil {
+				// the range is cleared, then the rows written at its start
+				rows := f.tabs[f.titles[g.SheetId]]
+				for i := int(g.StartRowIndex); i < len(rows) && (g.EndRowIndex == 0 || i < int(g.EndRowIndex)); i++ {
+					for j := int(g.StartColumnIndex); j < int(g.EndColumnIndex) && j < len(rows[i]); j++ {
+						rows[i][j] = ""
+					}
+				}
+				start = &sheets.GridCoordinate{SheetId: g.SheetId, RowIndex: g.StartRowIndex, ColumnIndex: g.StartColumnIndex}
+			}
+			var values [][]interface{}
+			for _, row := range q.UpdateCells.Rows {
+				var cells []interface{}
+				for _, cell := range row.Values {
+					switch {
+					case cell.UserEnteredValue == nil:
+						cells = append(cells, "")
+					case cell.UserEnteredValue.StringValue != nil:
+						cells = append(cells, *cell.UserEnteredValue.StringValue)
+					case cell.UserEnteredValue.NumberValue != nil:
+						cells = append(cells, *cell.UserEnteredValue.NumberValue)
+					}
+				}
+				values = append(values, cells)
+			}
+			at := a1{tab: f.titles[start.SheetId], row0: int(start.RowIndex) + 1, col0: int(start.ColumnIndex), col1: 25}
+			if !f.write(w, at, values, "RAW") {
+				return
+			}
+		}
+		resp.Replies = append(resp.Replies, reply)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// exists writes the error Sheets gives for a range on a missing tab.
+func (f *fakeSheets) exists(w http.ResponseWriter, at a1) bool {
+	if _, ok := f.tabs[at.tab]; !ok {
+		writeAPIError(w, http.StatusBadRequest, "Unable to parse range: "+at.tab)
+		return false
+	}
+	return true
+}
+
+// read returns the cells of at, without the empty cells ending each row
+// and the empty rows ending the range.
+func (f *fakeSheets) read(at a1) [][]interface{} {
+	rows := f.tabs[at.tab]
+	var values [][]interface{}
+	for i := at.row0 - 1; i < len(rows) && (at.row1 == 0 || i < at.row1); i++ {
+		row := []interface{}{}
+		for j := at.col0; j <= at.col1 && j < len(rows[i]); j++ {
+			row = append(row, rows[i][j])
+		}
+		for len(row) > 0 && (row[len(row)-1] == nil || row[len(row)-1] == "") {
+			row = row[:len(row)-1]
+		}
+		values = append(values, row)
+	}
+	for len(values) > 0 && len(values[len(values)-1]) == 0 {
+		values = values[:len(values)-1]
+	}
+	return values
+}
+
+var isoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+func (f *fakeSheets) write(w http.ResponseWriter, at a1, values [][]interface{}, input string) bool {
+	if !f.exists(w, at) {
+		return false
+	}
+	rows := f.tabs[at.tab]
+	for i, row := range values {
+		r := at.row0 - 1 + i
+		for len(rows) <= r {
+			rows = append(rows, nil)
+		}
+		for j, cell := range row {
+			c := at.col0 + j
+			for len(rows[r]) <= c {
+				rows[r] = append(rows[r], "")
+			}
+			if s, ok := cell.(string); ok && input == "USER_ENTERED" {
+				switch {
+				case strings.HasPrefix(s, "'"):
+					cell = s[1:]
+				case isoDate.MatchString(s):
+					day, _ := time.Parse(time.DateOnly, s)
+					cell = day.Sub(sheetsEpoch).Hours() / 24
+				}
+			}
+			rows[r][c] = cell
+		}
+	}
+	f.tabs[at.tab] = rows
+	return true
+}
+
+func writeAPIError(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
+
+// a1 is a range in A1 notation: columns from 0, rows from 1, row1 0 when
+// the range runs to the last row.
+type a1 struct {
+	tab        string
+	col0, row0 int
+	col1, row1 int
+}
+
+func parseA1(s string) a1 {
+	tab, cells, _ := strings.Cut(s, "!")
+	from, to, ok := strings.Cut(cells, ":")
+	if !ok {
+		to = from
+	}
+	at := a1{tab: tab}
+	at.col0, at.row0 = cellRef(from)
+	at.col1, at.row1 = cellRef(to)
+	if at.row0 == 0 {
+		at.row0 = 1
+	}
+	return at
+}
+
+func cellRef(s string) (col, row int) {
+	i := strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' })
+	letters := s
+	if i >= 0 {
+		letters = s[:i]
+		row, _ = strconv.Atoi(s[i:])
+	}
+	col = -1
+	for _, r := range letters {
+		col = (col+1)*26 + int(r-'A')
+	}
+	return col, row
+}
+
+// serial is day as Sheets reads it back.
+func serial(day string) float64 {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		panic(err)
+	}
+	return t.Sub(sheetsEpoch).Hours() / 24
+}
@@ -0,0 +1,336 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfinance/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+	"google.golang.org/api/sheets/v4"
+)
+
+// The subscription tab holds one subscription to a row below a header: the
+// ID, name, category, amount, currency and type of its transactions, how
+// often it is charged, the day of the month, the day it starts, its status
+// and the day of the last charge posted. Cancelled subscriptions are kept.
+//
+// Each charge is posted with an import ID naming the subscription and the
+// day, so a charge posted by a run that failed before saving the day it
+// posted through is not posted again.
+
+// subscriptionRow is a subscription and the row it is kept in.
+type subscriptionRow struct {
+	subscription model.Subscription
+	row          int
+}
+
+// readSubscriptions reads the subscription tab. A spreadsheet without one
+// has no subscriptions.
+func (g *GoogleSheetsRepo) readSubscriptions(ctx context.Context, sheetRef string, s settings) ([]subscriptionRow, error) {
+	readRange := fmt.Sprintf("%s!A2:K", g.layout().SubscriptionSheet)
+	resp, err := g.Service.Spreadsheets.Values.Get(sheetRef, readRange).ValueRenderOption("UNFORMATTED_VALUE").Context(ctx).Do()
+	if missingSheet(err) {
+		return nil, nil
+	}
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to retrieve subscriptions", "err", err)
+		return nil, sheetsError(err)
+	}
+
+	var subscriptions []subscriptionRow
+	for i, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		subscription, err := parseSubscriptionRow(row, s)
+		if err != nil {
+			logging.Logger(ctx).Warn("skipping subscription", "row", i+2, "err", err)
+			continue
+		}
+		subscriptions = append(subscriptions, subscriptionRow{subscription: subscription, row: i + 2})
+	}
+	return subscriptions, nil
+}
+
+func parseSubscriptionRow(row []interface{}, s settings) (model.Subscription, error) {
+	if len(row) < 10 {
+		return model.Subscription{}, fmt.Errorf("row has %d of 10 columns", len(row))
+	}
+	cell := func(i int) string {
+		if i >= len(row) {
+			return ""
+		}
+		return fmt.Sprintf("%v", row[i])
+	}
+
+	currency := s.currency
+	if model.ValidCurrency(cell(4)) {
+		currency = cell(4)
+	}
+	amount, err := parseAmount(row[3], currency, s.decimal)
+	if err != nil {
+		return model.Subscription{}, fmt.Errorf("bad value %v for field amount: %w", row[3], err)
+	}
+	subscription := model.Subscription{
+		ID:        cell(0),
+		Name:      cell(1),
+		Category:  cell(2),
+		Amount:    amount,
+		Type:      cell(5),
+		Frequency: cell(6),
+		Status:    cell(9),
+	}
+	if !slices.Contains(model.Types, subscription.Type) {
+		return model.Subscription{}, fmt.Errorf("bad value %v for field type", row[5])
+	}
+	if !slices.Contains(model.Frequencies, subscription.Frequency) {
+		return model.Subscription{}, fmt.Errorf("bad value %v for field frequency", row[6])
+	}
+	if subscription.Day, err = strconv.Atoi(cell(7)); err != nil && subscription.Frequency == model.Monthly {
+		return model.Subscription{}, fmt.Errorf("bad value %v for field day", row[7])
+	}
+	if subscription.Start, err = time.Parse(time.DateOnly, cell(8)); err != nil {
+		return model.Subscription{}, fmt.Errorf("bad value %v for field start", row[8])
+	}
+	if posted := cell(10); posted != "" {
+		day, err := time.Parse(time.DateOnly, posted)
+		if err != nil {
+			return model.Subscription{}, fmt.Errorf("bad value %v for field posted", row[10])
+		}
+		subscription.Posted = &day
+	}
+	return subscription, nil
+}
+
+// subscriptionCells is the row of subscription, written RAW.
+func subscriptionCells(s model.Subscription) []interface{} {
+	day, posted := "", ""
+	if s.Day != 0 {
+		day = strconv.Itoa(s.Day)
+	}
+	if s.Posted != nil {
+		posted = s.Posted.Format(time.DateOnly)
+	}
+	return []interface{}{
+		s.ID, s.Name, s.Category, s.Amount.Float(), s.Amount.Currency, s.Type,
+		s.Frequency, day, s.Start.Format(time.DateOnly), s.Status, posted,
+	}
+}
+
+// Subscriptions lists the subscriptions of sheetRef, cancelled ones
+// included.
+func (g *GoogleSheetsRepo) Subscriptions(ctx context.Context, sheetRef string) ([]model.Subscription, error) {
+	defer metrics.Track(g.Metrics, "Subscriptions")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.Subscriptions")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.readSubscriptions(ctx, sheetRef, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []model.Subscription{}
+	for _, r := range rows {
+		subscriptions = append(subscriptions, r.subscription)
+	}
+	return subscriptions, nil
+}
+
+// AddSubscription adds an active subscription to sheetRef, adding the tab
+// when it is missing. It starts on the user's day of start, or today when
+// start is nil, and a monthly one without a day is charged on the day it
+// starts. An amount without a currency is in the user's.
+func (g *GoogleSheetsRepo) AddSubscription(ctx context.Context, sheetRef string, subscription model.Subscription, start *time.Time) (model.Subscription, error) {
+	defer metrics.Track(g.Metrics, "AddSubscription")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.AddSubscription")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	if subscription.Amount.Currency == "" {
+		if subscription.Amount, err = subscription.Amount.WithCurrency(settings.currency); err != nil {
+			return model.Subscription{}, fmt.Errorf("%w: amount %v", ErrInvalid, err)
+		}
+	}
+	if subscription.ID, err = newID(); err != nil {
+		return model.Subscription{}, err
+	}
+	subscription.Start = model.Day(*localDay(start, settings.loc))
+	if subscription.Frequency == model.Monthly && subscription.Day == 0 {
+		subscription.Day = subscription.Start.Day()
+	}
+	subscription.Status = model.Active
+	subscription.Posted = nil
+
+	layout := g.layout()
+	sheetIDs, err := g.sheetIDs(ctx, sheetRef)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	var rows [][]interface{}
+	if _, ok := sheetIDs[layout.SubscriptionSheet]; !ok {
+		if _, err := g.addSheet(ctx, sheetRef, layout.SubscriptionSheet); err != nil {
+			return model.Subscription{}, err
+		}
+		rows = append(rows, []interface{}{
+			"ID", "Name", "Category", "Amount", "Currency", "Type", "Frequency", "Day", "Start", "Status", "Posted",
+		})
+	}
+	rows = append(rows, subscriptionCells(subscription))
+
+	vr := &sheets.ValueRange{Values: rows}
+	_, err = g.Service.Spreadsheets.Values.Append(sheetRef, layout.SubscriptionSheet+"!A:K", vr).
+		ValueInputOption("RAW").InsertDataOption("INSERT_ROWS").Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to add subscription", "err", err)
+		return model.Subscription{}, sheetsError(err)
+	}
+	return subscription, nil
+}
+
+// SetSubscriptionStatus pauses, resumes or cancels the subscription with
+// id. Charges due while it was paused are skipped when it is resumed, and a
+// cancelled subscription cannot be resumed.
+func (g *GoogleSheetsRepo) SetSubscriptionStatus(ctx context.Context, sheetRef, id, status string) (model.Subscription, error) {
+	defer metrics.Track(g.Metrics, "SetSubscriptionStatus")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.SetSubscriptionStatus")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	rows, err := g.readSubscriptions(ctx, sheetRef, settings)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+
+	i := slices.IndexFunc(rows, func(r subscriptionRow) bool { return r.subscription.ID == id })
+	if i < 0 {
+		return model.Subscription{}, fmt.Errorf("subscription %s: %w", id, ErrNotFound)
+	}
+	subscription := rows[i].subscription
+	switch {
+	case subscription.Status == status:
+		return subscription, nil
+	case subscription.Status == model.Cancelled:
+		return model.Subscription{}, fmt.Errorf("%w: subscription %s was cancelled", ErrInvalid, id)
+	case subscription.Status == model.Paused && status == model.Active:
+		// today's charge is still posted
+		resumed := subscription
+		resumed.Status = model.Active
+		yesterday := localDay(nil, settings.loc).AddDate(0, 0, -1)
+		if skipped := resumed.Due(yesterday); len(skipped) > 0 {
+			subscription.Posted = &skipped[len(skipped)-1]
+		}
+	}
+	subscription.Status = status
+
+	vr := &sheets.ValueRange{Values: [][]interface{}{subscriptionCells(subscription)}}
+	writeRange := fmt.Sprintf("%s!A%d:K%d", g.layout().SubscriptionSheet, rows[i].row, rows[i].row)
+	_, err = g.Service.Spreadsheets.Values.Update(sheetRef, writeRange, vr).ValueInputOption("RAW").Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to update subscription", "err", err)
+		return model.Subscription{}, sheetsError(err)
+	}
+	return subscription, nil
+}
+
+// UpcomingCharges lists the charges of the active subscriptions of
+// sheetRef not yet posted, through days from today in the user's time zone.
+func (g *GoogleSheetsRepo) UpcomingCharges(ctx context.Context, sheetRef string, days int) ([]model.Charge, error) {
+	defer metrics.Track(g.Metrics, "UpcomingCharges")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.UpcomingCharges")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.readSubscriptions(ctx, sheetRef, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]model.Subscription, len(rows))
+	for i, r := range rows {
+		subscriptions[i] = r.subscription
+	}
+	return model.Upcoming(subscriptions, localDay(nil, settings.loc).AddDate(0, 0, days)), nil
+}
+
+// chargeID is the import ID of the charge of subscription on day.
+func chargeID(subscription model.Subscription, day time.Time) string {
+	return "subscription:" + subscription.ID + ":" + day.Format(time.DateOnly)
+}
+
+// PostSubscriptions posts every charge due up to today, in the user's time
+// zone, that has not been posted, catching up on those missed while the
+// service was down. It returns the transactions posted.
+func (g *GoogleSheetsRepo) PostSubscriptions(ctx context.Context, sheetRef string) ([]model.Transaction, error) {
+	defer metrics.Track(g.Metrics, "PostSubscriptions")()
+	ctx, span := tracing.Start(ctx, "GoogleSheetsRepo.PostSubscriptions")
+	defer span.End()
+
+	settings, err := g.settings(ctx, sheetRef)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := g.readSubscriptions(ctx, sheetRef, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	today := *localDay(nil, settings.loc)
+	var transactions []model.Transaction
+	var posted []*sheets.ValueRange
+	for _, r := range rows {
+		due := r.subscription.Due(today)
+		if len(due) == 0 {
+			continue
+		}
+		for _, day := range due {
+			date := calendarDay(day, settings.loc)
+			transactions = append(transactions, model.Transaction{
+				DateCreated: &date,
+				Name:        r.subscription.Name,
+				Category:    r.subscription.Category,
+				Amount:      r.subscription.Amount,
+				Type:        r.subscription.Type,
+				ImportID:    chargeID(r.subscription, day),
+			})
+		}
+		posted = append(posted, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!K%d", g.layout().SubscriptionSheet, r.row),
+			Values: [][]interface{}{{due[len(due)-1].Format(time.DateOnly)}},
+		})
+	}
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+
+	// the charges are saved before the days they were posted through, so a
+	// failure in between leaves them to be skipped as already imported
+	written, _, err := g.Import(ctx, sheetRef, transactions)
+	if err != nil {
+		return nil, err
+	}
+	req := &sheets.BatchUpdateValuesRequest{ValueInputOption: "RAW", Data: posted}
+	_, err = g.Service.Spreadsheets.Values.BatchUpdate(sheetRef, req).Context(ctx).Do()
+	if err != nil {
+		logging.Logger(ctx).Error("Unable to record posted subscriptions", "err", err)
+		return nil, sheetsError(err)
+	}
+	return written, nil
+}
@@ -0,0 +1,135 @@
+package statement
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func parseCSV(content string, opts Options) ([]Line, error) {
+	m := opts.Mapping
+	r := csv.NewReader(strings.NewReader(content))
+	if m.Delimiter != "" {
+		r.Comma, _ = utf8.DecodeRuneInString(m.Delimiter)
+	}
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("csv: missing the header")
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	// column returns the index of a column, or -1 for one not mapped
+	column := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := columns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return 0, fmt.Errorf("csv: no column %q", name)
+		}
+		return i, nil
+	}
+
+	var idx csvColumns
+	for _, c := range []struct {
+		i    *int
+		name string
+	}{
+		{&idx.date, m.Date}, {&idx.name, m.Name}, {&idx.amount, m.Amount}, {&idx.debit, m.Debit},
+		{&idx.credit, m.Credit}, {&idx.category, m.Category}, {&idx.currency, m.Currency},
+	} {
+		if *c.i, err = column(c.name); err != nil {
+			return nil, err
+		}
+	}
+	if idx.date < 0 || idx.name < 0 || (idx.amount < 0 && idx.debit < 0 && idx.credit < 0) {
+		return nil, errors.New("csv: the mapping needs a date, a name and an amount or debit and credit")
+	}
+
+	cell := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var lines []Line
+	for n, record := range records[1:] {
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		line, err := csvLine(record, cell, idx, m, opts.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("csv: line %d: %w", n+2, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// csvColumns are the indexes of the columns of a CSV statement, -1 for
+// those not mapped.
+type csvColumns struct {
+	date, name, amount, debit, credit, category, currency int
+}
+
+func csvLine(record []string, cell func([]string, int) string, idx csvColumns, m model.Mapping, currency string) (Line, error) {
+	date, err := time.Parse(m.Layout(), cell(record, idx.date))
+	if err != nil {
+		return Line{}, fmt.Errorf("bad date %q", cell(record, idx.date))
+	}
+	if c := cell(record, idx.currency); model.ValidCurrency(c) {
+		currency = c
+	}
+
+	var amount model.Money
+	switch debit, credit := cell(record, idx.debit), cell(record, idx.credit); {
+	case idx.amount >= 0:
+		if amount, err = model.ParseMoney(cell(record, idx.amount), currency, 0); err != nil {
+			return Line{}, err
+		}
+		if m.ExpensesPositive {
+			amount.Minor = -amount.Minor
+		}
+	case debit != "":
+		if amount, err = model.ParseMoney(debit, currency, 0); err != nil {
+			return Line{}, err
+		}
+		amount.Minor = -abs(amount.Minor)
+	case credit != "":
+		if amount, err = model.ParseMoney(credit, currency, 0); err != nil {
+			return Line{}, err
+		}
+		amount.Minor = abs(amount.Minor)
+	default:
+		return Line{}, errors.New("has no amount")
+	}
+
+	return Line{
+		Date:     date,
+		Name:     cell(record, idx.name),
+		Amount:   amount,
+		Category: cell(record, idx.category),
+	}, nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
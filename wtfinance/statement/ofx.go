@@ -0,0 +1,85 @@
+package statement
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+// parseOFX reads the STMTTRN elements of an OFX or QFX statement, each of
+// the account whose BANKACCTFROM or CCACCTFROM came last before it, as a
+// file may hold the statements of several. Version 1 is SGML, which does not
+// close elements holding a value, and version 2 is XML, which does; reading
+// a value up to the next tag handles both.
+func parseOFX(content string, opts Options) ([]Line, error) {
+	upper := strings.ToUpper(content)
+	if !strings.Contains(upper, "<OFX>") {
+		return nil, errors.New("ofx: not an OFX statement")
+	}
+
+	currency := opts.Currency
+	if c := ofxValue(content, "CURDEF"); model.ValidCurrency(c) {
+		currency = c
+	}
+
+	var lines []Line
+	blocks := strings.Split(content, "<STMTTRN>")
+	account := ofxAccount(blocks[0], "")
+	for n, block := range blocks[1:] {
+		block, after, _ := strings.Cut(block, "</STMTTRN>")
+
+		posted := ofxValue(block, "DTPOSTED")
+		if len(posted) < 8 {
+			return nil, fmt.Errorf("ofx: transaction %d: bad date %q", n+1, posted)
+		}
+		date, err := time.Parse("20060102", posted[:8])
+		if err != nil {
+			return nil, fmt.Errorf("ofx: transaction %d: bad date %q", n+1, posted)
+		}
+		amount, err := model.ParseMoney(ofxValue(block, "TRNAMT"), currency, 0)
+		if err != nil {
+			return nil, fmt.Errorf("ofx: transaction %d: %w", n+1, err)
+		}
+
+		name := ofxValue(block, "NAME")
+		if name == "" {
+			name = ofxValue(block, "MEMO")
+		}
+		lines = append(lines, Line{
+			Date:     date,
+			Name:     name,
+			Amount:   amount,
+			BankID:   ofxValue(block, "FITID"),
+			Account:  account,
+			Transfer: ofxValue(block, "TRNTYPE") == "XFER",
+		})
+		account = ofxAccount(after, account)
+	}
+	return lines, nil
+}
+
+// ofxAccount is the bank's and account's ID of the last account s starts the
+// statement of, or account when s starts none. A credit card's has no bank ID.
+func ofxAccount(s, account string) string {
+	i := max(strings.LastIndex(s, "<BANKACCTFROM>"), strings.LastIndex(s, "<CCACCTFROM>"))
+	if i < 0 {
+		return account
+	}
+	_, from, _ := strings.Cut(s[i:], ">")
+	from, _, _ = strings.Cut(from, "ACCTFROM>")
+	return ofxValue(from, "BANKID") + "/" + ofxValue(from, "ACCTID")
+}
+
+// ofxValue is the value of the first element named tag in s.
+func ofxValue(s, tag string) string {
+	_, rest, ok := strings.Cut(s, "<"+tag+">")
+	if !ok {
+		return ""
+	}
+	value, _, _ := strings.Cut(rest, "<")
+	return html.UnescapeString(strings.TrimSpace(value))
+}
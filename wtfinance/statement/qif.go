@@ -0,0 +1,104 @@
+package statement
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+// parseQIF reads the records of a QIF statement: a field to a line, each
+// starting with its code, and a ^ ending each record.
+func parseQIF(content string, opts Options) ([]Line, error) {
+	var lines []Line
+	var line Line
+	var memo string
+	started, n := false, 0
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "!") {
+			continue
+		}
+		code, value := text[0], strings.TrimSpace(text[1:])
+
+		var err error
+		switch code {
+		case 'D':
+			line.Date, err = qifDate(value)
+		case 'T', 'U':
+			line.Amount, err = model.ParseMoney(value, opts.Currency, 0)
+		case 'P':
+			line.Name = value
+		case 'M':
+			memo = value
+		case 'L':
+			// a category in brackets is the account money moved to or from
+			if strings.HasPrefix(value, "[") {
+				line.Transfer = true
+			} else {
+				line.Category = value
+			}
+		case '^':
+			n++
+			if line.Date.IsZero() {
+				return nil, fmt.Errorf("qif: record %d has no date", n)
+			}
+			if line.Name == "" {
+				line.Name = memo
+			}
+			lines = append(lines, line)
+			line, memo, started = Line{}, "", false
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("qif: record %d: %w", n+1, err)
+		}
+		started = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("qif: %w", err)
+	}
+	if started {
+		return nil, fmt.Errorf("qif: record %d is not ended with ^", n+1)
+	}
+	return lines, nil
+}
+
+// qifDate reads a QIF date, like 5/1/2024, 5/1'24 or 05-01-24. Days and
+// months are taken in the American order QIF was made with, unless the
+// first is over 12.
+func qifDate(value string) (time.Time, error) {
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return r == '/' || r == '\'' || r == '-' || r == '.'
+	})
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("bad date %q", value)
+	}
+
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad date %q", value)
+		}
+		n[i] = v
+	}
+
+	month, day, year := n[0], n[1], n[2]
+	if month > 12 {
+		month, day = day, month
+	}
+	if year < 100 {
+		year += 2000
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return time.Time{}, fmt.Errorf("bad date %q", value)
+	}
+	return date, nil
+}
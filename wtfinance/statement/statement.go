@@ -0,0 +1,111 @@
+// Package statement reads the transactions of the statements banks export:
+// CSV, laid out as a model.Mapping says, OFX or QFX, and QIF.
+package statement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+// Formats of statement.
+const (
+	CSV = "csv"
+	OFX = "ofx"
+	QFX = "qfx"
+	QIF = "qif"
+)
+
+// Line is a transaction of a statement.
+type Line struct {
+	// the day, as midnight UTC
+	Date time.Time
+	Name string
+	// negative for money that left the account
+	Amount   model.Money
+	Category string
+	// the bank's ID of the transaction, when it has one
+	BankID string
+	// the account the statement is of, when it says, as the bank's ID and
+	// the account's, since a bank's IDs are only unique within an account
+	Account string
+	// money moved to or from another of the user's accounts
+	Transfer bool
+}
+
+// Options are what reading a statement may need besides its content.
+type Options struct {
+	// the currency of amounts the statement does not give one for, or
+	// empty for the user's
+	Currency string
+	// how a CSV statement is laid out
+	Mapping model.Mapping
+}
+
+// Parse reads the lines of a statement in format.
+func Parse(format, content string, opts Options) ([]Line, error) {
+	// a byte order mark is left by some spreadsheet exports
+	content = strings.TrimPrefix(content, "\ufeff")
+
+	switch format {
+	case CSV:
+		return parseCSV(content, opts)
+	case OFX, QFX:
+		return parseOFX(content, opts)
+	case QIF:
+		return parseQIF(content, opts)
+	}
+	return nil, fmt.Errorf("unknown statement format %q", format)
+}
+
+// Transaction is the transaction line records: an expense for money that
+// left the account, income for money that came in, or a transfer, with a
+// positive amount.
+func (l Line) Transaction(category string) model.Transaction {
+	date := l.Date
+	t := model.Transaction{
+		DateCreated: &date,
+		Name:        l.Name,
+		Category:    category,
+		Amount:      l.Amount,
+		Type:        model.Expense,
+	}
+	if l.Category != "" {
+		t.Category = l.Category
+	}
+	switch {
+	case l.Transfer:
+		t.Type = model.Transfer
+	case l.Amount.Minor > 0:
+		t.Type = model.Income
+	}
+	if t.Amount.Minor < 0 {
+		t.Amount.Minor = -t.Amount.Minor
+	}
+	return t
+}
+
+// ImportIDs identifies each line, so importing it again is noticed: by the
+// bank's ID and the account when it has one, or else by its day, amount and
+// name, counting repeats, like two coffees on the same day.
+func ImportIDs(lines []Line) []string {
+	ids := make([]string, len(lines))
+	seen := map[string]int{}
+	for i, l := range lines {
+		key := "bank:" + l.BankID
+		if l.Account != "" {
+			key = "bank:" + l.Account + "/" + l.BankID
+		}
+		if l.BankID == "" {
+			key = fmt.Sprintf("%s|%s|%s", l.Date.Format(time.DateOnly), l.Amount, strings.ToLower(l.Name))
+		}
+		seen[key]++
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", key, seen[key])))
+		ids[i] = hex.EncodeToString(sum[:8])
+	}
+	return ids
+}
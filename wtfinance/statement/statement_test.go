@@ -0,0 +1,248 @@
+package statement
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfinance/model"
+)
+
+func day(s string) time.Time {
+	d, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func cad(minor int64) model.Money { return model.Money{Minor: minor, Currency: "CAD"} }
+
+const ofxV1 = `OFXHEADER:100
+DATA:OFXSGML
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKACCTFROM>
+<BANKID>021000021
+<ACCTID>1234
+<ACCTTYPE>CHECKING
+</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240501120000[-5:EST]
+<TRNAMT>-12.50
+<FITID>A1
+<NAME>Corner Caf&eacute;
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>XFER
+<DTPOSTED>20240502
+<TRNAMT>200.00
+<FITID>A2
+<MEMO>From savings
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxV2 = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>CREDIT</TRNTYPE><DTPOSTED>20240503</DTPOSTED><TRNAMT>1500.00</TRNAMT><FITID>B1</FITID><NAME>Payroll</NAME></STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>
+`
+
+const qif = `!Type:Bank
+D5/1/2024
+T-12.50
+PCorner Cafe
+LFood
+^
+D13/05'24
+U1,500.00
+MPayroll
+^
+D05-20-24
+T-200.00
+PTo savings
+L[Savings]
+^
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		opts    Options
+		want    []Line
+	}{
+		{
+			name:    "csv with a signed amount",
+			format:  CSV,
+			content: "\ufeffDate,Description,Amount,Category\n2024-05-01,Corner Cafe,-12.50,Food\n\n2024-05-02, Payroll ,\"1,500.00\",\n",
+			opts:    Options{Currency: "CAD", Mapping: model.Mapping{Date: "date", Name: "description", Amount: "amount", Category: "Category"}},
+			want: []Line{
+				{Date: day("2024-05-01"), Name: "Corner Cafe", Amount: cad(-1250), Category: "Food"},
+				{Date: day("2024-05-02"), Name: "Payroll", Amount: cad(150000)},
+			},
+		},
+		{
+			name:    "csv with expenses positive",
+			format:  CSV,
+			content: "Date;Name;Amount\n01/05/2024;Corner Cafe;12,50\n",
+			opts:    Options{Currency: "EUR", Mapping: model.Mapping{Delimiter: ";", Date: "Date", DateFormat: "DD/MM/YYYY", Name: "Name", Amount: "Amount", ExpensesPositive: true}},
+			want: []Line{
+				{Date: day("2024-05-01"), Name: "Corner Cafe", Amount: model.Money{Minor: -1250, Currency: "EUR"}},
+			},
+		},
+		{
+			name:    "csv with debit and credit",
+			format:  CSV,
+			content: "Date,Name,Debit,Credit,Currency\n2024-05-01,Corner Cafe,12.50,,\n2024-05-02,Payroll,,1500,USD\n",
+			opts:    Options{Currency: "CAD", Mapping: model.Mapping{Date: "Date", Name: "Name", Debit: "Debit", Credit: "Credit", Currency: "Currency"}},
+			want: []Line{
+				{Date: day("2024-05-01"), Name: "Corner Cafe", Amount: cad(-1250)},
+				{Date: day("2024-05-02"), Name: "Payroll", Amount: model.Money{Minor: 150000, Currency: "USD"}},
+			},
+		},
+		{
+			name:    "ofx 1",
+			format:  OFX,
+			content: ofxV1,
+			opts:    Options{Currency: "CAD"},
+			want: []Line{
+				{Date: day("2024-05-01"), Name: "Corner Café", Amount: model.Money{Minor: -1250, Currency: "USD"}, BankID: "A1", Account: "021000021/1234"},
+				{Date: day("2024-05-02"), Name: "From savings", Amount: model.Money{Minor: 20000, Currency: "USD"}, BankID: "A2", Account: "021000021/1234", Transfer: true},
+			},
+		},
+		{
+			name:    "ofx 2",
+			format:  QFX,
+			content: ofxV2,
+			opts:    Options{Currency: "CAD"},
+			want: []Line{
+				{Date: day("2024-05-03"), Name: "Payroll", Amount: cad(150000), BankID: "B1"},
+			},
+		},
+		{
+			name:    "qif",
+			format:  QIF,
+			content: qif,
+			opts:    Options{Currency: "CAD"},
+			want: []Line{
+				{Date: day("2024-05-01"), Name: "Corner Cafe", Amount: cad(-1250), Category: "Food"},
+				{Date: day("2024-05-13"), Name: "Payroll", Amount: cad(150000)},
+				{Date: day("2024-05-20"), Name: "To savings", Amount: cad(-20000), Transfer: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.format, tt.content, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	mapping := model.Mapping{Date: "Date", Name: "Name", Amount: "Amount"}
+
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		mapping model.Mapping
+	}{
+		{"unknown format", "xlsx", "", mapping},
+		{"csv without a header", CSV, "", mapping},
+		{"csv without a mapped column", CSV, "Date,Description,Amount\n", mapping},
+		{"csv mapping without an amount", CSV, "Date,Name\n", model.Mapping{Date: "Date", Name: "Name"}},
+		{"csv with a bad date", CSV, "Date,Name,Amount\n05/01/2024,Cafe,-12.50\n", mapping},
+		{"csv with a bad amount", CSV, "Date,Name,Amount\n2024-05-01,Cafe,twelve\n", mapping},
+		{"csv without an amount", CSV, "Date,Name,Debit,Credit\n2024-05-01,Cafe,,\n", model.Mapping{Date: "Date", Name: "Name", Debit: "Debit", Credit: "Credit"}},
+		{"not ofx", OFX, "Date,Name,Amount\n", mapping},
+		{"ofx with a bad date", OFX, "<OFX><STMTTRN><DTPOSTED>May 1<TRNAMT>1.00</STMTTRN></OFX>", mapping},
+		{"ofx with a bad amount", OFX, "<OFX><STMTTRN><DTPOSTED>20240501<TRNAMT>one</STMTTRN></OFX>", mapping},
+		{"qif without a date", QIF, "!Type:Bank\nT-12.50\n^\n", mapping},
+		{"qif with a bad date", QIF, "!Type:Bank\nD2/30/2024\n^\n", mapping},
+		{"qif not ended", QIF, "!Type:Bank\nD5/1/2024\nT-12.50\n", mapping},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lines, err := Parse(tt.format, tt.content, Options{Currency: "CAD", Mapping: tt.mapping}); err == nil {
+				t.Errorf("got %+v, want an error", lines)
+			}
+		})
+	}
+}
+
+func TestImportIDs(t *testing.T) {
+	coffee := Line{Date: day("2024-05-01"), Name: "Cafe", Amount: cad(-500)}
+	lines := []Line{
+		coffee,
+		coffee,
+		{Date: day("2024-05-01"), Name: "CAFE", Amount: cad(-500)},
+		{Date: day("2024-05-01"), Name: "Cafe", Amount: cad(-500), BankID: "A1"},
+	}
+	ids := ImportIDs(lines)
+	if ids[0] == ids[1] {
+		t.Error("two coffees on the same day have the same ID")
+	}
+	if ids[2] != ImportIDs([]Line{coffee, coffee, coffee})[2] {
+		t.Error("the ID of a repeat depends on the case of the name")
+	}
+	if ids[3] == ids[0] || ids[3] != ImportIDs([]Line{{BankID: "A1"}})[0] {
+		t.Error("a line with a bank ID is not identified by it")
+	}
+}
+
+func TestImportIDsTellAccountsApart(t *testing.T) {
+	// a checking account and a credit card, in one file, whose banks both
+	// number their transactions from 1
+	const content = `<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<BANKACCTFROM><BANKID>021000021<ACCTID>1234<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240501<TRNAMT>-5.00<FITID>1<NAME>Cafe</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+<CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CCACCTFROM><ACCTID>4111</CCACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240501<TRNAMT>-5.00<FITID>1<NAME>Cafe</STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+	lines, err := Parse(OFX, content, Options{Currency: "CAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Account != "021000021/1234" || lines[1].Account != "/4111" {
+		t.Fatalf("got %+v, want a line of each account", lines)
+	}
+
+	ids := ImportIDs(lines)
+	if ids[0] == ids[1] {
+		t.Error("lines of two accounts with the same bank ID have the same ID")
+	}
+	if again := ImportIDs(lines[1:]); again[0] != ids[1] {
+		t.Error("the ID of a line depends on the lines of other accounts")
+	}
+	other := lines[0]
+	other.Account = "021000021/5678"
+	if ImportIDs([]Line{other})[0] == ids[0] {
+		t.Error("lines of two accounts of a bank with the same bank ID have the same ID")
+	}
+}
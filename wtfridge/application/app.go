@@ -2,70 +2,104 @@ package application
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
 	"net/http"
-	"time"
+	"os"
 
 	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform/health"
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/server"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfridge/handler"
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
 )
 
 type App struct {
-	router http.Handler
-	fdb    *firestore.Client
-	config Config
+	router  http.Handler
+	fdb     *firestore.Client
+	config  Config
+	logger  *slog.Logger
+	metrics *metrics.Prometheus
+	health  *health.Registry
+	server  *server.Server
+	// calls the other service, over TLS when it is configured
+	transport http.RoundTripper
 }
 
 func New(ctx context.Context, cfg Config) (*App, error) {
-	client, err := firestore.NewClient(ctx, cfg.Secrets.ProjectID)
+	logger := logging.New(os.Stdout, cfg.LogLevel)
+
+	shutdownTracing, err := tracing.Setup(ctx, "wtfridge", cfg.TraceExporter)
 	if err != nil {
-		fmt.Println("failed to connect to firebase client", err)
+		logger.Error("failed to set up tracing", "err", err)
 		return nil, err
 	}
 
-	app := &App{
-		fdb:    client,
-		config: cfg,
+	// a span for every Firestore RPC shows how many round trips a request
+	// costs
+	client, err := firestore.NewClient(ctx, cfg.Secrets.ProjectID,
+		option.WithGRPCDialOption(grpc.WithStatsHandler(otelgrpc.NewClientHandler())),
+	)
+	if err != nil {
+		logger.Error("failed to connect to firebase client", "err", err)
+		return nil, err
 	}
-	app.loadRoutes()
 
-	return app, nil
-}
-
-func (a *App) Start(ctx context.Context) error {
-	server := &http.Server{
-		Addr:        fmt.Sprintf(":%d", a.config.ServerPort),
-		Handler:     a.router,
-		IdleTimeout: 30 * time.Second,
+	app := &App{
+		fdb:     client,
+		config:  cfg,
+		logger:  logger,
+		metrics: metrics.NewPrometheus("wtfridge"),
+		health:  &health.Registry{Timeout: cfg.ReadinessTimeout},
 	}
 
-	defer func() {
-		if err := a.fdb.Close(); err != nil {
-			fmt.Println("failed to close firebase", err)
-		}
-	}()
+	repo := &item.FirebaseRepo{Client: client, Metrics: app.metrics}
+	// without Firestore every request would fail, so the server refuses to
+	// start until it can be reached
+	app.health.Register("firestore", repo.Ping)
 
-	fmt.Println("Starting server")
-
-	ch := make(chan error, 1)
+	app.server = &server.Server{
+		Config: cfg.Config,
+		Health: app.health,
+		Logger: logger,
+	}
+	app.transport, err = app.server.Transport()
+	if err != nil {
+		logger.Error("failed to load certificates", "err", err)
+		return nil, err
+	}
 
-	go func() {
-		err := server.ListenAndServe()
-		if err != nil {
-			ch <- fmt.Errorf("failed to start server: %w", err)
-		}
-		close(ch)
-	}()
+	app.loadRoutes()
+	app.server.Handler = server.Chain(app.router,
+		logging.Middleware(logger),
+		metrics.Middleware(app.metrics),
+		tracing.Middleware(metrics.Route),
+	)
 
-	select {
-	case err := <-ch:
-		return err
+	// hooks run last to first, so spans recorded while closing Firestore
+	// are still flushed
+	app.server.OnShutdown("tracing", shutdownTracing)
+	app.server.OnShutdown("firestore", func(context.Context) error {
+		return client.Close()
+	})
 
-	case <-ctx.Done():
-		timeout, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+	app.server.Go("resume deletions", func(ctx context.Context) error {
+		return handler.ResumeDeletions(ctx, repo)
+	})
+	app.server.Go("count list items", func(ctx context.Context) error {
+		app.recordListItems(ctx, repo)
+		return nil
+	})
 
-		return server.Shutdown(timeout)
-	}
+	return app, nil
+}
 
-	return nil
+// Start serves requests until ctx is done, once Firestore can be reached.
+func (a *App) Start(ctx context.Context) error {
+	return a.server.Run(ctx)
 }
@@ -2,48 +2,129 @@ package application
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
-	"strconv"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/config"
+	"github.com/NathanRJohnson/live-backend/platform/server"
 )
 
 type Config struct {
-	ServerPort  uint16
-	SecretsPath string
+	// the port, timeouts, log level and trace exporter
+	server.Config
+	SecretsPath string `config:"secrets_path" usage:"path of the Firebase service account key"`
 	Secrets     FirebaseSecrets
+	SessionKey  string        `config:"session_key" secret:"true" required:"true" usage:"key signing session tokens"`
+	RefreshKey  string        `config:"refresh_key" secret:"true" required:"true" usage:"key signing refresh tokens"`
+	SessionTTL  time.Duration `config:"session_ttl" usage:"how long session tokens are valid"`
+	RefreshTTL  time.Duration `config:"refresh_ttl" usage:"how long refresh tokens are valid"`
+	// used to include finance transactions in user exports
+	FinanceURL     string        `config:"finance_api_url" usage:"base URL of the finance service"`
+	FinanceTimeout time.Duration `config:"finance_timeout" usage:"how long to wait on the finance service"`
+	// where sign-in rate limits are kept, "memory" or "firestore"
+	RateLimitBackend string `config:"rate_limit_backend" usage:"memory or firestore"`
+	// the X-Real-IP header is only believed from these, so clients cannot
+	// pick the address they are rate limited by
+	TrustedProxies []string `config:"trusted_proxies" usage:"addresses or CIDR ranges of the proxies setting X-Real-IP"`
 }
 
-func LoadConfig() Config {
+// LoadConfig loads the configuration from defaults, the config file,
+// environment variables and args, then reads the Firebase key it names.
+// args are nil for commands with flags of their own.
+func LoadConfig(args []string) (Config, error) {
 	currentDir, err := filepath.Abs(filepath.Dir("."))
 	if err != nil {
-		fmt.Println("Error getting current directory", err)
+		return Config{}, fmt.Errorf("unable to get current directory: %w", err)
 	}
 
 	// local config init
 	cfg := Config{
-		ServerPort:  3000,
-		SecretsPath: filepath.Join(currentDir, "../secrets/firebase-serviceKey.json"),
+		Config:           server.DefaultConfig,
+		SecretsPath:      filepath.Join(currentDir, "../secrets/firebase-serviceKey.json"),
+		SessionTTL:       30 * time.Minute,
+		RefreshTTL:       6 * time.Hour,
+		FinanceTimeout:   30 * time.Second,
+		RateLimitBackend: "memory",
 	}
 
-	// load variables from docker environment
-	if serverPort, exists := os.LookupEnv("SERVER_PORT"); exists {
-		if port, err := strconv.ParseUint(serverPort, 10, 16); err == nil {
-			cfg.ServerPort = uint16(port)
-		}
+	loader := config.Loader{Name: "wtfridge", Args: args}
+	err = loader.Load(&cfg)
+	if errors.Is(err, config.ErrPrinted) {
+		return cfg, err
 	}
 
-	if _, exists := os.LookupEnv("SECRETS_PATH"); exists {
-		cfg.SecretsPath = "/run/secrets/serviceKey"
+	// a missing key file is reported along with any invalid values
+	secrets, secretsErr := loadSecrets(cfg.SecretsPath)
+	if err != nil || secretsErr != nil {
+		return cfg, errors.Join(err, secretsErr)
 	}
+	cfg.Secrets = *secrets
 
-	secrets, err := loadSecrets(cfg.SecretsPath)
-	if err != nil {
-		fmt.Println("Cannot load secrets", err)
+	return cfg, nil
+}
+
+// Validate checks the values that parse but make no sense.
+func (c *Config) Validate() error {
+	errs := []error{c.Config.Validate()}
+
+	if c.SecretsPath == "" {
+		errs = append(errs, errors.New("secrets_path is required"))
 	}
-	cfg.Secrets = *secrets
+	if c.SessionKey != "" && c.SessionKey == c.RefreshKey {
+		errs = append(errs, errors.New("session_key and refresh_key must differ"))
+	}
+	if c.RefreshTTL < c.SessionTTL {
+		errs = append(errs, errors.New("refresh_ttl must not be shorter than session_ttl"))
+	}
+	if c.FinanceURL != "" {
+		if u, err := url.Parse(c.FinanceURL); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("finance_api_url %q is not an absolute URL", c.FinanceURL))
+		}
+	}
+	if !server.OneOf(c.RateLimitBackend, "memory", "firestore") {
+		errs = append(errs, fmt.Errorf("rate_limit_backend %q must be memory or firestore", c.RateLimitBackend))
+	}
+	if _, err := c.trustedProxies(); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"session_ttl", c.SessionTTL},
+		{"refresh_ttl", c.RefreshTTL},
+		{"finance_timeout", c.FinanceTimeout},
+	} {
+		if d.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", d.key))
+		}
+	}
+
+	return errors.Join(errs...)
+}
 
-	return cfg
+// trustedProxies parses TrustedProxies, where a lone address is a range of
+// one.
+func (c *Config) trustedProxies() ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedProxies))
+	for _, p := range c.TrustedProxies {
+		if addr, err := netip.ParseAddr(p); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies %q is not an address or CIDR range", p)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
 }
 
 type FirebaseSecrets struct {
@@ -53,15 +134,17 @@ type FirebaseSecrets struct {
 func loadSecrets(secretsPath string) (*FirebaseSecrets, error) {
 	data, err := os.ReadFile(secretsPath)
 	if err != nil {
-		fmt.Println("error reading secrets file:", err)
-		return nil, err
+		return nil, fmt.Errorf("unable to read secrets: %w", err)
 	}
 
 	var secrets FirebaseSecrets
 	err = json.Unmarshal(data, &secrets)
 	if err != nil {
-		fmt.Println("error parsing secrets", err)
-		return nil, err
+		return nil, fmt.Errorf("unable to parse secrets in %s: %w", secretsPath, err)
+	}
+
+	if secrets.ProjectID == "" {
+		return nil, fmt.Errorf("%s has no project_id", secretsPath)
 	}
 
 	return &secrets, nil
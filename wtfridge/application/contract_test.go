@@ -0,0 +1,89 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform/health"
+	"github.com/NathanRJohnson/live-backend/wtfridge/docs"
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
+)
+
+func newContractApp(t *testing.T) *App {
+	// nothing listens here, and requests are cancelled before they are
+	// served, so Firestore is never reached
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "127.0.0.1:1")
+	client, err := firestore.NewClient(context.Background(), "contract-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	app := &App{
+		fdb: client,
+		config: Config{
+			SessionKey:       "contract-session",
+			RefreshKey:       "contract-refresh",
+			RateLimitBackend: "memory",
+		},
+		metrics: metrics.NewPrometheus("wtfridge"),
+		health:  &health.Registry{},
+	}
+	app.loadRoutes()
+	return app
+}
+
+// Every documented operation is routed, and what it answers a request
+// without credentials is documented too.
+func TestDocumentedOperationsAreRouted(t *testing.T) {
+	contract, err := docs.LoadContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newContractApp(t)
+
+	for _, op := range contract.Operations() {
+		t.Run(op.ID, func(t *testing.T) {
+			var body []byte
+			if op.HasBody() {
+				body, err = op.Example()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			path := strings.ReplaceAll(op.Path, "{id}", "1")
+			r := httptest.NewRequest(op.Method, path, bytes.NewReader(body)).WithContext(ctx)
+
+			rec := httptest.NewRecorder()
+			app.router.ServeHTTP(rec, r)
+
+			if rec.Code == http.StatusNotFound || rec.Code == http.StatusMethodNotAllowed {
+				t.Fatalf("%s is not routed: %d", op, rec.Code)
+			}
+			if op.Secured && rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s without credentials got %d, want 401", op, rec.Code)
+			}
+			if err := op.CheckResponse(rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDocsAreServed(t *testing.T) {
+	app := newContractApp(t)
+
+	rec := httptest.NewRecorder()
+	app.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/openapi.yaml", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), docs.Spec) {
+		t.Errorf("GET /docs/openapi.yaml = %d, want the document", rec.Code)
+	}
+}
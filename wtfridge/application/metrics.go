@@ -0,0 +1,55 @@
+package application
+
+import (
+	"context"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// list sizes change slowly, and counting them costs a read per list
+const listItemsInterval = 5 * time.Minute
+
+// recordListItems updates the list item gauges until ctx is done.
+func (a *App) recordListItems(ctx context.Context, repo *item.FirebaseRepo) {
+	ticker := time.NewTicker(listItemsInterval)
+	defer ticker.Stop()
+
+	for {
+		err := a.countListItems(ctx, repo)
+		if err != nil {
+			a.logger.Error("failed to count list items", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) countListItems(ctx context.Context, repo *item.FirebaseRepo) error {
+	users, err := repo.FetchUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	lists := make([]metrics.ListItems, 0, len(users))
+	for _, user := range users {
+		counts, err := repo.CountListItems(ctx, user.Username)
+		if err != nil {
+			return err
+		}
+		lists = append(lists, metrics.ListItems{
+			Username:       user.Username,
+			Fridge:         counts.Fridge,
+			Grocery:        counts.Grocery,
+			PendingGrocery: counts.PendingGrocery,
+		})
+	}
+
+	a.metrics.SetListItems(lists)
+	return nil
+}
@@ -3,7 +3,12 @@ package application
 import (
 	"net/http"
 
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfridge/docs"
 	handler "github.com/NathanRJohnson/live-backend/wtfridge/handler"
+	"github.com/NathanRJohnson/live-backend/wtfridge/limiter"
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
 	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
 )
 
@@ -13,40 +18,130 @@ func (a *App) loadRoutes() {
 	fridgeRouter := http.NewServeMux()
 	a.loadFridgeRoutes(fridgeRouter)
 
-	router.Handle("/fridge/", http.StripPrefix("/fridge", fridgeRouter))
+	router.Handle("/fridge/", http.StripPrefix("/fridge", metrics.Routes("/fridge", fridgeRouter)))
 
 	groceryRouter := http.NewServeMux()
 	a.loadGroceryRoutes(groceryRouter)
 
-	router.Handle("/grocery/", http.StripPrefix("/grocery", groceryRouter))
+	router.Handle("/grocery/", http.StripPrefix("/grocery", metrics.Routes("/grocery", groceryRouter)))
 
-	a.router = router
+	userRouter := http.NewServeMux()
+	a.loadUserRoutes(userRouter)
+
+	router.Handle("/user/", http.StripPrefix("/user", metrics.Routes("/user", userRouter)))
+
+	router.HandleFunc("GET /healthz", a.health.Live)
+	router.HandleFunc("GET /readyz", a.health.Ready)
+	router.Handle("GET /metrics", a.metrics.Handler())
+	router.Handle("GET /docs/", docs.Handler("wtfridge"))
+
+	a.router = metrics.Routes("", router)
 }
 
 func (a *App) loadFridgeRoutes(router *http.ServeMux) {
 	fridgeHandler := &handler.Item{
 		Repo: &item.FirebaseRepo{
-			Client: a.fdb,
+			Client:  a.fdb,
+			Metrics: a.metrics,
 		},
 	}
-	router.HandleFunc("POST /", fridgeHandler.Create)
-	router.HandleFunc("GET /", fridgeHandler.List)
+	auth := &handler.Auth{
+		Repo: fridgeHandler.Repo,
+	}
+	router.HandleFunc("POST /{$}", auth.Require(model.ScopeFridgeWrite, fridgeHandler.Create))
+	router.HandleFunc("GET /{$}", auth.Require(model.ScopeFridgeRead, fridgeHandler.List))
 	// router.HandleFunc("GET /{id}", fridgeHandler.GetByID)
-	router.HandleFunc("DELETE /{id}", fridgeHandler.DeleteByID)
-	router.HandleFunc("PUT /", fridgeHandler.UpdateByID)
+	router.HandleFunc("DELETE /{id}", auth.Require(model.ScopeFridgeWrite, fridgeHandler.DeleteByID))
+	router.HandleFunc("PUT /{$}", auth.Require(model.ScopeFridgeWrite, fridgeHandler.UpdateByID))
 }
 
 func (a *App) loadGroceryRoutes(router *http.ServeMux) {
-	groceryHandler := &handler.Grocery{
+	groceryHandler := &handler.DB{
 		Repo: &item.FirebaseRepo{
-			Client: a.fdb,
+			Client:  a.fdb,
+			Metrics: a.metrics,
+		},
+	}
+	auth := &handler.Auth{
+		Repo: groceryHandler.Repo,
+	}
+	router.HandleFunc("POST /{$}", auth.Require(model.ScopeGroceryWrite, groceryHandler.Create))
+	// moving items touches both lists
+	router.HandleFunc("POST /to_fridge", auth.RequireAll([]string{model.ScopeGroceryWrite, model.ScopeFridgeWrite}, groceryHandler.MoveToFridge))
+	router.HandleFunc("GET /{$}", auth.Require(model.ScopeGroceryRead, groceryHandler.List))
+	router.HandleFunc("DELETE /{id}", auth.Require(model.ScopeGroceryWrite, groceryHandler.DeleteByID))
+	router.HandleFunc("PATCH /{id}", auth.Require(model.ScopeGroceryWrite, groceryHandler.SetActiveByID))
+	router.HandleFunc("PATCH /{$}", auth.Require(model.ScopeGroceryWrite, groceryHandler.RearrageItems))
+	router.HandleFunc("PUT /{$}", auth.Require(model.ScopeGroceryWrite, groceryHandler.UpdateByID))
+}
+
+func (a *App) loadUserRoutes(router *http.ServeMux) {
+	userHandler := &handler.User{
+		Repo: &item.FirebaseRepo{
+			Client:  a.fdb,
+			Metrics: a.metrics,
+		},
+		FinanceURL: a.config.FinanceURL,
+		Client: &http.Client{
+			Timeout:   a.config.FinanceTimeout,
+			Transport: tracing.Transport(a.transport),
+		},
+		Go: a.server.Go,
+	}
+	userHandler.SetKeys(a.config.SessionKey, a.config.RefreshKey)
+	userHandler.SetTokenLifetimes(a.config.SessionTTL, a.config.RefreshTTL)
+	throttle := a.newThrottle()
+	router.HandleFunc("POST /{$}", throttle.ProtectSignUp(userHandler.Create))
+	router.HandleFunc("POST /signin", throttle.Protect(userHandler.Read))
+	router.HandleFunc("POST /refresh", throttle.Protect(userHandler.Refresh))
+
+	auth := &handler.Auth{
+		Repo: userHandler.Repo,
+	}
+	router.HandleFunc("PUT /sheet", auth.RequireSession(userHandler.SetSheet))
+	router.HandleFunc("GET /export", auth.RequireSession(userHandler.Export))
+	router.HandleFunc("DELETE /{$}", auth.RequireSession(userHandler.Delete))
+
+	tokenHandler := &handler.AccessToken{
+		Repo: userHandler.Repo,
+	}
+	// access tokens cannot be used to manage access tokens
+	router.HandleFunc("POST /tokens", auth.RequireSession(tokenHandler.Create))
+	router.HandleFunc("GET /tokens", auth.RequireSession(tokenHandler.List))
+	router.HandleFunc("DELETE /tokens/{id}", auth.RequireSession(tokenHandler.DeleteByID))
+	router.HandleFunc("POST /tokens/introspect", tokenHandler.Introspect)
+}
+
+func (a *App) newThrottle() *handler.Throttle {
+	var store limiter.Store
+	switch a.config.RateLimitBackend {
+	case "firestore":
+		store = &limiter.FirestoreStore{Client: a.fdb}
+	default:
+		store = limiter.NewMemoryStore()
+	}
+
+	// a shared address, like a household behind one router, gets more room
+	// than a single username
+	ipPolicy := limiter.DefaultPolicy
+	ipPolicy.Limit = 60
+	ipPolicy.LockoutThreshold = 30
+
+	usernamePolicy := limiter.DefaultPolicy
+	usernamePolicy.Limit = 10
+
+	// checked when the configuration was loaded
+	trustedProxies, _ := a.config.trustedProxies()
+
+	return &handler.Throttle{
+		TrustedProxies: trustedProxies,
+		ByIP: &limiter.Limiter{
+			Store:  store,
+			Policy: ipPolicy,
+		},
+		ByUsername: &limiter.Limiter{
+			Store:  store,
+			Policy: usernamePolicy,
 		},
 	}
-	router.HandleFunc("POST /", groceryHandler.Create)
-	router.HandleFunc("POST /to_fridge", groceryHandler.MoveToFridge)
-	router.HandleFunc("GET /", groceryHandler.List)
-	router.HandleFunc("DELETE /{id}", groceryHandler.DeleteByID)
-	router.HandleFunc("PATCH /{id}", groceryHandler.SetActiveByID)
-	router.HandleFunc("PATCH /", groceryHandler.RearrageItems)
-	router.HandleFunc("PUT /", groceryHandler.UpdateByID)
 }
@@ -0,0 +1,248 @@
+// Command migrate moves fridge and grocery items out of the legacy top level
+// "fridge" and "grocery" collections and into a user's FRIDGE and GROCERY
+// collections.
+//
+//	go run ./cmd/migrate -user nathan -dry-run
+//	go run ./cmd/migrate -user nathan -move
+//
+// Migrated documents are recorded in a checkpoint file, so an interrupted run
+// picks up where it stopped when it is run again. Documents whose item_id or
+// document ID is already used in the user's collection are skipped and
+// reported as conflicts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform"
+	application "github.com/NathanRJohnson/live-backend/wtfridge/application"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+type checkpoint struct {
+	Username string `json:"username"`
+	// legacy collection -> IDs of the documents already migrated
+	Migrated  map[string][]string      `json:"migrated"`
+	Conflicts []item.MigrationConflict `json:"conflicts"`
+}
+
+func main() {
+	username := flag.String("user", "", "user whose collections the legacy items are migrated into (required)")
+	move := flag.Bool("move", false, "delete legacy documents once they are copied")
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without writing anything")
+	checkpointPath := flag.String("checkpoint", "migrate-checkpoint.json", "file recording migrated documents, used to resume")
+	flag.Parse()
+
+	if *username == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := platform.SignalContext(context.Background())
+	defer cancel()
+
+	err := run(ctx, *username, *move, *dryRun, *checkpointPath)
+	if err != nil {
+		log.Fatalln("migration failed:", err)
+	}
+}
+
+func run(ctx context.Context, username string, move bool, dryRun bool, checkpointPath string) error {
+	cfg, err := application.LoadConfig(nil)
+	if err != nil {
+		return err
+	}
+
+	client, err := firestore.NewClient(ctx, cfg.Secrets.ProjectID)
+	if err != nil {
+		return fmt.Errorf("failed to connect to firebase client: %w", err)
+	}
+	defer client.Close()
+
+	m := &migration{
+		store:          &firestoreStore{repo: &item.FirebaseRepo{Client: client}},
+		out:            os.Stdout,
+		username:       username,
+		move:           move,
+		dryRun:         dryRun,
+		checkpointPath: checkpointPath,
+	}
+	return m.run(ctx)
+}
+
+// migration moves the legacy items of one user.
+type migration struct {
+	store          store
+	out            io.Writer
+	username       string
+	move           bool
+	dryRun         bool
+	checkpointPath string
+}
+
+func (m *migration) run(ctx context.Context) error {
+	exists, err := m.store.UserExists(ctx, m.username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("user %s does not exist", m.username)
+	}
+
+	cp, err := loadCheckpoint(m.checkpointPath, m.username)
+	if err != nil {
+		return err
+	}
+
+	legacyCollections := make([]string, 0, len(item.LegacyCollections))
+	for legacy := range item.LegacyCollections {
+		legacyCollections = append(legacyCollections, legacy)
+	}
+	sort.Strings(legacyCollections)
+
+	var migrated, skipped int
+	var conflicts []item.MigrationConflict
+
+	for _, legacy := range legacyCollections {
+		target := item.LegacyCollections[legacy]
+
+		done := make(map[string]bool)
+		for _, id := range cp.Migrated[legacy] {
+			done[id] = true
+		}
+
+		docs, err := m.store.LegacyDocuments(ctx, legacy)
+		if err != nil {
+			return err
+		}
+
+		// grocery items are appended to the end of the user's list
+		nextIndex, err := m.store.CountItems(ctx, m.username, target)
+		if err != nil {
+			return err
+		}
+
+		// catches legacy documents that share an item_id with each other,
+		// which a dry run would otherwise miss
+		seen := make(map[int64]string)
+
+		for _, doc := range docs {
+			if done[doc.ID] {
+				skipped++
+				continue
+			}
+
+			if first, ok := seen[doc.ItemID]; ok {
+				conflicts = append(conflicts, item.MigrationConflict{
+					Collection: legacy,
+					DocID:      doc.ID,
+					ItemID:     doc.ItemID,
+					Reason:     fmt.Sprintf("item_id already used by legacy document %s", first),
+				})
+				continue
+			}
+			seen[doc.ItemID] = doc.ID
+
+			conflict, err := m.store.Migrate(ctx, m.username, doc, target, nextIndex+1, m.move, m.dryRun)
+			if err != nil {
+				return fmt.Errorf("failed to migrate %s/%s: %w", legacy, doc.ID, err)
+			}
+			if conflict != nil {
+				conflicts = append(conflicts, *conflict)
+				continue
+			}
+
+			nextIndex++
+			migrated++
+			fmt.Fprintf(m.out, "%s %s/%s -> USER/%s/%s/%s\n", action(m.move, m.dryRun), legacy, doc.ID, m.username, target, doc.ID)
+
+			if !m.dryRun {
+				cp.Migrated[legacy] = append(cp.Migrated[legacy], doc.ID)
+				err = saveCheckpoint(m.checkpointPath, cp)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if !m.dryRun {
+		cp.Conflicts = conflicts
+		err = saveCheckpoint(m.checkpointPath, cp)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(m.out, "\n%d migrated, %d already migrated, %d conflicts\n", migrated, skipped, len(conflicts))
+	for _, c := range conflicts {
+		fmt.Fprintf(m.out, "conflict: %s/%s (item_id %d): %s\n", c.Collection, c.DocID, c.ItemID, c.Reason)
+	}
+
+	return nil
+}
+
+func action(move bool, dryRun bool) string {
+	switch {
+	case dryRun && move:
+		return "would move"
+	case dryRun:
+		return "would copy"
+	case move:
+		return "moved"
+	default:
+		return "copied"
+	}
+}
+
+func loadCheckpoint(path string, username string) (*checkpoint, error) {
+	cp := &checkpoint{
+		Username: username,
+		Migrated: make(map[string][]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, cp)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoint %s: %w", path, err)
+	}
+
+	if cp.Username != username {
+		return nil, fmt.Errorf("checkpoint %s belongs to a migration for %s", path, cp.Username)
+	}
+	if cp.Migrated == nil {
+		cp.Migrated = make(map[string][]string)
+	}
+	return cp, nil
+}
+
+func saveCheckpoint(path string, cp *checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write then rename, so an interruption never leaves half a checkpoint
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
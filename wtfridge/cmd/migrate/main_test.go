@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// fakeStore keeps the legacy collections, and the collections of one user,
+// as the item IDs of their documents by document ID.
+type fakeStore struct {
+	username string
+	legacy   map[string][]legacyDocument
+	user     map[string]map[string]int64
+	// the index each grocery item was given
+	indexes map[string]int
+	// the document whose migration fails, as if the run were interrupted
+	failOn string
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		username: "nathan",
+		legacy: map[string][]legacyDocument{
+			"fridge":  {{ID: "milk", ItemID: 1}, {ID: "eggs", ItemID: 2}, {ID: "jam", ItemID: 3}},
+			"grocery": {{ID: "bread", ItemID: 1}, {ID: "rice", ItemID: 2}},
+		},
+		user: map[string]map[string]int64{
+			"FRIDGE":  {},
+			"GROCERY": {"beans": 9},
+		},
+		indexes: map[string]int{},
+	}
+}
+
+func (s *fakeStore) UserExists(ctx context.Context, username string) (bool, error) {
+	return username == s.username, nil
+}
+
+func (s *fakeStore) LegacyDocuments(ctx context.Context, legacy string) ([]legacyDocument, error) {
+	return append([]legacyDocument(nil), s.legacy[legacy]...), nil
+}
+
+func (s *fakeStore) CountItems(ctx context.Context, username string, collection string) (int, error) {
+	return len(s.user[collection]), nil
+}
+
+func (s *fakeStore) Migrate(ctx context.Context, username string, doc legacyDocument, collection string, index int, move bool, dryRun bool) (*item.MigrationConflict, error) {
+	if doc.ID == s.failOn {
+		return nil, errors.New("deadline exceeded")
+	}
+
+	target := s.user[collection]
+	for id, itemID := range target {
+		if itemID == doc.ItemID {
+			return &item.MigrationConflict{DocID: doc.ID, ItemID: doc.ItemID, Reason: "item_id already used by " + id}, nil
+		}
+	}
+	if _, ok := target[doc.ID]; ok {
+		return &item.MigrationConflict{DocID: doc.ID, ItemID: doc.ItemID, Reason: "document already exists"}, nil
+	}
+	if dryRun {
+		return nil, nil
+	}
+
+	target[doc.ID] = doc.ItemID
+	if collection == "GROCERY" {
+		s.indexes[doc.ID] = index
+	}
+	if move {
+		for legacy, docs := range s.legacy {
+			for i, d := range docs {
+				if d == doc {
+					s.legacy[legacy] = append(docs[:i:i], docs[i+1:]...)
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func newMigration(t *testing.T, s *fakeStore) (*migration, *bytes.Buffer) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	return &migration{
+		store:          s,
+		out:            out,
+		username:       s.username,
+		checkpointPath: filepath.Join(t.TempDir(), "checkpoint.json"),
+	}, out
+}
+
+func summary(out *bytes.Buffer) string {
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	for _, line := range lines {
+		if strings.Contains(line, " migrated, ") {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestMigrate(t *testing.T) {
+	s := newFakeStore()
+	m, out := newMigration(t, s)
+	if err := m.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := summary(out); got != "5 migrated, 0 already migrated, 0 conflicts" {
+		t.Errorf("got %q", got)
+	}
+	if !strings.Contains(out.String(), "copied grocery/rice -> USER/nathan/GROCERY/rice\n") {
+		t.Errorf("got output %q, want each copied document listed", out)
+	}
+	want := map[string]map[string]int64{
+		"FRIDGE":  {"milk": 1, "eggs": 2, "jam": 3},
+		"GROCERY": {"beans": 9, "bread": 1, "rice": 2},
+	}
+	if !reflect.DeepEqual(s.user, want) {
+		t.Errorf("user has %v, want %v", s.user, want)
+	}
+	// appended after the one item already on the list
+	if s.indexes["bread"] != 2 || s.indexes["rice"] != 3 {
+		t.Errorf("grocery items were given indexes %v, want bread 2 and rice 3", s.indexes)
+	}
+}
+
+func TestRerunMigratesNothingAgain(t *testing.T) {
+	s := newFakeStore()
+	m, _ := newMigration(t, s)
+	if err := m.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	migrated := fmt.Sprint(s.user)
+
+	rerun, out := newMigration(t, s)
+	rerun.checkpointPath = m.checkpointPath
+	if err := rerun.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := summary(out); got != "0 migrated, 5 already migrated, 0 conflicts" {
+		t.Errorf("rerun got %q", got)
+	}
+	if fmt.Sprint(s.user) != migrated {
+		t.Errorf("rerun changed the user's items to %v", s.user)
+	}
+}
+
+func TestRunResumesWhereItStopped(t *testing.T) {
+	for _, move := range []bool{false, true} {
+		t.Run(action(move, false), func(t *testing.T) {
+			s := newFakeStore()
+			s.failOn = "jam"
+			m, _ := newMigration(t, s)
+			m.move = move
+			if err := m.run(context.Background()); err == nil || !strings.Contains(err.Error(), "fridge/jam") {
+				t.Fatalf("got %v, want the migration of jam to fail", err)
+			}
+
+			// eggs and milk were recorded as they were migrated; the jam still
+			// to be and the grocery list untouched
+			cp, err := loadCheckpoint(m.checkpointPath, "nathan")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(cp.Migrated["fridge"], ","); got != "milk,eggs" || len(cp.Migrated["grocery"]) != 0 {
+				t.Fatalf("checkpoint recorded %v, want milk and eggs", cp.Migrated)
+			}
+
+			s.failOn = ""
+			resumed, out := newMigration(t, s)
+			resumed.checkpointPath = m.checkpointPath
+			resumed.move = move
+			if err := resumed.run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			want := "3 migrated, 2 already migrated, 0 conflicts"
+			if move {
+				// moved documents are gone from the legacy collections
+				want = "3 migrated, 0 already migrated, 0 conflicts"
+				if len(s.legacy["fridge"]) != 0 || len(s.legacy["grocery"]) != 0 {
+					t.Errorf("left legacy documents %v", s.legacy)
+				}
+			}
+			if got := summary(out); got != want {
+				t.Errorf("resumed run got %q, want %q", got, want)
+			}
+			if len(s.user["FRIDGE"]) != 3 || len(s.user["GROCERY"]) != 3 {
+				t.Errorf("user has %v, want every item once", s.user)
+			}
+		})
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	s := newFakeStore()
+	m, out := newMigration(t, s)
+	m.dryRun = true
+	m.move = true
+	if err := m.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := summary(out); got != "5 migrated, 0 already migrated, 0 conflicts" {
+		t.Errorf("got %q", got)
+	}
+	if !strings.Contains(out.String(), "would move fridge/milk") {
+		t.Errorf("got output %q, want what would be moved", out)
+	}
+	if len(s.user["FRIDGE"]) != 0 || len(s.legacy["fridge"]) != 3 {
+		t.Errorf("a dry run changed the store: %v, %v", s.user, s.legacy)
+	}
+	if _, err := os.Stat(m.checkpointPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a dry run wrote a checkpoint: %v", err)
+	}
+}
+
+func TestConflictsAreReportedAndRecorded(t *testing.T) {
+	s := newFakeStore()
+	s.legacy["fridge"] = append(s.legacy["fridge"], legacyDocument{ID: "cream", ItemID: 1})
+	s.user["GROCERY"]["rice"] = 7
+	m, out := newMigration(t, s)
+	if err := m.run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := summary(out); got != "4 migrated, 0 already migrated, 2 conflicts" {
+		t.Errorf("got %q", got)
+	}
+	cp, err := loadCheckpoint(m.checkpointPath, "nathan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.Conflicts) != 2 || cp.Conflicts[0].DocID != "cream" || cp.Conflicts[1].DocID != "rice" {
+		t.Errorf("checkpoint recorded conflicts %+v, want cream and rice", cp.Conflicts)
+	}
+
+	if _, err := loadCheckpoint(m.checkpointPath, "sam"); err == nil {
+		t.Error("resumed another user's migration")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// store is what a migration reads and writes, so it can be run against
+// something other than Firestore.
+type store interface {
+	UserExists(ctx context.Context, username string) (bool, error)
+	// LegacyDocuments are the documents of a legacy collection, in the order
+	// they are migrated.
+	LegacyDocuments(ctx context.Context, legacy string) ([]legacyDocument, error)
+	CountItems(ctx context.Context, username string, collection string) (int, error)
+	// Migrate copies doc into the user's collection, or reports why it
+	// clashes with a document there, as item.FirebaseRepo.MigrateDocument.
+	Migrate(ctx context.Context, username string, doc legacyDocument, collection string, index int, move bool, dryRun bool) (*item.MigrationConflict, error)
+}
+
+type legacyDocument struct {
+	ID     string
+	ItemID int64
+	// the document as Firestore returned it
+	snapshot *firestore.DocumentSnapshot
+}
+
+type firestoreStore struct {
+	repo *item.FirebaseRepo
+}
+
+func (s *firestoreStore) userRef(username string) *firestore.DocumentRef {
+	return s.repo.GetDocRef(s.repo.GetCollectionRef("USER", nil), username)
+}
+
+func (s *firestoreStore) UserExists(ctx context.Context, username string) (bool, error) {
+	return s.repo.DocExists(ctx, s.userRef(username))
+}
+
+func (s *firestoreStore) LegacyDocuments(ctx context.Context, legacy string) ([]legacyDocument, error) {
+	snapshots, err := s.repo.FetchLegacyDocuments(ctx, legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]legacyDocument, len(snapshots))
+	for i, snapshot := range snapshots {
+		itemID, _ := snapshot.Data()["ItemID"].(int64)
+		docs[i] = legacyDocument{ID: snapshot.Ref.ID, ItemID: itemID, snapshot: snapshot}
+	}
+	return docs, nil
+}
+
+func (s *firestoreStore) CountItems(ctx context.Context, username string, collection string) (int, error) {
+	return s.repo.CountDocs(ctx, s.repo.GetCollectionRef(collection, s.userRef(username)))
+}
+
+func (s *firestoreStore) Migrate(ctx context.Context, username string, doc legacyDocument, collection string, index int, move bool, dryRun bool) (*item.MigrationConflict, error) {
+	target := s.repo.GetCollectionRef(collection, s.userRef(username))
+	return s.repo.MigrateDocument(ctx, doc.snapshot, target, index, move, dryRun)
+}
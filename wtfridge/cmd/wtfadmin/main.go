@@ -0,0 +1,355 @@
+// Command wtfadmin manages users and their lists without going through the
+// Firestore console. It reads the same configuration as the fridge service.
+//
+//	wtfadmin [-json] users list
+//	wtfadmin [-json] users create <username>
+//	wtfadmin [-json] users disable <username>
+//	wtfadmin [-json] users enable <username>
+//	wtfadmin [-json] users delete <username>
+//	wtfadmin [-json] users reset-credentials <username>
+//	wtfadmin [-json] users set-sheet <username> <sheet>
+//	wtfadmin [-json] grocery inspect <username>
+//	wtfadmin [-json] grocery repair <username>
+//	wtfadmin dump <username> [file]
+//	wtfadmin [-json] restore <username> <file>
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform"
+	application "github.com/NathanRJohnson/live-backend/wtfridge/application"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+var errUsage = errors.New("usage")
+
+type admin struct {
+	repo *item.FirebaseRepo
+	out  io.Writer
+	json bool
+}
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print results as JSON")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := platform.SignalContext(context.Background())
+	defer cancel()
+
+	cfg, err := application.LoadConfig(nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+
+	client, err := firestore.NewClient(ctx, cfg.Secrets.ProjectID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to connect to firebase client:", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	a := &admin{
+		repo: &item.FirebaseRepo{Client: client},
+		out:  os.Stdout,
+		json: *jsonOutput,
+	}
+
+	err = a.run(ctx, flag.Args())
+	if errors.Is(err, errUsage) {
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: wtfadmin [-json] <command>
+
+commands:
+  users list
+  users create <username>
+  users disable <username>
+  users enable <username>
+  users delete <username>
+  users reset-credentials <username>
+  users set-sheet <username> <sheet>
+  grocery inspect <username>
+  grocery repair <username>
+  dump <username> [file]
+  restore <username> <file>`)
+}
+
+func (a *admin) run(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "users":
+		return a.users(ctx, args[1:])
+	case "grocery":
+		return a.grocery(ctx, args[1:])
+	case "dump":
+		if len(args) < 2 || len(args) > 3 {
+			return errUsage
+		}
+		path := ""
+		if len(args) == 3 {
+			path = args[2]
+		}
+		return a.dump(ctx, args[1], path)
+	case "restore":
+		if len(args) != 3 {
+			return errUsage
+		}
+		return a.restore(ctx, args[1], args[2])
+	default:
+		return errUsage
+	}
+}
+
+func (a *admin) users(ctx context.Context, args []string) error {
+	if len(args) == 1 && args[0] == "list" {
+		return a.listUsers(ctx)
+	}
+	if len(args) == 3 && args[0] == "set-sheet" {
+		return a.setSheet(ctx, args[1], args[2])
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	username := args[1]
+	if args[0] != "create" {
+		if err := a.requireUser(ctx, username); err != nil {
+			return err
+		}
+	}
+
+	switch args[0] {
+	case "create":
+		now := time.Now().UTC()
+		err := a.repo.CreateUser(ctx, model.User{Username: username, CreatedAt: &now})
+		if err != nil {
+			return err
+		}
+		return a.result(fmt.Sprintf("created user %s", username), map[string]interface{}{"username": username, "created": true})
+
+	case "disable", "enable":
+		disabled := args[0] == "disable"
+		err := a.repo.SetUserDisabled(ctx, username, disabled)
+		if err != nil {
+			return err
+		}
+		return a.result(fmt.Sprintf("%sd user %s", args[0], username), map[string]interface{}{"username": username, "disabled": disabled})
+
+	case "delete":
+		_, err := a.repo.StartDeletion(ctx, username)
+		if err != nil {
+			return err
+		}
+		err = a.repo.DeleteUser(ctx, username)
+		if err != nil {
+			return fmt.Errorf("deletion interrupted, run again or restart the fridge service to resume: %w", err)
+		}
+		return a.result(fmt.Sprintf("deleted user %s", username), map[string]interface{}{"username": username, "deleted": true})
+
+	case "reset-credentials":
+		err := a.repo.ResetCredentials(ctx, username)
+		if err != nil {
+			return err
+		}
+		return a.result(fmt.Sprintf("revoked all tokens of user %s", username), map[string]interface{}{"username": username, "credentials_reset": true})
+
+	default:
+		return errUsage
+	}
+}
+
+// setSheet links the finance spreadsheet to a user's account. Session
+// tokens carry the spreadsheet, so the user signs in again to use it.
+func (a *admin) setSheet(ctx context.Context, username string, sheetRef string) error {
+	if err := a.requireUser(ctx, username); err != nil {
+		return err
+	}
+	err := a.repo.SetUserSheet(ctx, username, sheetRef)
+	if err != nil {
+		return err
+	}
+	return a.result(fmt.Sprintf("linked spreadsheet %s to user %s", sheetRef, username), map[string]interface{}{"username": username, "sheet_ref": sheetRef})
+}
+
+func (a *admin) listUsers(ctx context.Context) error {
+	users, err := a.repo.FetchUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	if a.json {
+		return a.writeJSON(users)
+	}
+
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tCREATED\tDISABLED\tCREDENTIALS RESET\tSHEET")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", u.Username, formatTime(u.CreatedAt), u.Disabled, formatTime(u.CredentialsResetAt), u.SheetRef)
+	}
+	return tw.Flush()
+}
+
+func (a *admin) grocery(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	username := args[1]
+	if err := a.requireUser(ctx, username); err != nil {
+		return err
+	}
+
+	userRef := a.repo.GetDocRef(a.repo.GetCollectionRef("USER", nil), username)
+	groceryRef := a.repo.GetCollectionRef("GROCERY", userRef)
+
+	switch args[0] {
+	case "inspect":
+		report, err := a.repo.InspectIndicies(ctx, groceryRef)
+		if err != nil {
+			return err
+		}
+		if a.json {
+			return a.writeJSON(report)
+		}
+
+		fmt.Fprintf(a.out, "%d items\n", report.Items)
+		if report.IsValid() {
+			fmt.Fprintln(a.out, "index sequence is valid")
+			return nil
+		}
+		fmt.Fprintf(a.out, "missing indicies:      %s\n", formatInts(report.Missing))
+		fmt.Fprintf(a.out, "duplicate indicies:    %s\n", formatInts(report.Duplicates))
+		fmt.Fprintf(a.out, "out of range indicies: %s\n", formatInts(report.OutOfRange))
+		fmt.Fprintln(a.out, "run `wtfadmin grocery repair` to renumber the list")
+		return nil
+
+	case "repair":
+		changed, err := a.repo.RepairIndicies(ctx, groceryRef)
+		if err != nil {
+			return err
+		}
+		return a.result(fmt.Sprintf("renumbered %d items", changed), map[string]interface{}{"username": username, "changed": changed})
+
+	default:
+		return errUsage
+	}
+}
+
+// dump always writes JSON, to stdout unless a file is given.
+func (a *admin) dump(ctx context.Context, username string, path string) error {
+	if err := a.requireUser(ctx, username); err != nil {
+		return err
+	}
+
+	userRef := a.repo.GetDocRef(a.repo.GetCollectionRef("USER", nil), username)
+	exported, err := a.repo.ExportDocument(ctx, userRef)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		_, err = fmt.Fprintln(a.out, string(data))
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func (a *admin) restore(ctx context.Context, username string, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var exported model.ExportedDocument
+	err = json.Unmarshal(data, &exported)
+	if err != nil {
+		return fmt.Errorf("unable to parse %s: %w", path, err)
+	}
+
+	if exported.ID != username {
+		return fmt.Errorf("%s is a dump of user %s, not %s", path, exported.ID, username)
+	}
+
+	userRef := a.repo.GetDocRef(a.repo.GetCollectionRef("USER", nil), username)
+	err = a.repo.RestoreDocument(ctx, userRef, &exported)
+	if err != nil {
+		return err
+	}
+
+	return a.result(fmt.Sprintf("restored user %s from %s", username, path), map[string]interface{}{"username": username, "restored": true})
+}
+
+func (a *admin) requireUser(ctx context.Context, username string) error {
+	user, err := a.repo.FetchUser(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+	return nil
+}
+
+// result prints message, or v when JSON output was asked for.
+func (a *admin) result(message string, v interface{}) error {
+	if a.json {
+		return a.writeJSON(v)
+	}
+	_, err := fmt.Fprintln(a.out, message)
+	return err
+}
+
+func (a *admin) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(a.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatInts(ints []int) string {
+	if len(ints) == 0 {
+		return "none"
+	}
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = fmt.Sprint(n)
+	}
+	return strings.Join(s, ", ")
+}
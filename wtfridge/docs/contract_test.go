@@ -0,0 +1,111 @@
+package docs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOperationsAreIdentified(t *testing.T) {
+	contract, err := LoadContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := contract.Operations()
+	if len(ops) == 0 {
+		t.Fatal("the document has no operations")
+	}
+
+	seen := map[string]bool{}
+	for _, op := range ops {
+		if op.ID == "" {
+			t.Errorf("%s has no operationId", op)
+		}
+		if seen[op.ID] {
+			t.Errorf("%s reuses operationId %s", op, op.ID)
+		}
+		seen[op.ID] = true
+	}
+}
+
+func TestExamplesMatchTheirSchema(t *testing.T) {
+	contract, err := LoadContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range contract.Operations() {
+		if !op.HasBody() {
+			continue
+		}
+		example, err := op.Example()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if err := op.CheckRequest(example); err != nil {
+			t.Errorf("example does not match: %v", err)
+		}
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	contract, err := LoadContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, ok := contract.Operation("createFridgeItem")
+	if !ok {
+		t.Fatal("createFridgeItem is not documented")
+	}
+
+	jsonHeader := http.Header{"Content-Type": {"application/json"}}
+	problemHeader := http.Header{"Content-Type": {"application/problem+json"}}
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		want   string
+	}{
+		{"valid", 201, jsonHeader, `{"item_id":1,"item_name":"Milk","date_added":null,"quantity":1,"notes":""}`, ""},
+		{"missing field", 201, jsonHeader, `{"item_id":1,"item_name":"Milk","date_added":null,"quantity":1}`, "is missing notes"},
+		{"wrong type", 201, jsonHeader, `{"item_id":"1","item_name":"Milk","date_added":null,"quantity":1,"notes":""}`, "is not of type integer"},
+		{"bad date", 201, jsonHeader, `{"item_id":1,"item_name":"Milk","date_added":"today","quantity":1,"notes":""}`, "is not a date-time"},
+		{"wrong content type", 201, http.Header{"Content-Type": {"text/plain"}}, `{}`, "text/plain is not documented"},
+		{"other statuses are problems", 418, jsonHeader, `{}`, "application/json is not documented"},
+		{"problem", 400, problemHeader, `{"type":"about:blank","title":"Bad Request","status":400,"code":"invalid","errors":[{"field":"item_id","message":"is required"}]}`, ""},
+		{"unknown code", 400, problemHeader, `{"type":"about:blank","title":"Bad Request","status":400,"code":"oops"}`, "is not one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := op.CheckResponse(tt.status, tt.header, []byte(tt.body))
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlerServesSpec(t *testing.T) {
+	h := Handler("wtfridge")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/openapi.yaml", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != string(Spec) {
+		t.Errorf("GET /docs/openapi.yaml = %d, want the document", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `url: "openapi.yaml"`) {
+		t.Errorf("GET /docs/ = %d, want the UI", rec.Code)
+	}
+}
@@ -0,0 +1,29 @@
+// Package docs serves the OpenAPI description of the service, and a page
+// that renders it, under /docs/.
+package docs
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/NathanRJohnson/live-backend/platform/docs"
+)
+
+//go:embed openapi.yaml
+var Spec []byte
+
+// Contract and Operation check requests and responses against Spec.
+type (
+	Contract  = docs.Contract
+	Operation = docs.Operation
+)
+
+// Handler serves the UI at /docs/ and the document at /docs/openapi.yaml.
+func Handler(title string) http.Handler {
+	return docs.Handler(title, Spec)
+}
+
+// LoadContract parses Spec, for tests that check the handlers against it.
+func LoadContract() (*Contract, error) {
+	return docs.LoadContract(Spec)
+}
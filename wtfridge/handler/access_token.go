@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+type AccessToken struct {
+	Repo *item.FirebaseRepo
+}
+
+func (t *AccessToken) Create(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Create an access token")
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return
+	}
+
+	var body struct {
+		Name      string     `json:"name" validate:"required,max=100"`
+		Scopes    []string   `json:"scopes" validate:"required"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	// the known scopes and the current time are not fixed, so are checked here
+	var errs validate.Errors
+	for _, scope := range body.Scopes {
+		if !isKnownScope(scope) {
+			errs = append(errs, validate.FieldError{Field: "scopes", Message: "has unknown scope " + scope})
+		}
+	}
+
+	now := time.Now().UTC()
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(now) {
+		errs = append(errs, validate.FieldError{Field: "expires_at", Message: "must be in the future"})
+	}
+
+	if len(errs) > 0 {
+		problem.WriteInvalid(w, r, errs)
+		return
+	}
+
+	plaintext, err := generateAccessToken()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	tokenID, err := randomHex(8)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	token := model.AccessToken{
+		TokenID:   tokenID,
+		Username:  principal.Username,
+		Name:      body.Name,
+		Hash:      hashAccessToken(plaintext),
+		Scopes:    body.Scopes,
+		CreatedAt: &now,
+		ExpiresAt: body.ExpiresAt,
+	}
+
+	err = t.Repo.InsertToken(r.Context(), token)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// the plaintext token is only ever returned here
+	writeJSON(w, r, http.StatusCreated, struct {
+		model.AccessToken
+		Token string `json:"token"`
+	}{token, plaintext})
+}
+
+func (t *AccessToken) List(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("List access tokens")
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return
+	}
+
+	tokens, err := t.Repo.FetchTokens(r.Context(), principal.Username)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, tokens)
+}
+
+func (t *AccessToken) DeleteByID(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Revoke an access token")
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return
+	}
+
+	err := t.Repo.DeleteToken(r.Context(), principal.Username, r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Introspect reports whether a token is active, who it belongs to and the
+// spreadsheet it may use. It lets the other services accept tokens without
+// reading the token store themselves. An access token may use the
+// spreadsheet linked to the account, and a session token the one it was
+// issued with; a session token is only active while its account is, as
+// signing in again would be.
+func (t *AccessToken) Introspect(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	var result struct {
+		Active   bool     `json:"active"`
+		Username string   `json:"username,omitempty"`
+		Scopes   []string `json:"scopes,omitempty"`
+		SheetRef string   `json:"sheet_ref,omitempty"`
+	}
+
+	if strings.HasPrefix(body.Token, accessTokenPrefix) {
+		accessToken, user, err := lookupAccessToken(r.Context(), t.Repo, body.Token)
+		if err == nil {
+			result.Active = true
+			result.Username = accessToken.Username
+			result.Scopes = accessToken.Scopes
+			result.SheetRef = user.SheetRef
+		}
+	} else if claims, err := validateSessionToken(body.Token); err == nil {
+		if _, err := checkCredentials(r.Context(), t.Repo, claims.Username, claims.issuedAt()); err == nil {
+			result.Active = true
+			result.Username = claims.Username
+			result.SheetRef = claims.SheetRef
+		}
+	}
+
+	writeJSON(w, r, http.StatusOK, result)
+}
+
+func isKnownScope(scope string) bool {
+	for _, s := range model.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func generateAccessToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return accessTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
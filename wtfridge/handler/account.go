@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// Export returns everything stored about the authenticated user as a JSON
+// download. Finance transactions are included when a spreadsheet is linked
+// to the account.
+func (u *User) Export(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Export a user")
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return
+	}
+
+	userDoc := u.Repo.GetDocRef(u.Repo.GetCollectionRef(USER, nil), principal.Username)
+	exported, err := u.Repo.ExportDocument(r.Context(), userDoc)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	tokens, err := u.Repo.FetchTokens(r.Context(), principal.Username)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	archive := map[string]interface{}{
+		"username":      principal.Username,
+		"exported_at":   time.Now().UTC(),
+		"user":          exported,
+		"access_tokens": tokens,
+	}
+
+	user, err := u.Repo.FetchUser(r.Context(), principal.Username)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if user != nil && user.SheetRef != "" && u.FinanceURL != "" {
+		transactions, err := u.fetchTransactions(r.Context(), r.Header.Get("Authorization"), user.SheetRef)
+		if err != nil {
+			logging.Logger(r.Context()).Error("failed to fetch finance transactions", "err", err)
+			problem.Write(w, r, http.StatusBadGateway, problem.CodeUpstream, "finance transactions could not be fetched")
+			return
+		}
+		archive["finance_transactions"] = transactions
+	}
+
+	res, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export.json"`, principal.Username))
+	w.Write(res)
+}
+
+func (u *User) fetchTransactions(ctx context.Context, authHeader string, sheetRef string) (json.RawMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.FinanceURL+"/finance/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authHeader)
+	req.Header.Set("SheetRef", sheetRef)
+	req.Header.Set(logging.RequestIDHeader, logging.RequestID(ctx))
+
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("finance service responded %s", res.Status)
+	}
+
+	var transactions json.RawMessage
+	err = json.NewDecoder(res.Body).Decode(&transactions)
+	return transactions, err
+}
+
+// checkSheet asks the finance service whether its service account can open
+// sheetRef, with a session token of username carrying the spreadsheet, as
+// the finance service only lets tokens use the spreadsheet they carry.
+func (u *User) checkSheet(ctx context.Context, username, sheetRef string) error {
+	if u.FinanceURL == "" {
+		return errNoFinance
+	}
+	session, _, err := getSignInTokens(model.User{Username: username, SheetRef: sheetRef})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.FinanceURL+"/finance/access", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+session)
+	req.Header.Set("SheetRef", sheetRef)
+	req.Header.Set(logging.RequestIDHeader, logging.RequestID(ctx))
+
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errFinanceFailed, err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return errSheetNotShared
+	default:
+		return fmt.Errorf("%w: finance service responded %s", errFinanceFailed, res.Status)
+	}
+}
+
+// Delete removes the authenticated user's account, along with their lists and
+// access tokens. Deletion carries on in the background after the response is
+// sent, and is resumed on start up if the service stops part way through.
+func (u *User) Delete(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Delete a user")
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return
+	}
+
+	deletion, err := u.Repo.StartDeletion(r.Context(), principal.Username)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	logger, username := logging.Logger(r.Context()), principal.Username
+	u.Go("delete user", func(ctx context.Context) error {
+		err := u.Repo.DeleteUser(ctx, username)
+		if err != nil {
+			logger.Error("failed to delete user, it will be resumed on restart", "username", username, "err", err)
+		}
+		return nil
+	})
+
+	writeJSON(w, r, http.StatusAccepted, deletion)
+}
+
+// ResumeDeletions finishes deleting any accounts whose deletion was
+// interrupted.
+func ResumeDeletions(ctx context.Context, repo *item.FirebaseRepo) error {
+	deletions, err := repo.FetchPendingDeletions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, deletion := range deletions {
+		logging.Logger(ctx).Info("resuming deletion of user", "username", deletion.Username)
+		err = repo.DeleteUser(ctx, deletion.Username)
+		if err != nil {
+			return fmt.Errorf("failed to delete user %s: %w", deletion.Username, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckSheetAsksTheFinanceService(t *testing.T) {
+	u := &User{}
+	u.SetKeys("session", "refresh")
+
+	tests := []struct {
+		name   string
+		status int
+		want   error
+	}{
+		{"shared with the service", http.StatusNoContent, nil},
+		{"not shared", http.StatusNotFound, errSheetNotShared},
+		{"finance failing", http.StatusServiceUnavailable, errFinanceFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, err := validateSessionToken(r.Header.Get("Authorization")[len("Bearer "):])
+				if err != nil || claims.Username != "nathan" || claims.SheetRef != r.Header.Get("SheetRef") {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				asked = r.URL.Path + " " + r.Header.Get("SheetRef")
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+			u.FinanceURL = srv.URL
+
+			err := u.checkSheet(context.Background(), "nathan", "sheet-1")
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if asked != "/finance/access sheet-1" {
+				t.Errorf("asked %q, want /finance/access for sheet-1", asked)
+			}
+		})
+	}
+
+	u.FinanceURL = ""
+	if err := u.checkSheet(context.Background(), "nathan", "sheet-1"); !errors.Is(err, errNoFinance) {
+		t.Errorf("without a finance service got %v, want %v", err, errNoFinance)
+	}
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// personal access tokens carry a fixed prefix so they can be told apart from
+// session JWTs without attempting to parse them
+const accessTokenPrefix = "wtf_pat_"
+
+// how often the last used timestamp of an access token is written back
+const tokenTouchInterval = time.Minute
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Username string
+	Scopes   []string
+	// TokenID is empty when the caller authenticated with a session token
+	TokenID string
+}
+
+func (p *Principal) IsSession() bool {
+	return p.TokenID == ""
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func principalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+type Auth struct {
+	Repo *item.FirebaseRepo
+}
+
+// Require only lets the request through if it carries a valid session token,
+// or a personal access token that has been granted scope.
+func (a *Auth) Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return a.RequireAll([]string{scope}, next)
+}
+
+// RequireAll is Require for routes that need more than one scope.
+func (a *Auth) RequireAll(scopes []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r)
+		if err != nil {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
+			return
+		}
+
+		for _, scope := range scopes {
+			if !principal.HasScope(scope) {
+				problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "token is missing required scope "+scope)
+				return
+			}
+		}
+
+		logging.SetUser(r.Context(), principal.Username)
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// RequireSession only lets the request through if it carries a valid session
+// token. Personal access tokens are rejected.
+func (a *Auth) RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.authenticate(r)
+		if err != nil {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
+			return
+		}
+
+		if !principal.IsSession() {
+			problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "a session token is required")
+			return
+		}
+
+		logging.SetUser(r.Context(), principal.Username)
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+func (a *Auth) authenticate(r *http.Request) (*Principal, error) {
+	token, err := getTokenFromHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(token, accessTokenPrefix) {
+		accessToken, _, err := lookupAccessToken(r.Context(), a.Repo, token)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{
+			Username: accessToken.Username,
+			Scopes:   accessToken.Scopes,
+			TokenID:  accessToken.TokenID,
+		}, nil
+	}
+
+	claims, err := validateSessionToken(token)
+	if err != nil {
+		return nil, errors.New("invalid or expired session token")
+	}
+
+	_, err = checkCredentials(r.Context(), a.Repo, claims.Username, claims.issuedAt())
+	if err != nil {
+		return nil, err
+	}
+
+	// session tokens are not scoped
+	return &Principal{
+		Username: claims.Username,
+		Scopes:   model.Scopes,
+	}, nil
+}
+
+// lookupAccessToken returns the access token and the user it belongs to, or
+// why the token is not accepted.
+func lookupAccessToken(ctx context.Context, repo *item.FirebaseRepo, token string) (*model.AccessToken, *model.User, error) {
+	accessToken, err := repo.FetchTokenByHash(ctx, hashAccessToken(token))
+	if err != nil {
+		logging.Logger(ctx).Error("failed to look up access token", "err", err)
+		return nil, nil, errors.New("invalid access token")
+	}
+
+	now := time.Now().UTC()
+	if accessToken.IsExpired(now) {
+		return nil, nil, errors.New("access token has expired")
+	}
+
+	var createdAt time.Time
+	if accessToken.CreatedAt != nil {
+		createdAt = *accessToken.CreatedAt
+	}
+	user, err := checkCredentials(ctx, repo, accessToken.Username, createdAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// avoid a write on every request made with the same token
+	if accessToken.LastUsed == nil || now.Sub(*accessToken.LastUsed) > tokenTouchInterval {
+		err = repo.TouchToken(ctx, accessToken.Hash, now)
+		if err != nil {
+			logging.Logger(ctx).Error("failed to record access token use", "err", err)
+		}
+		accessToken.LastUsed = &now
+	}
+
+	return accessToken, user, nil
+}
+
+var errCredentialsRevoked = errors.New("credentials have been revoked")
+
+// checkCredentials rejects credentials belonging to users that have been
+// deleted or disabled, and credentials issued before the user was created or
+// last had their credentials reset. It returns the user they belong to.
+func checkCredentials(ctx context.Context, repo *item.FirebaseRepo, username string, issuedAt time.Time) (*model.User, error) {
+	user, err := repo.FetchUser(ctx, username)
+	if err != nil {
+		logging.Logger(ctx).Error("failed to fetch user", "err", err)
+		return nil, errors.New("unable to verify credentials")
+	}
+
+	if user == nil || user.Disabled {
+		return nil, errCredentialsRevoked
+	}
+
+	// issue times of session tokens are only accurate to the second
+	if user.CreatedAt != nil && issuedAt.Before(user.CreatedAt.Truncate(time.Second)) {
+		return nil, errCredentialsRevoked
+	}
+	if user.CredentialsResetAt != nil && !issuedAt.After(user.CredentialsResetAt.Truncate(time.Second)) {
+		return nil, errCredentialsRevoked
+	}
+
+	return user, nil
+}
+
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
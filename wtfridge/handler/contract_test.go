@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/wtfridge/docs"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// The handlers of documented operations with a request body, by
+// operationId. Checking them against the document keeps the two in step.
+func contractHandlers(t *testing.T) map[string]http.HandlerFunc {
+	// nothing listens here, and requests are cancelled before they are
+	// served, so Firestore is never reached
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "127.0.0.1:1")
+	client, err := firestore.NewClient(context.Background(), "contract-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	repo := &item.FirebaseRepo{Client: client}
+	fridge := &Item{Repo: repo}
+	grocery := &DB{Repo: repo}
+	user := &User{Repo: repo}
+	tokens := &AccessToken{Repo: repo}
+
+	return map[string]http.HandlerFunc{
+		"createFridgeItem":      fridge.Create,
+		"updateFridgeItem":      fridge.UpdateByID,
+		"createGroceryItem":     grocery.Create,
+		"updateGroceryItem":     grocery.UpdateByID,
+		"rearrangeGroceryItems": grocery.RearrageItems,
+		"signUp":                user.Create,
+		"signIn":                user.Read,
+		"refreshSession":        user.Refresh,
+		"setSheet":              user.SetSheet,
+		"createAccessToken":     tokens.Create,
+		"introspectAccessToken": tokens.Introspect,
+	}
+}
+
+// serve calls h as the operation would be called, for a signed in user. The
+// request is already cancelled, so anything that reaches Firestore fails
+// straight away.
+func serve(op docs.Operation, h http.HandlerFunc, body []byte) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx = context.WithValue(ctx, principalKey{}, &Principal{Username: "contract", Scopes: model.Scopes})
+
+	r := httptest.NewRequest(op.Method, op.Path, strings.NewReader(string(body))).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	// an expired session is what refreshing expects
+	r.Header.Set("Authorization", "Bearer expired")
+
+	rec := httptest.NewRecorder()
+	h(rec, r)
+	return rec
+}
+
+func operationsWithBodies(t *testing.T) ([]docs.Operation, map[string]http.HandlerFunc) {
+	contract, err := docs.LoadContract()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers := contractHandlers(t)
+
+	var ops []docs.Operation
+	for _, op := range contract.Operations() {
+		if !op.HasBody() {
+			continue
+		}
+		if _, ok := handlers[op.ID]; !ok {
+			t.Errorf("%s (%s) has no handler in the contract tests", op, op.ID)
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops, handlers
+}
+
+func problemOf(t *testing.T, rec *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("response is not a problem: %v: %s", err, rec.Body)
+	}
+	return p
+}
+
+func TestRequiredFieldsMatchSpec(t *testing.T) {
+	ops, handlers := operationsWithBodies(t)
+	for _, op := range ops {
+		t.Run(op.ID, func(t *testing.T) {
+			rec := serve(op, handlers[op.ID], []byte(`{}`))
+			if err := op.CheckResponse(rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("an empty body got %d, want 400", rec.Code)
+			}
+
+			var required []string
+			for _, f := range problemOf(t, rec).Errors {
+				if f.Message == "is required" {
+					required = append(required, f.Field)
+				}
+			}
+			sort.Strings(required)
+
+			if !reflect.DeepEqual(required, op.Required()) {
+				t.Errorf("handler requires %v, the document %v", required, op.Required())
+			}
+		})
+	}
+}
+
+func TestDocumentedFieldsAreAccepted(t *testing.T) {
+	ops, handlers := operationsWithBodies(t)
+	for _, op := range ops {
+		t.Run(op.ID, func(t *testing.T) {
+			example, err := op.Example()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := serve(op, handlers[op.ID], example)
+			if err := op.CheckResponse(rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+			if rec.Code == http.StatusBadRequest {
+				t.Fatalf("the example was rejected: %s", rec.Body)
+			}
+
+			// every optional field too, one at a time
+			for _, field := range op.Fields() {
+				var body map[string]interface{}
+				json.Unmarshal(example, &body)
+				if _, ok := body[field]; ok {
+					continue
+				}
+				body[field] = op.Sample(field)
+				data, _ := json.Marshal(body)
+
+				rec := serve(op, handlers[op.ID], data)
+				if rec.Code == http.StatusBadRequest {
+					t.Errorf("documented field %s was rejected: %s", field, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestUndocumentedFieldsAreRejected(t *testing.T) {
+	ops, handlers := operationsWithBodies(t)
+	for _, op := range ops {
+		t.Run(op.ID, func(t *testing.T) {
+			example, err := op.Example()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body map[string]interface{}
+			json.Unmarshal(example, &body)
+			body["undocumented"] = true
+			data, _ := json.Marshal(body)
+
+			rec := serve(op, handlers[op.ID], data)
+			if err := op.CheckResponse(rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("got %d, want 400", rec.Code)
+			}
+			errs := problemOf(t, rec).Errors
+			if len(errs) != 1 || errs[0].Field != "undocumented" {
+				t.Errorf("got field errors %v, want one for undocumented", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// firestore collection names
+const (
+	USER    = "USER"
+	FRIDGE  = "FRIDGE"
+	GROCERY = "GROCERY"
+)
+
+type DB struct {
+	Repo *item.FirebaseRepo
+}
+
+// getUserCollection returns the named subcollection of the authenticated
+// user's document.
+func getUserCollection(repo *item.FirebaseRepo, r *http.Request, collection string) (*firestore.CollectionRef, error) {
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		return nil, errors.New("request is not authenticated")
+	}
+
+	userDocRef := repo.GetDocRef(repo.GetCollectionRef(USER, nil), principal.Username)
+	return repo.GetCollectionRef(collection, userDocRef), nil
+}
+
+// updateItemRequest is the part of an update shared by fridge and grocery
+// items. Fields that are left out are not changed.
+type updateItemRequest struct {
+	ItemID      int     `json:"item_id" validate:"required,min=1"`
+	NewName     *string `json:"new_name,omitempty" validate:"notblank,max=100"`
+	NewQuantity *int    `json:"new_quantity,omitempty" validate:"min=1"`
+	NewNotes    *string `json:"new_notes,omitempty" validate:"max=500"`
+}
+
+// values returns the fields to update, keyed by their name in Firestore.
+func (u updateItemRequest) values() map[string]interface{} {
+	values := make(map[string]interface{})
+	if u.NewName != nil {
+		values["Name"] = *u.NewName
+	}
+	if u.NewQuantity != nil {
+		values["Quantity"] = *u.NewQuantity
+	}
+	if u.NewNotes != nil {
+		values["Notes"] = *u.NewNotes
+	}
+	return values
+}
+
+// quantityOrDefault is the quantity of a new item, one when it is not given.
+func quantityOrDefault(quantity *int) int {
+	if quantity == nil {
+		return 1
+	}
+	return *quantity
+}
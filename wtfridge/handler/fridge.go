@@ -1,13 +1,13 @@
 package handler
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
 	"github.com/NathanRJohnson/live-backend/wtfridge/model"
 	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
 )
@@ -17,30 +17,21 @@ type Item struct {
 }
 
 func (i *Item) Create(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Create an item")
-	var body struct {
-		ItemID   int    `json:"item_id"`
-		Name     string `json:"item_name"`
-		Quantity int    `json:"quantity"`
-		Notes    string `json:"notes"`
-	}
+	logging.Logger(r.Context()).Debug("Create an item")
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("error unmarshaling requst:", err)
+	fridgeCollection, err := getUserCollection(i.Repo, r, FRIDGE)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
-
-	// missing id
-	if body.ItemID == 0 || body.Name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("item_name or item_is is missing or 0")
-		return
+	var body struct {
+		ItemID   int    `json:"item_id" validate:"required,min=1"`
+		Name     string `json:"item_name" validate:"required,max=100"`
+		Quantity *int   `json:"quantity" validate:"min=1"`
+		Notes    string `json:"notes" validate:"max=500"`
 	}
 
-	if body.Quantity <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("quantity must exceed 0")
+	if !problem.Decode(w, r, &body) {
 		return
 	}
 
@@ -49,106 +40,78 @@ func (i *Item) Create(w http.ResponseWriter, r *http.Request) {
 	item := model.FridgeItem{
 		ItemID:    body.ItemID,
 		Name:      body.Name,
-		Quantity:  body.Quantity,
+		Quantity:  quantityOrDefault(body.Quantity),
 		Notes:     body.Notes,
 		DateAdded: &now,
 	}
 
-	// TODO: can I make the collection a const?
-	err := i.Repo.Insert(r.Context(), "fridge", item)
-	if err != nil {
-		fmt.Println("failed to insert:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	data := map[string]interface{}{
+		"ItemID":    item.ItemID,
+		"Name":      item.Name,
+		"Quantity":  item.Quantity,
+		"Notes":     item.Notes,
+		"DateAdded": item.DateAdded,
 	}
 
-	res, err := json.Marshal(item)
+	err = i.Repo.Insert(r.Context(), fridgeCollection, data)
 	if err != nil {
-		fmt.Println("failed to marshal:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Write(res)
-	w.WriteHeader(http.StatusCreated)
-
+	writeJSON(w, r, http.StatusCreated, item)
 }
 
 func (i *Item) List(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("List all items - fridge")
-	items, err := i.Repo.FetchAll(r.Context(), "fridge")
+	logging.Logger(r.Context()).Debug("List all items - fridge")
+
+	fridgeCollection, err := getUserCollection(i.Repo, r, FRIDGE)
 	if err != nil {
-		fmt.Println("failed to fetch all:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
+		return
 	}
 
-	res, err := json.Marshal(items)
+	items, err := i.Repo.FetchAll(r.Context(), fridgeCollection)
 	if err != nil {
-		fmt.Println("failed to marshal:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
 	}
 
-	w.Write(res)
+	writeJSON(w, r, http.StatusOK, items)
 }
 
 func (i *Item) GetByID(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
-	fmt.Println("Get an item by ID: " + id)
+	logging.Logger(r.Context()).Debug("Get an item by ID", "id", id)
 }
 
 func (i *Item) UpdateByID(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Update an item by ID")
+	logging.Logger(r.Context()).Debug("Update an item by ID")
 
-	var body struct {
-		ItemID       int        `json:"item_id"`
-		NewName      *string    `json:"new_name,omitempty"`
-		NewQuantity  *int       `json:"new_quantity,omitempty"`
-		NewNotes     *string    `json:"new_notes,omitempty"`
-		NewDateAdded *time.Time `json:"new_date,omitempty"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("error unmarshaling requst:", err)
-		return
-	}
-
-	if body.ItemID <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
+	fridgeCollection, err := getUserCollection(i.Repo, r, FRIDGE)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
-	new_values := make(map[string]interface{})
-
-	if body.NewName != nil {
-		if *body.NewName != "" {
-			new_values["Name"] = *body.NewName
-		} else {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	var body struct {
+		updateItemRequest
+		NewDateAdded *time.Time `json:"new_date,omitempty"`
 	}
 
-	if body.NewQuantity != nil {
-		if *body.NewQuantity > 0 {
-			new_values["Quantity"] = *body.NewQuantity
-		} else {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	if !problem.Decode(w, r, &body) {
+		return
 	}
 
-	if body.NewNotes != nil {
-		new_values["Notes"] = *body.NewNotes
-	}
+	new_values := body.values()
 
 	if body.NewDateAdded != nil {
 		new_values["DateAdded"] = body.NewDateAdded
 	}
 
-	err := i.Repo.UpdateItemByID(r.Context(), "fridge", body.ItemID, new_values)
+	err = i.Repo.UpdateItemByID(r.Context(), fridgeCollection, body.ItemID, new_values)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -157,19 +120,23 @@ func (i *Item) UpdateByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (i *Item) DeleteByID(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Delete an item by ID")
+	logging.Logger(r.Context()).Debug("Delete an item by ID")
+
+	fridgeCollection, err := getUserCollection(i.Repo, r, FRIDGE)
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
+		return
+	}
 
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		fmt.Println("failed to convert id to integer: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteInvalid(w, r, validate.Errors{{Field: "id", Message: "must be an integer"}})
 		return
 	}
 
-	err = i.Repo.DeleteByID(r.Context(), "fridge", id)
+	err = i.Repo.DeleteByID(r.Context(), fridgeCollection, id)
 	if err != nil {
-		fmt.Println("failed to delete:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
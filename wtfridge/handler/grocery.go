@@ -1,11 +1,13 @@
 package handler
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/platform/validate"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
 )
 
 // type Grocery struct {
@@ -13,109 +15,90 @@ import (
 // }
 
 func (db *DB) Create(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Create a grocery item")
+	logging.Logger(r.Context()).Debug("Create a grocery item")
 
-	authHeader := r.Header.Get("Authorization")
-	groceryCollection, err := db.getCollectionFromHeader(authHeader, GROCERY)
+	groceryCollection, err := getUserCollection(db.Repo, r, GROCERY)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
 	var body struct {
-		ItemID   int    `json:"item_id"`
-		Name     string `json:"item_name"`
+		ItemID   int    `json:"item_id" validate:"required,min=1"`
+		Name     string `json:"item_name" validate:"required,max=100"`
 		IsActive bool   `json:"is_active"`
-		Index    int    `json:"index"`
-		Quantity int    `json:"quantity"`
-		Notes    string `json:"notes"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("error unmarshaling requst:", err)
-		return
+		Index    int    `json:"index" validate:"required,min=1"`
+		Quantity *int   `json:"quantity" validate:"min=1"`
+		Notes    string `json:"notes" validate:"max=500"`
 	}
 
-	if body.ItemID == 0 || body.Name == "" || body.Index < 1 {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("required field is missing")
+	if !problem.Decode(w, r, &body) {
 		return
 	}
 
-	item := map[string]interface{}{
-		"ItemID":   body.ItemID,
-		"Name":     body.Name,
-		"IsActive": body.IsActive,
-		"Index":    body.Index,
-		"Quantity": body.Quantity,
-		"Notes":    body.Notes,
+	item := model.GroceryItem{
+		ItemID:   body.ItemID,
+		Name:     body.Name,
+		IsActive: body.IsActive,
+		Index:    body.Index,
+		Quantity: quantityOrDefault(body.Quantity),
+		Notes:    body.Notes,
 	}
 
-	err = db.Repo.Insert(r.Context(), groceryCollection, item)
-	if err != nil {
-		fmt.Println("failed to insert:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	data := map[string]interface{}{
+		"ItemID":   item.ItemID,
+		"Name":     item.Name,
+		"IsActive": item.IsActive,
+		"Index":    item.Index,
+		"Quantity": item.Quantity,
+		"Notes":    item.Notes,
 	}
 
-	res, err := json.Marshal(item)
+	err = db.Repo.Insert(r.Context(), groceryCollection, data)
 	if err != nil {
-		fmt.Println("failed to marshal grocery:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	w.Write(res)
+	writeJSON(w, r, http.StatusCreated, item)
 }
 
 func (db *DB) List(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("List all grocery items")
+	logging.Logger(r.Context()).Debug("List all grocery items")
 
-	authHeader := r.Header.Get("Authorization")
-	groceryCollection, err := db.getCollectionFromHeader(authHeader, GROCERY)
+	groceryCollection, err := getUserCollection(db.Repo, r, GROCERY)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
 	items, err := db.Repo.FetchAll(r.Context(), groceryCollection)
 	if err != nil {
-		fmt.Println("failed to fetch all:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
-
-	res, err := json.Marshal(items)
-	if err != nil {
-		fmt.Println("failed to marshal:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
 	}
 
-	w.Write(res)
+	writeJSON(w, r, http.StatusOK, items)
 }
 
 func (db *DB) DeleteByID(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("Delete an item by ID")
+	logging.Logger(r.Context()).Debug("Delete an item by ID")
 
-	authHeader := r.Header.Get("Authorization")
-	groceryCollection, err := db.getCollectionFromHeader(authHeader, GROCERY)
+	groceryCollection, err := getUserCollection(db.Repo, r, GROCERY)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		fmt.Println("failed to convert id to integer: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteInvalid(w, r, validate.Errors{{Field: "id", Message: "must be an integer"}})
 		return
 	}
 
 	err = db.Repo.DeleteByID(r.Context(), groceryCollection, id)
 	if err != nil {
-		fmt.Println("failed to delete:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -123,68 +106,45 @@ func (db *DB) DeleteByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (db *DB) SetActiveByID(w http.ResponseWriter, r *http.Request) {
-	log.Println("Change active state")
+	logging.Logger(r.Context()).Debug("Change active state")
 
-	authHeader := r.Header.Get("Authorization")
-	groceryCollection, err := db.getCollectionFromHeader(authHeader, GROCERY)
+	groceryCollection, err := getUserCollection(db.Repo, r, GROCERY)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		log.Println("failed to convert id to integer: ", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		problem.WriteInvalid(w, r, validate.Errors{{Field: "id", Message: "must be an integer"}})
 		return
 	}
 
 	err = db.Repo.ToggleActiveByID(r.Context(), groceryCollection, id)
 	if err != nil {
-		log.Println("failed to toggle active state")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 }
 
 func (db *DB) UpdateByID(w http.ResponseWriter, r *http.Request) {
-	log.Println("Update by ID")
+	logging.Logger(r.Context()).Debug("Update by ID")
 
-	authHeader := r.Header.Get("Authorization")
-	groceryCollection, err := db.getCollectionFromHeader(authHeader, GROCERY)
+	groceryCollection, err := getUserCollection(db.Repo, r, GROCERY)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
-	var body struct {
-		ItemID      int    `json:"item_id"`
-		NewName     string `json:"new_name"`
-		NewQuantity int    `json:"new_quantity"`
-		NewNotes    string `json:"new_notes"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("error unmarshaling requst:", err)
-		return
-	}
+	var body updateItemRequest
 
-	if body.ItemID <= 0 || body.NewName == "" || body.NewQuantity <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
+	if !problem.Decode(w, r, &body) {
 		return
 	}
 
-	new_values := map[string]interface{}{
-		"Name":     body.NewName,
-		"Quantity": body.NewQuantity,
-		"Notes":    body.NewNotes,
-	}
-
-	err = db.Repo.UpdateItemByID(r.Context(), groceryCollection, body.ItemID, new_values)
+	err = db.Repo.UpdateItemByID(r.Context(), groceryCollection, body.ItemID, body.values())
 	if err != nil {
-		log.Println(err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -193,62 +153,49 @@ func (db *DB) UpdateByID(w http.ResponseWriter, r *http.Request) {
 }
 
 func (db *DB) MoveToFridge(w http.ResponseWriter, r *http.Request) {
-	log.Println("Move items to fridge")
-
-	authHeader := r.Header.Get("Authorization")
-	var err error
-	if authHeader == "" {
-		err = db.Repo.MoveToFridge(r.Context(), nil)
-		if err != nil {
-			log.Printf("failed to move grocery items to fridge: %v", err)
-		}
-	} else {
-		userClaims, err := getUserClaimsFromHeader(authHeader)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		userDocRef := db.Repo.GetDocRef(db.Repo.GetCollectionRef(USER, nil), userClaims.Username)
-		log.Println("THIS IS THE USER:", userDocRef.ID)
-
-		err = db.Repo.MoveToFridge(r.Context(), userDocRef)
-		if err != nil {
-			log.Printf("failed to move grocery items to fridge: %v", err)
-		}
+	logging.Logger(r.Context()).Debug("Move items to fridge")
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return
 	}
 
+	userDocRef := db.Repo.GetDocRef(db.Repo.GetCollectionRef(USER, nil), principal.Username)
+
+	err := db.Repo.MoveToFridge(r.Context(), userDocRef)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 }
 
 func (db *DB) RearrageItems(w http.ResponseWriter, r *http.Request) {
-	log.Println("Rearrage items")
+	logging.Logger(r.Context()).Debug("Rearrage items")
 
-	authHeader := r.Header.Get("Authorization")
-	groceryCollection, err := db.getCollectionFromHeader(authHeader, GROCERY)
+	groceryCollection, err := getUserCollection(db.Repo, r, GROCERY)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
 	var body struct {
-		OldIndex int64 `json:"old_index"`
-		NewIndex int64 `json:"new_index"`
+		OldIndex int64 `json:"old_index" validate:"required,min=1"`
+		NewIndex int64 `json:"new_index" validate:"required,min=1"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("error unmarshaling requst:", err)
+	if !problem.Decode(w, r, &body) {
 		return
 	}
 
-	if body.OldIndex == body.NewIndex || body.OldIndex <= 0 || body.NewIndex <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("indicies must be > 0 and not equal")
+	if body.OldIndex == body.NewIndex {
+		problem.WriteInvalid(w, r, validate.Errors{{Field: "new_index", Message: "must differ from old_index"}})
 		return
 	}
 
 	err = db.Repo.RearrageItems(r.Context(), groceryCollection, body.OldIndex, body.NewIndex)
 	if err != nil {
-		log.Printf("failed to rearrage items: %v", err)
+		writeError(w, r, err)
+		return
 	}
 }
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
+)
+
+// writeError responds with the problem a repository error amounts to.
+// Errors the client cannot act on are logged, and only described as
+// internal or unavailable.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, item.ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, err.Error())
+	case errors.Is(err, item.ErrConflict):
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, err.Error())
+	case errors.Is(err, item.ErrInvalid):
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalid, err.Error())
+	case errors.Is(err, item.ErrUnavailable):
+		logging.Logger(r.Context()).Error("store unavailable", "err", err)
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, "the service is temporarily unavailable, try again shortly")
+	default:
+		logging.Logger(r.Context()).Error("internal error", "err", err)
+		problem.Write(w, r, http.StatusInternalServerError, problem.CodeInternal, "")
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
+	"github.com/NathanRJohnson/live-backend/wtfridge/limiter"
+)
+
+// the largest sign-in body that is read to find the username
+const maxThrottledBodySize = 1 << 20
+
+// Throttle rate limits the sign-in, sign-up and refresh routes per client IP
+// and per username, and backs off or locks out keys that keep failing.
+type Throttle struct {
+	ByIP       *limiter.Limiter
+	ByUsername *limiter.Limiter
+	// the proxies whose X-Real-IP header names the client
+	TrustedProxies []netip.Prefix
+}
+
+type throttleKey struct {
+	limiter *limiter.Limiter
+	key     string
+}
+
+// Protect rate limits sign-in and refresh, counting answers that turn the
+// credentials down as failures, and others that succeed as successes.
+func (t *Throttle) Protect(next http.HandlerFunc) http.HandlerFunc {
+	return t.protect(next, true)
+}
+
+// ProtectSignUp rate limits sign-up, without counting its answers either
+// way. A username that is taken says nothing about whoever signs in with
+// it, so must not lock its owner out, and signing up must not reset the
+// backoff of an address that keeps failing to sign in.
+func (t *Throttle) ProtectSignUp(next http.HandlerFunc) http.HandlerFunc {
+	return t.protect(next, false)
+}
+
+func (t *Throttle) protect(next http.HandlerFunc, count bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := t.keys(r)
+		if err != nil {
+			logging.Logger(r.Context()).Info("error reading request", "err", err)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
+			return
+		}
+
+		for _, k := range keys {
+			wait, err := k.limiter.Allow(r.Context(), k.key)
+			if err != nil {
+				// an unavailable limiter should not lock everyone out
+				logging.Logger(r.Context()).Error("failed to check rate limit", "err", err)
+				continue
+			}
+			if wait > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				problem.Write(w, r, http.StatusTooManyRequests, problem.CodeRateLimited, "too many attempts, try again later")
+				return
+			}
+		}
+
+		if !count {
+			next(w, r)
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		for _, k := range keys {
+			switch {
+			case rec.status < http.StatusBadRequest:
+				err = k.limiter.Success(r.Context(), k.key)
+			case isAuthFailure(rec.status):
+				err = k.limiter.Failure(r.Context(), k.key)
+			default:
+				continue
+			}
+			if err != nil {
+				logging.Logger(r.Context()).Error("failed to record attempt", "err", err)
+			}
+		}
+	}
+}
+
+func (t *Throttle) keys(r *http.Request) ([]throttleKey, error) {
+	var keys []throttleKey
+
+	if t.ByIP != nil {
+		keys = append(keys, throttleKey{t.ByIP, "ip:" + t.clientIP(r)})
+	}
+
+	if t.ByUsername != nil && r.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxThrottledBodySize))
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+
+		var body struct {
+			Username string `json:"username"`
+		}
+		// malformed bodies are rejected by the handler itself
+		if json.Unmarshal(data, &body) == nil && body.Username != "" {
+			keys = append(keys, throttleKey{t.ByUsername, "user:" + strings.ToLower(body.Username)})
+		}
+	}
+
+	return keys, nil
+}
+
+// isAuthFailure reports whether status turns the credentials down: an
+// unknown username or an expired refresh token, or a disabled account.
+func isAuthFailure(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// clientIP prefers the address set by the proxy in front of the service,
+// when the request came through one of the trusted proxies. Anyone else
+// could send any address in the header.
+func (t *Throttle) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if ip := r.Header.Get("X-Real-IP"); ip != "" && t.trusts(host) {
+		return ip
+	}
+	return host
+}
+
+func (t *Throttle) trusts(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range t.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfridge/limiter"
+)
+
+func TestClientIPOnlyBelievesTrustedProxies(t *testing.T) {
+	throttle := &Throttle{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("172.28.0.10/32")}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		want       string
+	}{
+		{"through the proxy", "172.28.0.10:41000", "203.0.113.7", "203.0.113.7"},
+		{"through the proxy without the header", "172.28.0.10:41000", "", "172.28.0.10"},
+		{"straight from a client", "198.51.100.4:52000", "203.0.113.7", "198.51.100.4"},
+		{"from a mapped address", "[::ffff:172.28.0.10]:41000", "203.0.113.7", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/signin", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := throttle.clientIP(r); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyTurnedDownCredentialsAreFailures(t *testing.T) {
+	policy := limiter.DefaultPolicy
+	policy.FreeFailures = 0
+	now := time.Now().UTC()
+	throttle := &Throttle{
+		ByUsername: &limiter.Limiter{Store: limiter.NewMemoryStore(), Policy: policy, Now: func() time.Time { return now }},
+	}
+	answer := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(status) }
+	}
+	attempt := func(h http.HandlerFunc) int {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("POST", "/signin", strings.NewReader(`{"username":"nathan"}`)))
+		return rec.Code
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		backoff bool
+	}{
+		{"sign-up of a taken username", throttle.ProtectSignUp(answer(http.StatusConflict)), false},
+		{"sign-up turned down", throttle.ProtectSignUp(answer(http.StatusUnauthorized)), false},
+		{"sign-in of a bad request", throttle.Protect(answer(http.StatusBadRequest)), false},
+		{"sign-in failing upstream", throttle.Protect(answer(http.StatusServiceUnavailable)), false},
+		{"sign-in of an unknown username", throttle.Protect(answer(http.StatusUnauthorized)), true},
+		{"sign-in of a disabled account", throttle.Protect(answer(http.StatusForbidden)), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// each case starts a minute later, once any backoff is over
+			now = now.Add(time.Minute)
+			attempt(tt.handler)
+			got := attempt(throttle.Protect(answer(http.StatusOK))) == http.StatusTooManyRequests
+			if got != tt.backoff {
+				t.Errorf("backing off %t, want %t", got, tt.backoff)
+			}
+		})
+	}
+}
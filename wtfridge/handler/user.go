@@ -1,13 +1,14 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/problem"
 	"github.com/NathanRJohnson/live-backend/wtfridge/model"
 	"github.com/NathanRJohnson/live-backend/wtfridge/repository/item"
 	"github.com/golang-jwt/jwt/v4"
@@ -15,11 +16,20 @@ import (
 
 type User struct {
 	Repo *item.FirebaseRepo
+	// finance transactions are included in exports when set
+	FinanceURL string
+	Client     *http.Client
+	// Go runs fn in the background until the service shuts down, as
+	// server.Server.Go does
+	Go func(name string, fn func(ctx context.Context) error)
 }
 
 var (
 	sessionKey []byte
 	refreshKey []byte
+
+	sessionTTL = 30 * time.Minute
+	refreshTTL = 6 * time.Hour
 )
 
 func (u *User) SetKeys(s string, r string) {
@@ -27,98 +37,107 @@ func (u *User) SetKeys(s string, r string) {
 	refreshKey = []byte(r)
 }
 
+// SetTokenLifetimes sets how long newly issued session and refresh tokens
+// are valid for.
+func (u *User) SetTokenLifetimes(session time.Duration, refresh time.Duration) {
+	sessionTTL = session
+	refreshTTL = refresh
+}
+
 func (u *User) Create(w http.ResponseWriter, r *http.Request) {
-	log.Println("Create a user")
+	logging.Logger(r.Context()).Debug("Create a user")
 
 	var body struct {
-		Username string `json:"username"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("error unmarshalling request:", err)
-		return
+		Username string `json:"username" validate:"required,max=64"`
+		// the spreadsheet the finance service lets the user's tokens use
+		SheetRef string `json:"sheet_ref" validate:"max=200"`
 	}
 
-	if body.Username == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("username cannot be blank.")
+	if !problem.Decode(w, r, &body) {
 		return
 	}
 
+	// the spreadsheet is linked once the user exists, the same way as
+	// SetSheet links it
+	now := time.Now().UTC()
 	user := model.User{
-		Username: body.Username,
+		Username:  body.Username,
+		CreatedAt: &now,
 	}
 
 	// TODO: Check for collisions
 
-	err := u.Repo.CreateUser(r.Context(), user)
+	// the name of an account that is still being deleted cannot be reused yet
+	deletion, err := u.Repo.FetchDeletion(r.Context(), user.Username)
 	if err != nil {
-		log.Println("failed to create user.")
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+	if deletion != nil && deletion.Status == model.DeletionPending {
+		problem.Write(w, r, http.StatusConflict, problem.CodeConflict, "username is not available")
 		return
 	}
 
-	jwt, refresh, err := getSignInTokens(user.Username)
+	err = u.Repo.CreateUser(r.Context(), user)
 	if err != nil {
-		log.Println("failed to generate session tokens:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
 	}
 
-	tokens := map[string]interface{}{
-		"session": jwt,
-		"refresh": refresh,
+	if body.SheetRef != "" {
+		if err := u.linkSheet(r.Context(), user.Username, body.SheetRef); err != nil {
+			// the account is not kept without the spreadsheet it was asked
+			// for, so signing up can be tried again
+			if err := u.Repo.DiscardUser(r.Context(), user.Username); err != nil {
+				logging.Logger(r.Context()).Error("failed to discard user", "err", err)
+			}
+			writeLinkError(w, r, err)
+			return
+		}
+		user.SheetRef = body.SheetRef
 	}
 
-	res, err := json.Marshal(tokens)
+	jwt, refresh, err := getSignInTokens(user)
 	if err != nil {
-		log.Println("failed to marshal:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Write(res)
+	tokens := map[string]interface{}{
+		"session": jwt,
+		"refresh": refresh,
+	}
+
+	writeJSON(w, r, http.StatusOK, tokens)
 }
 
 func (u *User) Read(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		Username string `json:"username"`
+		Username string `json:"username" validate:"required,max=64"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("error unmarshalling request:", err)
+	if !problem.Decode(w, r, &body) {
 		return
 	}
 
-	if body.Username == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("username cannot be blank.")
+	found, err := u.Repo.FetchUser(r.Context(), body.Username)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	user := model.User{
-		Username: body.Username,
-	}
-
-	userCollection := u.Repo.GetCollectionRef("USER", nil)
-	userDoc := u.Repo.GetDocRef(userCollection, body.Username)
-	exists, err := u.Repo.DocExists(r.Context(), userDoc)
-	if err != nil {
-		log.Println("unable to retrive snapshot from document:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+	if found == nil {
+		logging.Logger(r.Context()).Info("user not found")
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "unknown username")
 		return
 	}
-	if !exists {
-		log.Println("user not found")
-		w.WriteHeader(http.StatusInternalServerError)
+	if found.Disabled {
+		problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "account is disabled")
 		return
 	}
 
-	jwt, refresh, err := getSignInTokens(user.Username)
+	jwt, refresh, err := getSignInTokens(*found)
 	if err != nil {
-		log.Println("failed to generate session tokens:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -127,70 +146,160 @@ func (u *User) Read(w http.ResponseWriter, r *http.Request) {
 		"refresh": refresh,
 	}
 
-	res, err := json.Marshal(tokens)
-	if err != nil {
-		log.Println("failed to marshal:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	w.Write(res)
+	writeJSON(w, r, http.StatusOK, tokens)
 }
 
 func (u *User) Refresh(w http.ResponseWriter, r *http.Request) {
 	authHeader := r.Header.Get("Authorization")
 	session_token, err := getTokenFromHeader(authHeader)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
 		return
 	}
 
 	// check that the session token is actually expired
 	_, err = validateSessionToken(session_token)
 	if err == nil {
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
 	var body struct {
-		RefreshToken string `json:"refresh_token"`
+		RefreshToken string `json:"refresh_token" validate:"required"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("error unmarshalling request:", err)
+	if !problem.Decode(w, r, &body) {
 		return
 	}
 
-	newSessionToken, err := validateRefreshToken(body.RefreshToken)
+	claims, err := validateRefreshToken(body.RefreshToken)
 	if err != nil {
-		log.Println("failed to issue new session token:", err)
+		logging.Logger(r.Context()).Error("failed to issue new session token", "err", err)
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
+		return
+	}
+
+	user, err := checkCredentials(r.Context(), u.Repo, claims.Username, claims.issuedAt())
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, err.Error())
+		return
+	}
+
+	newSessionToken, _, err := getSignInTokens(*user)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
 
 	jsonToken := map[string]interface{}{
 		"session_token": newSessionToken,
 	}
 
-	res, err := json.Marshal(jsonToken)
+	writeJSON(w, r, http.StatusOK, jsonToken)
+}
+
+// SetSheet links the spreadsheet holding the user's finances to their
+// account, and signs them in again, as session tokens carry the spreadsheet
+// the finance service lets them use. Tokens issued earlier keep the
+// spreadsheet they were issued with until they expire. A spreadsheet the
+// finance service cannot open, or linked to another account, is refused.
+func (u *User) SetSheet(w http.ResponseWriter, r *http.Request) {
+	logging.Logger(r.Context()).Debug("Set a user's spreadsheet")
+
+	principal, ok := principalFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "not signed in")
+		return
+	}
+
+	var body struct {
+		SheetRef string `json:"sheet_ref" validate:"required,max=200"`
+	}
+
+	if !problem.Decode(w, r, &body) {
+		return
+	}
+
+	err := u.linkSheet(r.Context(), principal.Username, body.SheetRef)
+	if err != nil {
+		writeLinkError(w, r, err)
+		return
+	}
+
+	jwt, refresh, err := getSignInTokens(model.User{Username: principal.Username, SheetRef: body.SheetRef})
 	if err != nil {
-		log.Println("failed ot marshal:", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	w.Write(res)
+	tokens := map[string]interface{}{
+		"session": jwt,
+		"refresh": refresh,
+	}
+
+	writeJSON(w, r, http.StatusOK, tokens)
+}
+
+var (
+	// errNoFinance is returned by linkSheet when there is no finance
+	// service to check the spreadsheet with.
+	errNoFinance = errors.New("spreadsheets cannot be linked without the finance service")
+	// errSheetNotShared is returned by linkSheet when the finance service
+	// cannot open the spreadsheet.
+	errSheetNotShared = errors.New("the spreadsheet is not shared with the finance service")
+	// errFinanceFailed is returned by linkSheet when the finance service
+	// could not answer whether it can open the spreadsheet.
+	errFinanceFailed = errors.New("the finance service could not check the spreadsheet")
+)
+
+// linkSheet links sheetRef to the account of username, once the finance
+// service has opened it with its service account. It fails with
+// item.ErrConflict when the spreadsheet is linked to another account.
+func (u *User) linkSheet(ctx context.Context, username, sheetRef string) error {
+	if err := u.checkSheet(ctx, username, sheetRef); err != nil {
+		return err
+	}
+	return u.Repo.SetUserSheet(ctx, username, sheetRef)
+}
+
+// writeLinkError responds with the problem an error of linkSheet amounts to.
+func writeLinkError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errSheetNotShared):
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalid, err.Error())
+	case errors.Is(err, errNoFinance):
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeUnavailable, err.Error())
+	case errors.Is(err, errFinanceFailed):
+		logging.Logger(r.Context()).Error("failed to check spreadsheet", "err", err)
+		problem.Write(w, r, http.StatusBadGateway, problem.CodeUpstream, errFinanceFailed.Error())
+	default:
+		writeError(w, r, err)
+	}
 }
 
 type Claims struct {
 	Username string `json:"username"`
+	// the spreadsheet linked to the user's account, in session tokens
+	SheetRef string `json:"sheet_ref,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func getSignInTokens(username string) (string, string, error) {
+// tokens issued before issue times were recorded report the zero time
+func (c *Claims) issuedAt() time.Time {
+	if c.IssuedAt == nil {
+		return time.Time{}
+	}
+	return c.IssuedAt.Time
+}
+
+func getSignInTokens(user model.User) (string, string, error) {
+	now := time.Now()
 	sessionToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
-		Username: username,
+		Username: user.Username,
+		SheetRef: user.SheetRef,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 30)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(sessionTTL)),
 		},
 	})
 	sessionTokenString, err := sessionToken.SignedString(sessionKey)
@@ -198,9 +307,12 @@ func getSignInTokens(username string) (string, string, error) {
 		return "", "", err
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": username,
-		"exp":      time.Now().Add(time.Hour * 6).Unix(),
+	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(refreshTTL)),
+		},
 	})
 	refreshTokenString, err := refreshToken.SignedString(refreshKey)
 	if err != nil {
@@ -229,8 +341,8 @@ func validateSessionToken(tokenString string) (*Claims, error) {
 	}
 }
 
-func validateRefreshToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+func validateRefreshToken(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
@@ -238,19 +350,14 @@ func validateRefreshToken(tokenString string) (string, error) {
 	})
 
 	if err != nil {
-		return "", errors.New("invalid or expired refresh token")
+		return nil, errors.New("invalid or expired refresh token")
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		username := claims["username"].(string)
-		sessionToken, _, err := getSignInTokens(username)
-		if err != nil {
-			return "", err
-		}
-		return sessionToken, nil
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid && claims.Username != "" {
+		return claims, nil
 	}
 
-	return "", errors.New("could not pull value from refresh token")
+	return nil, errors.New("could not pull value from refresh token")
 }
 
 func getUserClaimsFromHeader(header string) (*Claims, error) {
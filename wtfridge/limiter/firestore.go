@@ -0,0 +1,46 @@
+package limiter
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const firestoreCollection = "RATE_LIMIT"
+
+// FirestoreStore keeps limiter state in Firestore, so that every replica
+// sees the same state. A TTL policy on the Expires field lets Firestore
+// remove stale documents.
+type FirestoreStore struct {
+	Client *firestore.Client
+}
+
+func (f *FirestoreStore) Update(ctx context.Context, key string, fn func(s *State)) error {
+	// keys may contain characters that are not allowed in a document ID
+	docRef := f.Client.Collection(firestoreCollection).Doc(url.PathEscape(key))
+
+	return f.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var state State
+
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			err = doc.DataTo(&state)
+			if err != nil {
+				return err
+			}
+			if time.Now().UTC().After(state.Expires) {
+				state = State{}
+			}
+		}
+
+		fn(&state)
+		return tx.Set(docRef, state)
+	})
+}
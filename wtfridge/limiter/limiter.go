@@ -0,0 +1,175 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+)
+
+// State is what the limiter keeps for each key.
+type State struct {
+	// requests seen in the current window
+	Hits        int
+	WindowStart time.Time
+
+	// consecutive failures, forgotten after Policy.FailureTTL
+	Failures    int
+	LastFailure time.Time
+
+	// no requests are allowed for the key until this time
+	BlockedUntil time.Time
+
+	// the state can be discarded after this time
+	Expires time.Time
+}
+
+// Store holds limiter state. Stores shared between replicas let every
+// replica agree on who is throttled.
+type Store interface {
+	// Update atomically applies fn to the state held for key. Expired or
+	// missing state is passed to fn as the zero State.
+	Update(ctx context.Context, key string, fn func(s *State)) error
+}
+
+type Policy struct {
+	// requests allowed per key in each window
+	Limit  int
+	Window time.Duration
+
+	// failures allowed before backoff starts
+	FreeFailures int
+	// wait imposed by the first failure past FreeFailures. It doubles with
+	// each failure after that, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// failures after which the key is locked out for LockoutDuration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+
+	// failures are forgotten after this long without another
+	FailureTTL time.Duration
+}
+
+var DefaultPolicy = Policy{
+	Limit:            20,
+	Window:           time.Minute,
+	FreeFailures:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	LockoutThreshold: 10,
+	LockoutDuration:  15 * time.Minute,
+	FailureTTL:       time.Hour,
+}
+
+// Limiter applies Policy to the keys in Store. Lockouts are logged with the
+// logger of the request, marked with a security attribute.
+type Limiter struct {
+	Store  Store
+	Policy Policy
+	// overridden in tests
+	Now func() time.Time
+}
+
+// Allow records an attempt against key. When the attempt is not allowed, it
+// returns how long the caller has to wait before trying again.
+func (l *Limiter) Allow(ctx context.Context, key string) (time.Duration, error) {
+	now := l.now()
+	var wait time.Duration
+
+	// stores may run fn more than once
+	err := l.Store.Update(ctx, key, func(s *State) {
+		wait = 0
+		if now.Before(s.BlockedUntil) {
+			wait = s.BlockedUntil.Sub(now)
+			return
+		}
+
+		if s.Failures > 0 && now.Sub(s.LastFailure) >= l.Policy.FailureTTL {
+			s.Failures = 0
+		}
+
+		if now.Sub(s.WindowStart) >= l.Policy.Window {
+			s.WindowStart = now
+			s.Hits = 0
+		}
+
+		if s.Hits >= l.Policy.Limit {
+			wait = s.WindowStart.Add(l.Policy.Window).Sub(now)
+			return
+		}
+
+		s.Hits++
+		s.Expires = l.expiry(s)
+	})
+
+	return wait, err
+}
+
+// Failure records a failed attempt against key, imposing a backoff or a
+// lockout once enough failures have been seen.
+func (l *Limiter) Failure(ctx context.Context, key string) error {
+	now := l.now()
+	locked := false
+	var state State
+
+	err := l.Store.Update(ctx, key, func(s *State) {
+		locked = false
+		s.Failures++
+		s.LastFailure = now
+
+		if s.Failures >= l.Policy.LockoutThreshold {
+			s.BlockedUntil = now.Add(l.Policy.LockoutDuration)
+			locked = true
+		} else if s.Failures > l.Policy.FreeFailures {
+			s.BlockedUntil = now.Add(l.backoff(s.Failures))
+		}
+
+		s.Expires = l.expiry(s)
+		state = *s
+	})
+
+	if err == nil && locked {
+		logging.Logger(ctx).Warn("key locked out", "security", "lockout", "key", key, "failures", state.Failures, "until", state.BlockedUntil)
+	}
+
+	return err
+}
+
+// Success clears the failures recorded against key.
+func (l *Limiter) Success(ctx context.Context, key string) error {
+	return l.Store.Update(ctx, key, func(s *State) {
+		s.Failures = 0
+		s.Expires = l.expiry(s)
+	})
+}
+
+func (l *Limiter) backoff(failures int) time.Duration {
+	delay := l.Policy.BaseDelay
+	for i := l.Policy.FreeFailures + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= l.Policy.MaxDelay {
+			return l.Policy.MaxDelay
+		}
+	}
+	return delay
+}
+
+func (l *Limiter) expiry(s *State) time.Time {
+	expires := s.WindowStart.Add(l.Policy.Window)
+	if s.BlockedUntil.After(expires) {
+		expires = s.BlockedUntil
+	}
+	if s.Failures > 0 && s.LastFailure.Add(l.Policy.FailureTTL).After(expires) {
+		expires = s.LastFailure.Add(l.Policy.FailureTTL)
+	}
+	return expires
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now().UTC()
+}
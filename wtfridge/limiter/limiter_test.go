@@ -0,0 +1,123 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is the time a limiter is told it is, from a start near the real
+// time, as MemoryStore expires state by the real time.
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time          { return c.now }
+func (c *clock) advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newLimiter(policy Policy) (*Limiter, *clock) {
+	c := &clock{now: time.Now().UTC()}
+	return &Limiter{Store: NewMemoryStore(), Policy: policy, Now: c.Now}, c
+}
+
+func allow(t *testing.T, l *Limiter, key string) time.Duration {
+	t.Helper()
+	wait, err := l.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wait
+}
+
+func fail(t *testing.T, l *Limiter, key string, times int) {
+	t.Helper()
+	for i := 0; i < times; i++ {
+		if err := l.Failure(context.Background(), key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAllowCountsRequestsInEachWindow(t *testing.T) {
+	l, c := newLimiter(Policy{Limit: 3, Window: time.Minute, LockoutThreshold: 10, FailureTTL: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if wait := allow(t, l, "ip:a"); wait != 0 {
+			t.Fatalf("request %d waits %v, want none", i+1, wait)
+		}
+	}
+	c.advance(20 * time.Second)
+	if wait := allow(t, l, "ip:a"); wait != 40*time.Second {
+		t.Errorf("a request past the limit waits %v, want the 40s left in the window", wait)
+	}
+	if wait := allow(t, l, "ip:b"); wait != 0 {
+		t.Errorf("another key waits %v, want none", wait)
+	}
+
+	c.advance(40 * time.Second)
+	if wait := allow(t, l, "ip:a"); wait != 0 {
+		t.Errorf("a request in the next window waits %v, want none", wait)
+	}
+}
+
+func TestFailuresBackOffThenLockOut(t *testing.T) {
+	policy := Policy{
+		Limit:            100,
+		Window:           time.Minute,
+		FreeFailures:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		LockoutThreshold: 7,
+		LockoutDuration:  15 * time.Minute,
+		FailureTTL:       time.Hour,
+	}
+	l, c := newLimiter(policy)
+
+	// the delay after each failure past the free ones, doubling up to the
+	// maximum, then the lockout
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 15 * time.Minute}
+	for i, delay := range want {
+		fail(t, l, "user:nathan", 1)
+		if wait := allow(t, l, "user:nathan"); wait != delay {
+			t.Errorf("after %d failures waits %v, want %v", i+1, wait, delay)
+		}
+		c.advance(delay)
+	}
+
+	// the lockout ends on time, and the next failure locks it again
+	c.advance(-time.Second)
+	if wait := allow(t, l, "user:nathan"); wait != time.Second {
+		t.Errorf("a second before the lockout ends waits %v, want 1s", wait)
+	}
+	c.advance(time.Second)
+	if wait := allow(t, l, "user:nathan"); wait != 0 {
+		t.Errorf("once the lockout ended waits %v, want none", wait)
+	}
+	fail(t, l, "user:nathan", 1)
+	if wait := allow(t, l, "user:nathan"); wait != 15*time.Minute {
+		t.Errorf("a failure after a lockout waits %v, want another lockout", wait)
+	}
+}
+
+func TestSuccessForgetsFailures(t *testing.T) {
+	l, _ := newLimiter(Policy{Limit: 100, Window: time.Minute, FreeFailures: 2, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutThreshold: 5, FailureTTL: time.Hour})
+
+	fail(t, l, "user:nathan", 2)
+	if err := l.Success(context.Background(), "user:nathan"); err != nil {
+		t.Fatal(err)
+	}
+	fail(t, l, "user:nathan", 2)
+	if wait := allow(t, l, "user:nathan"); wait != 0 {
+		t.Errorf("free failures after a success wait %v, want none", wait)
+	}
+}
+
+func TestFailuresAreForgottenAfterTheirTTL(t *testing.T) {
+	l, c := newLimiter(Policy{Limit: 100, Window: time.Minute, FreeFailures: 2, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutThreshold: 5, FailureTTL: time.Hour})
+
+	fail(t, l, "user:nathan", 2)
+	c.advance(time.Hour)
+	allow(t, l, "user:nathan")
+	fail(t, l, "user:nathan", 2)
+	if wait := allow(t, l, "user:nathan"); wait != 0 {
+		t.Errorf("free failures an hour after the last wait %v, want none", wait)
+	}
+}
@@ -0,0 +1,49 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// how many updates happen between sweeps of expired state
+const sweepInterval = 1000
+
+// MemoryStore keeps limiter state in process. It is only suitable when a
+// single replica is running.
+type MemoryStore struct {
+	mu      sync.Mutex
+	states  map[string]State
+	updates int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string]State),
+	}
+}
+
+func (m *MemoryStore) Update(ctx context.Context, key string, fn func(s *State)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	m.updates++
+	if m.updates%sweepInterval == 0 {
+		for k, s := range m.states {
+			if now.After(s.Expires) {
+				delete(m.states, k)
+			}
+		}
+	}
+
+	state, ok := m.states[key]
+	if !ok || now.After(state.Expires) {
+		state = State{}
+	}
+
+	fn(&state)
+	m.states[key] = state
+	return nil
+}
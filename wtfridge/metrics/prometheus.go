@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus records metrics in a registry of its own, served by Handler.
+type Prometheus struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	repoDuration    *prometheus.HistogramVec
+	txAttempts      *prometheus.HistogramVec
+	txRetries       *prometheus.CounterVec
+	listItems       *prometheus.GaugeVec
+	pendingGrocery  *prometheus.GaugeVec
+}
+
+// NewPrometheus returns a Recorder whose metrics are named
+// <namespace>_<name>.
+func NewPrometheus(namespace string) *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests served, by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve requests, by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		repoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_call_duration_seconds",
+			Help:      "Time taken by repository methods.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		txAttempts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "transaction_attempts",
+			Help:      "Attempts made by each Firestore transaction.",
+			Buckets:   []float64{1, 2, 3, 4, 5},
+		}, []string{"method"}),
+		txRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transaction_retries_total",
+			Help:      "Firestore transaction attempts after the first.",
+		}, []string{"method"}),
+		listItems: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "list_items",
+			Help:      "Items in each user's lists.",
+		}, []string{"user", "list"}),
+		pendingGrocery: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "grocery_pending_items",
+			Help:      "Grocery items each user has not yet checked off.",
+		}, []string{"user"}),
+	}
+
+	p.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		p.requests,
+		p.requestDuration,
+		p.repoDuration,
+		p.txAttempts,
+		p.txRetries,
+		p.listItems,
+		p.pendingGrocery,
+	)
+	return p
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+func (p *Prometheus) ObserveRequest(method string, route string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	p.requests.WithLabelValues(method, route, code).Inc()
+	p.requestDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) ObserveRepoCall(method string, duration time.Duration) {
+	p.repoDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+func (p *Prometheus) ObserveTransaction(method string, attempts int) {
+	p.txAttempts.WithLabelValues(method).Observe(float64(attempts))
+	if attempts > 1 {
+		p.txRetries.WithLabelValues(method).Add(float64(attempts - 1))
+	}
+}
+
+func (p *Prometheus) SetListItems(lists []ListItems) {
+	// deleted users should drop out rather than keep their last counts
+	p.listItems.Reset()
+	p.pendingGrocery.Reset()
+	for _, l := range lists {
+		p.listItems.WithLabelValues(l.Username, "fridge").Set(float64(l.Fridge))
+		p.listItems.WithLabelValues(l.Username, "grocery").Set(float64(l.Grocery))
+		p.pendingGrocery.WithLabelValues(l.Username).Set(float64(l.PendingGrocery))
+	}
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	ScopeFridgeRead   = "fridge:read"
+	ScopeFridgeWrite  = "fridge:write"
+	ScopeGroceryRead  = "grocery:read"
+	ScopeGroceryWrite = "grocery:write"
+	ScopeFinanceRead  = "finance:read"
+	ScopeFinanceWrite = "finance:write"
+)
+
+// Scopes lists every scope a personal access token may be granted.
+var Scopes = []string{
+	ScopeFridgeRead,
+	ScopeFridgeWrite,
+	ScopeGroceryRead,
+	ScopeGroceryWrite,
+	ScopeFinanceRead,
+	ScopeFinanceWrite,
+}
+
+// AccessToken is a personal access token. Only the SHA-256 hash of the
+// token is stored; the plaintext is returned once, when it is created.
+type AccessToken struct {
+	TokenID   string     `json:"token_id"`
+	Username  string     `json:"-"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"-"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt *time.Time `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+func (t AccessToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+func (t AccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+)
+
+const (
+	DeletionPending  = "pending"
+	DeletionComplete = "complete"
+)
+
+// Deletion records that a user asked for their account to be deleted. It is
+// written before anything is removed so an interrupted deletion can be
+// resumed, and is kept afterwards to reject tokens issued before it.
+type Deletion struct {
+	Username    string     `json:"username"`
+	Status      string     `json:"status"`
+	RequestedAt *time.Time `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ExportedDocument is a firestore document, and every collection below it.
+type ExportedDocument struct {
+	ID   string                 `json:"id"`
+	Data map[string]interface{} `json:"data,omitempty"`
+	// the fields of Data holding timestamps, which JSON turns into text,
+	// with the names of nested fields joined by dots
+	Timestamps  []string                      `json:"timestamps,omitempty"`
+	Collections map[string][]ExportedDocument `json:"collections,omitempty"`
+}
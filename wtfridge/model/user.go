@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+)
+
+type User struct {
+	Username  string     `json:"username"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// disabled users cannot sign in, and their tokens are rejected
+	Disabled bool `json:"disabled"`
+	// tokens issued before this time are rejected
+	CredentialsResetAt *time.Time `json:"credentials_reset_at,omitempty"`
+	// the spreadsheet holding the user's finances, the only one the finance
+	// service lets their tokens use
+	SheetRef string `json:"sheet_ref,omitempty"`
+}
@@ -0,0 +1,109 @@
+package item
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// access tokens live in a top level collection keyed by the token hash, so a
+// presented token can be resolved with a single document read
+const tokenCollection = "TOKEN"
+
+func (r *FirebaseRepo) InsertToken(ctx context.Context, token model.AccessToken) error {
+	defer metrics.Track(r.Metrics, "InsertToken")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.InsertToken")
+	defer span.End()
+
+	_, err := r.Client.Collection(tokenCollection).Doc(token.Hash).Create(ctx, token)
+	if err != nil {
+		logging.Logger(ctx).Error("Failed adding token", "err", err)
+	}
+	return storeError(err)
+}
+
+func (r *FirebaseRepo) FetchTokenByHash(ctx context.Context, hash string) (*model.AccessToken, error) {
+	defer metrics.Track(r.Metrics, "FetchTokenByHash")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchTokenByHash")
+	defer span.End()
+
+	doc, err := r.Client.Collection(tokenCollection).Doc(hash).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("token: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	var token model.AccessToken
+	err = doc.DataTo(&token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *FirebaseRepo) FetchTokens(ctx context.Context, username string) ([]model.AccessToken, error) {
+	defer metrics.Track(r.Metrics, "FetchTokens")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchTokens")
+	defer span.End()
+
+	docs, err := r.Client.Collection(tokenCollection).Where("Username", "==", username).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []model.AccessToken{}
+	for _, doc := range docs {
+		var token model.AccessToken
+		err = doc.DataTo(&token)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func (r *FirebaseRepo) DeleteToken(ctx context.Context, username string, tokenID string) error {
+	defer metrics.Track(r.Metrics, "DeleteToken")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.DeleteToken")
+	defer span.End()
+
+	docs, err := r.Client.Collection(tokenCollection).Where("TokenID", "==", tokenID).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+
+	// a token belonging to another user is reported the same as a missing one
+	for _, doc := range docs {
+		owner, err := doc.DataAt("Username")
+		if err != nil {
+			return err
+		}
+		if owner == username {
+			_, err = doc.Ref.Delete(ctx)
+			return err
+		}
+	}
+	return fmt.Errorf("failed to delete token %s: %w", tokenID, ErrNotFound)
+}
+
+func (r *FirebaseRepo) TouchToken(ctx context.Context, hash string, usedAt time.Time) error {
+	defer metrics.Track(r.Metrics, "TouchToken")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.TouchToken")
+	defer span.End()
+
+	_, err := r.Client.Collection(tokenCollection).Doc(hash).Update(ctx, []firestore.Update{
+		{Path: "LastUsed", Value: usedAt},
+	})
+	return err
+}
@@ -0,0 +1,546 @@
+package item
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const deletionCollection = "DELETION"
+
+// how many documents are read per round while deleting a collection
+const deleteBatchSize = 200
+
+// ExportDocument reads a document and, recursively, every collection below
+// it. A missing document is exported without data, since firestore keeps
+// subcollections of documents that no longer exist.
+func (r *FirebaseRepo) ExportDocument(ctx context.Context, docRef *firestore.DocumentRef) (*model.ExportedDocument, error) {
+	defer metrics.Track(r.Metrics, "ExportDocument")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.ExportDocument")
+	defer span.End()
+
+	exported := &model.ExportedDocument{
+		ID:          docRef.ID,
+		Collections: make(map[string][]model.ExportedDocument),
+	}
+
+	snapshot, err := docRef.Get(ctx)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+	if err == nil {
+		exported.Data = snapshot.Data()
+		exported.Timestamps = timestampFields(exported.Data, "")
+	}
+
+	iter := docRef.Collections(ctx)
+	for {
+		collectionRef, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		docs := collectionRef.DocumentRefs(ctx)
+		exportedDocs := []model.ExportedDocument{}
+		for {
+			child, err := docs.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			exportedChild, err := r.ExportDocument(ctx, child)
+			if err != nil {
+				return nil, err
+			}
+			exportedDocs = append(exportedDocs, *exportedChild)
+		}
+		exported.Collections[collectionRef.ID] = exportedDocs
+	}
+
+	return exported, nil
+}
+
+func (r *FirebaseRepo) FetchUser(ctx context.Context, username string) (*model.User, error) {
+	defer metrics.Track(r.Metrics, "FetchUser")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchUser")
+	defer span.End()
+
+	doc, err := r.Client.Collection("USER").Doc(username).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	var user model.User
+	err = doc.DataTo(&user)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *FirebaseRepo) FetchUsers(ctx context.Context) ([]model.User, error) {
+	defer metrics.Track(r.Metrics, "FetchUsers")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchUsers")
+	defer span.End()
+
+	docs, err := r.Client.Collection("USER").Documents(ctx).GetAll()
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	users := []model.User{}
+	for _, doc := range docs {
+		var user model.User
+		err = doc.DataTo(&user)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// ListCounts is how many items a user has in each of their lists.
+type ListCounts struct {
+	Fridge         int
+	Grocery        int
+	PendingGrocery int
+}
+
+// CountListItems counts the items in a user's lists with aggregation
+// queries, without reading the items themselves.
+func (r *FirebaseRepo) CountListItems(ctx context.Context, username string) (*ListCounts, error) {
+	defer metrics.Track(r.Metrics, "CountListItems")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.CountListItems")
+	defer span.End()
+
+	userRef := r.Client.Collection("USER").Doc(username)
+
+	var counts ListCounts
+	var err error
+	counts.Fridge, err = r.countNumDocs(ctx, userRef.Collection("FRIDGE"))
+	if err != nil {
+		return nil, err
+	}
+	counts.Grocery, err = r.countNumDocs(ctx, userRef.Collection("GROCERY"))
+	if err != nil {
+		return nil, err
+	}
+	// checked off items are active, and are the next moved to the fridge
+	counts.PendingGrocery, err = r.countQuery(ctx, userRef.Collection("GROCERY").Where("IsActive", "==", false))
+	if err != nil {
+		return nil, err
+	}
+	return &counts, nil
+}
+
+func (r *FirebaseRepo) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	defer metrics.Track(r.Metrics, "SetUserDisabled")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.SetUserDisabled")
+	defer span.End()
+
+	_, err := r.Client.Collection("USER").Doc(username).Update(ctx, []firestore.Update{
+		{Path: "Disabled", Value: disabled},
+	})
+	return storeError(err)
+}
+
+// SetUserSheet links the spreadsheet holding a user's finances to their
+// account. It fails with ErrConflict when the spreadsheet is linked to
+// another account, as the finance service would let either use it.
+func (r *FirebaseRepo) SetUserSheet(ctx context.Context, username string, sheetRef string) error {
+	defer metrics.Track(r.Metrics, "SetUserSheet")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.SetUserSheet")
+	defer span.End()
+
+	userRef := r.Client.Collection("USER").Doc(username)
+	linked := r.Client.Collection("USER").Where("SheetRef", "==", sheetRef)
+
+	err := r.runTransaction(ctx, "SetUserSheet", func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(linked).GetAll()
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if doc.Ref.ID != username {
+				return fmt.Errorf("the spreadsheet is linked to another account: %w", ErrConflict)
+			}
+		}
+		return tx.Update(userRef, []firestore.Update{{Path: "SheetRef", Value: sheetRef}})
+	})
+	return storeError(err)
+}
+
+// DiscardUser deletes a user created moments ago, before anything was
+// stored under them, as when signing up fails after the user was created.
+func (r *FirebaseRepo) DiscardUser(ctx context.Context, username string) error {
+	defer metrics.Track(r.Metrics, "DiscardUser")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.DiscardUser")
+	defer span.End()
+
+	_, err := r.Client.Collection("USER").Doc(username).Delete(ctx)
+	return storeError(err)
+}
+
+// ResetCredentials revokes a user's access tokens, and every session and
+// refresh token issued to them so far.
+func (r *FirebaseRepo) ResetCredentials(ctx context.Context, username string) error {
+	defer metrics.Track(r.Metrics, "ResetCredentials")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.ResetCredentials")
+	defer span.End()
+
+	_, err := r.Client.Collection("USER").Doc(username).Update(ctx, []firestore.Update{
+		{Path: "CredentialsResetAt", Value: time.Now().UTC()},
+	})
+	if err != nil {
+		return err
+	}
+	return r.deleteTokens(ctx, username)
+}
+
+// RestoreDocument writes an exported document, and every collection below it,
+// back to firestore, replacing documents that already exist.
+func (r *FirebaseRepo) RestoreDocument(ctx context.Context, docRef *firestore.DocumentRef, exported *model.ExportedDocument) error {
+	defer metrics.Track(r.Metrics, "RestoreDocument")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.RestoreDocument")
+	defer span.End()
+
+	if exported.Data != nil {
+		timestamps := map[string]bool{}
+		for _, field := range exported.Timestamps {
+			timestamps[field] = true
+		}
+		data, _ := restoreValue(exported.Data, "", timestamps).(map[string]interface{})
+		_, err := docRef.Set(ctx, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, docs := range exported.Collections {
+		collectionRef := docRef.Collection(name)
+		for i := range docs {
+			err := r.RestoreDocument(ctx, collectionRef.Doc(docs[i].ID), &docs[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// timestampFields lists the fields of v, the field at path, that hold
+// timestamps. The elements of an array share its path.
+func timestampFields(v interface{}, path string) []string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		var fields []string
+		for k, e := range v {
+			fields = append(fields, timestampFields(e, fieldPath(path, k))...)
+		}
+		slices.Sort(fields)
+		return slices.Compact(fields)
+	case []interface{}:
+		var fields []string
+		for _, e := range v {
+			fields = append(fields, timestampFields(e, path)...)
+		}
+		slices.Sort(fields)
+		return slices.Compact(fields)
+	case time.Time:
+		return []string{path}
+	default:
+		return nil
+	}
+}
+
+func fieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// restoreValue undoes what a round trip through JSON does to firestore
+// values, v being the field at path: whole numbers come back as integers,
+// and the fields the export marked as timestamps as times. Other text is
+// kept as it is, even when it reads as a time.
+func restoreValue(v interface{}, path string, timestamps map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = restoreValue(e, fieldPath(path, k), timestamps)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = restoreValue(e, path, timestamps)
+		}
+		return v
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v)
+		}
+		return v
+	case string:
+		if !timestamps[path] {
+			return v
+		}
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func (r *FirebaseRepo) FetchDeletion(ctx context.Context, username string) (*model.Deletion, error) {
+	defer metrics.Track(r.Metrics, "FetchDeletion")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchDeletion")
+	defer span.End()
+
+	doc, err := r.Client.Collection(deletionCollection).Doc(username).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	var deletion model.Deletion
+	err = doc.DataTo(&deletion)
+	if err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+func (r *FirebaseRepo) FetchPendingDeletions(ctx context.Context) ([]model.Deletion, error) {
+	defer metrics.Track(r.Metrics, "FetchPendingDeletions")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchPendingDeletions")
+	defer span.End()
+
+	docs, err := r.Client.Collection(deletionCollection).Where("Status", "==", model.DeletionPending).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	deletions := []model.Deletion{}
+	for _, doc := range docs {
+		var deletion model.Deletion
+		err = doc.DataTo(&deletion)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, deletion)
+	}
+	return deletions, nil
+}
+
+// StartDeletion records that username is to be deleted. Deletions that are
+// already pending are left as they are.
+func (r *FirebaseRepo) StartDeletion(ctx context.Context, username string) (*model.Deletion, error) {
+	defer metrics.Track(r.Metrics, "StartDeletion")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.StartDeletion")
+	defer span.End()
+
+	docRef := r.Client.Collection(deletionCollection).Doc(username)
+	var deletion model.Deletion
+
+	userRef := r.Client.Collection("USER").Doc(username)
+
+	err := r.runTransaction(ctx, "StartDeletion", func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			err = doc.DataTo(&deletion)
+			if err != nil {
+				return err
+			}
+			if deletion.Status == model.DeletionPending {
+				return nil
+			}
+		}
+
+		_, err = tx.Get(userRef)
+		userExists := err == nil
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		now := time.Now().UTC()
+		deletion = model.Deletion{
+			Username:    username,
+			Status:      model.DeletionPending,
+			RequestedAt: &now,
+		}
+		err = tx.Set(docRef, deletion)
+		if err != nil {
+			return err
+		}
+
+		// the user's tokens stop working as soon as deletion starts
+		if userExists {
+			return tx.Update(userRef, []firestore.Update{{Path: "Disabled", Value: true}})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &deletion, nil
+}
+
+// DeleteUser removes a user's access tokens, their document and every
+// collection below it. Each step only removes what is left, so an
+// interrupted deletion is finished by calling DeleteUser again.
+func (r *FirebaseRepo) DeleteUser(ctx context.Context, username string) error {
+	defer metrics.Track(r.Metrics, "DeleteUser")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.DeleteUser")
+	defer span.End()
+
+	err := r.deleteTokens(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	userRef := r.Client.Collection("USER").Doc(username)
+	err = r.deleteDocument(ctx, userRef)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = r.Client.Collection(deletionCollection).Doc(username).Update(ctx, []firestore.Update{
+		{Path: "Status", Value: model.DeletionComplete},
+		{Path: "CompletedAt", Value: now},
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.Logger(ctx).Info("deleted user", "username", username)
+	return nil
+}
+
+func (r *FirebaseRepo) deleteTokens(ctx context.Context, username string) error {
+	return r.deleteQuery(ctx, r.Client.Collection(tokenCollection).Where("Username", "==", username))
+}
+
+// firestore does not delete subcollections along with their parent, so they
+// are removed first
+func (r *FirebaseRepo) deleteDocument(ctx context.Context, docRef *firestore.DocumentRef) error {
+	err := r.deleteCollections(ctx, docRef)
+	if err != nil {
+		return err
+	}
+
+	_, err = docRef.Delete(ctx)
+	return err
+}
+
+func (r *FirebaseRepo) deleteCollections(ctx context.Context, docRef *firestore.DocumentRef) error {
+	iter := docRef.Collections(ctx)
+	for {
+		collectionRef, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = r.deleteCollection(ctx, collectionRef)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// deleteCollection removes the documents of collectionRef a batch at a time,
+// each after the collections below it.
+func (r *FirebaseRepo) deleteCollection(ctx context.Context, collectionRef *firestore.CollectionRef) error {
+	for {
+		docs, err := collectionRef.Limit(deleteBatchSize).Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		for _, doc := range docs {
+			err = r.deleteCollections(ctx, doc.Ref)
+			if err != nil {
+				return err
+			}
+		}
+		err = r.bulkDelete(ctx, docs)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *FirebaseRepo) deleteQuery(ctx context.Context, query firestore.Query) error {
+	for {
+		docs, err := query.Limit(deleteBatchSize).Documents(ctx).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		err = r.bulkDelete(ctx, docs)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// bulkDelete deletes docs with one BulkWriter, and waits for every delete to
+// finish.
+func (r *FirebaseRepo) bulkDelete(ctx context.Context, docs []*firestore.DocumentSnapshot) error {
+	bw := r.Client.BulkWriter(ctx)
+	var jobs []*firestore.BulkWriterJob
+	for _, doc := range docs {
+		job, err := bw.Delete(doc.Ref)
+		if err != nil {
+			bw.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	bw.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package item
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NathanRJohnson/live-backend/wtfridge/model"
+)
+
+func TestRestoreOnlyTimestampsTheExportMarked(t *testing.T) {
+	created := time.Date(2024, time.May, 1, 12, 30, 0, 0, time.UTC)
+	data := map[string]interface{}{
+		"Name":        "2024-05-01T12:30:00Z",
+		"DateAdded":   created,
+		"Quantity":    int64(3),
+		"Price":       2.5,
+		"Reminder":    map[string]interface{}{"At": created, "Note": "2024-05-01T12:30:00Z"},
+		"Checkpoints": []interface{}{created, created},
+	}
+
+	exported := model.ExportedDocument{ID: "milk", Data: data, Timestamps: timestampFields(data, "")}
+	if want := []string{"Checkpoints", "DateAdded", "Reminder.At"}; !slices.Equal(exported.Timestamps, want) {
+		t.Fatalf("marked %v, want %v", exported.Timestamps, want)
+	}
+
+	encoded, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded model.ExportedDocument
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	timestamps := map[string]bool{}
+	for _, field := range decoded.Timestamps {
+		timestamps[field] = true
+	}
+
+	got := restoreValue(decoded.Data, "", timestamps)
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("restored %#v, want %#v", got, data)
+	}
+}
@@ -0,0 +1,51 @@
+package item
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors returned by the repository wrap one of these, so callers can tell
+// what went wrong with errors.Is.
+var (
+	// ErrNotFound is returned when the document asked for does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write clashes with an existing document.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalid is returned when the arguments cannot be used as given.
+	ErrInvalid = errors.New("invalid")
+	// ErrUnavailable is returned when Firestore cannot be reached in time.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// storeError turns an error returned by Firestore into the repository error
+// it amounts to, keeping only the message of the RPC status so the error
+// can be shown to clients. Errors without an equivalent are returned as
+// they are.
+func storeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	var kind error
+	switch status.Code(err) {
+	case codes.NotFound:
+		kind = ErrNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		kind = ErrConflict
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		kind = ErrInvalid
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		kind = ErrUnavailable
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %s", kind, status.Convert(err).Message())
+}
@@ -4,55 +4,124 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"time"
 
 	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"github.com/NathanRJohnson/live-backend/platform/logging"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
 	"github.com/NathanRJohnson/live-backend/wtfridge/model"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type FirebaseRepo struct {
 	Client *firestore.Client
+	// optional, nothing is recorded when nil
+	Metrics metrics.Recorder
 }
 
-func (r *FirebaseRepo) Insert(ctx context.Context, collection string, item model.Item) error {
-	_, err := r.Client.Collection(collection).Doc(strconv.Itoa(item.GetID())).Set(ctx, item)
+// runTransaction runs f in a transaction like Client.RunTransaction, and
+// records how many attempts it took under method.
+func (r *FirebaseRepo) runTransaction(ctx context.Context, method string, f func(context.Context, *firestore.Transaction) error, opts ...firestore.TransactionOption) error {
+	attempts := 0
+	err := r.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		attempts++
+		return f(ctx, tx)
+	}, opts...)
+	if r.Metrics != nil {
+		r.Metrics.ObserveTransaction(method, attempts)
+	}
+	return err
+}
+
+func (r *FirebaseRepo) GetCollectionRef(name string, parent *firestore.DocumentRef) *firestore.CollectionRef {
+	if parent == nil {
+		return r.Client.Collection(name)
+	}
+	return parent.Collection(name)
+}
+
+func (r *FirebaseRepo) GetDocRef(collection *firestore.CollectionRef, id string) *firestore.DocumentRef {
+	return collection.Doc(id)
+}
+
+func (r *FirebaseRepo) DocExists(ctx context.Context, docRef *firestore.DocumentRef) (bool, error) {
+	defer metrics.Track(r.Metrics, "DocExists")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.DocExists")
+	defer span.End()
+
+	snapshot, err := docRef.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 	return snapshot.Exists(), nil
 }
 
+// Ping makes the cheapest read Firestore allows, to check it can be reached
+// with the credentials the client was given.
+func (r *FirebaseRepo) Ping(ctx context.Context) error {
+	defer metrics.Track(r.Metrics, "Ping")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.Ping")
+	defer span.End()
+
+	_, err := r.Client.Collection("USER").Limit(1).Documents(ctx).GetAll()
+	return err
+}
+
+func (r *FirebaseRepo) CreateUser(ctx context.Context, user model.User) error {
+	defer metrics.Track(r.Metrics, "CreateUser")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.CreateUser")
+	defer span.End()
+
+	_, err := r.Client.Collection("USER").Doc(user.Username).Create(ctx, user)
+	if err != nil {
+		logging.Logger(ctx).Error("Failed creating user", "err", err)
+	}
+	return storeError(err)
+}
+
 func (r *FirebaseRepo) Insert(ctx context.Context, collection interface{}, data map[string]interface{}) error {
+	defer metrics.Track(r.Metrics, "Insert")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.Insert")
+	defer span.End()
+
 	var collectionRef *firestore.CollectionRef
 	if c, ok := collection.(*firestore.CollectionRef); !ok {
-		return errors.New("must pass interface of type firestore.CollectionRef into Insert")
+		return fmt.Errorf("must pass interface of type firestore.CollectionRef into Insert: %w", ErrInvalid)
 	} else {
 		collectionRef = c
 	}
 
 	_, _, err := collectionRef.Add(ctx, data)
 	if err != nil {
-		log.Printf("Failed adding item: %v", err)
+		logging.Logger(ctx).Error("Failed adding item", "err", err)
 	}
 
-	return nil
+	return storeError(err)
 }
 
 func (r *FirebaseRepo) FetchAll(ctx context.Context, collection interface{}) ([]interface{}, error) {
+	defer metrics.Track(r.Metrics, "FetchAll")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchAll")
+	defer span.End()
+
 	var collectionRef *firestore.CollectionRef
 	if c, ok := collection.(*firestore.CollectionRef); !ok {
-		return nil, errors.New("must pass interface of type firestore.CollectionRef into FetchAll")
+		return nil, fmt.Errorf("must pass interface of type firestore.CollectionRef into FetchAll: %w", ErrInvalid)
 	} else {
 		collectionRef = c
 	}
 
-	var items []interface{}
-	iter := r.Client.Collection(collection).Documents(ctx)
+	items := []interface{}{}
+	iter := collectionRef.Documents(ctx)
 
 	for {
 		doc, err := iter.Next()
@@ -60,18 +129,18 @@ func (r *FirebaseRepo) FetchAll(ctx context.Context, collection interface{}) ([]
 			break
 		}
 		if err != nil {
-			return nil, err
+			return nil, storeError(err)
 		}
 
 		// gets empty item
-		item := getItemSchemaByCollection(collection)
+		item := getItemSchemaByCollection(collectionRef.ID)
 		if item == nil {
-			log.Fatal("error getting item schema for collection:", collection)
+			return nil, fmt.Errorf("no item schema for collection: %s", collectionRef.ID)
 		}
 		// fills item with document data
-		err = doc.DataTo(&item)
+		err = doc.DataTo(item)
 		if err != nil {
-			log.Fatalf("error unmarshalling document to item representation: %v", err)
+			return nil, fmt.Errorf("error unmarshalling document to item representation: %w", err)
 		}
 
 		items = append(items, item)
@@ -80,31 +149,30 @@ func (r *FirebaseRepo) FetchAll(ctx context.Context, collection interface{}) ([]
 }
 
 func (r *FirebaseRepo) DeleteByID(ctx context.Context, collection interface{}, id int) error {
+	defer metrics.Track(r.Metrics, "DeleteByID")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.DeleteByID")
+	defer span.End()
+
 	var collectionRef *firestore.CollectionRef
 	if c, ok := collection.(*firestore.CollectionRef); !ok {
-		return errors.New("must pass interface of type firestore.CollectionRef into DeleteByID")
+		return fmt.Errorf("must pass interface of type firestore.CollectionRef into DeleteByID: %w", ErrInvalid)
 	} else {
 		collectionRef = c
 	}
 
 	docs, err := collectionRef.Where("ItemID", "==", id).Documents(ctx).GetAll()
 	if err != nil {
-		return err
+		return storeError(err)
 	} else if len(docs) == 0 {
-		return errors.New("failed to delete document: not found")
+		return fmt.Errorf("failed to delete item %d: %w", id, ErrNotFound)
 	} else if len(docs) > 1 {
-		return errors.New("failed to delete document: multiple documents found with matching IDs")
+		return fmt.Errorf("failed to delete item %d, multiple documents found with matching IDs: %w", id, ErrConflict)
 	}
 
 	doc := docs[0]
 
 	// shift indicies up to account for the deleted item
-	if collection == "grocery" {
-		doc, err := ref.Get(ctx)
-		if err != nil {
-			return err
-		}
-
+	if isGroceryCollection(collectionRef) {
 		data, err := doc.DataAt("Index")
 		if err != nil {
 			return err
@@ -112,16 +180,16 @@ func (r *FirebaseRepo) DeleteByID(ctx context.Context, collection interface{}, i
 
 		removed_index, _ := data.(int64)
 
-		err = r.shiftIndicies(ctx, collection, -1, int(removed_index), 100)
+		err = r.shiftIndicies(ctx, collectionRef, -1, int(removed_index), 100)
 		if err != nil {
-			return err
+			return storeError(err)
 		}
 	}
 
-	_, err := ref.Delete(ctx)
+	_, err = doc.Ref.Delete(ctx)
 	if err != nil {
-		log.Printf("unable to delete item: %v", err)
-		return err
+		logging.Logger(ctx).Error("unable to delete item", "err", err)
+		return storeError(err)
 	}
 
 	return nil
@@ -129,29 +197,35 @@ func (r *FirebaseRepo) DeleteByID(ctx context.Context, collection interface{}, i
 
 // TODO: update this to take any path and any value
 func (r *FirebaseRepo) ToggleActiveByID(ctx context.Context, collection interface{}, id int) error {
+	defer metrics.Track(r.Metrics, "ToggleActiveByID")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.ToggleActiveByID")
+	defer span.End()
+
 	var collectionRef *firestore.CollectionRef
 	if c, ok := collection.(*firestore.CollectionRef); !ok {
-		return errors.New("must pass interface of type firestore.CollectionRef into ToggleActiveByID")
+		return fmt.Errorf("must pass interface of type firestore.CollectionRef into ToggleActiveByID: %w", ErrInvalid)
 	} else {
 		collectionRef = c
 	}
 
 	doc, err := collectionRef.Where("ItemID", "==", id).Documents(ctx).Next()
+	if err == iterator.Done {
+		return fmt.Errorf("failed to toggle item %d: %w", id, ErrNotFound)
+	}
 	if err != nil {
-		return err
+		return storeError(err)
 	}
 
-	err = r.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+	err = r.runTransaction(ctx, "ToggleActiveByID", func(ctx context.Context, tx *firestore.Transaction) error {
 		data, err := doc.DataAt("IsActive")
 		if err != nil {
-			log.Printf("unable to read is_active field: %v", err)
+			logging.Logger(ctx).Error("unable to read is_active field", "err", err)
 			return err
 		}
 
 		is_active, ok := data.(bool)
 		if !ok {
-			log.Printf("unable to convert data to bool")
-			is_active = false
+			logging.Logger(ctx).Info("unable to convert data to bool")
 			return errors.New("unable to convert data to bool")
 		}
 
@@ -163,31 +237,35 @@ func (r *FirebaseRepo) ToggleActiveByID(ctx context.Context, collection interfac
 	})
 
 	if err != nil {
-		log.Printf("unable to toggle activitiy: %v", err)
+		logging.Logger(ctx).Error("unable to toggle activitiy", "err", err)
 	}
 
-	return err
+	return storeError(err)
 }
 
-func (r *FirebaseRepo) UpdateItemByID(ctx context.Context, collection interface{}, id int, itemValues map[string]interface{}) error {
+func (r *FirebaseRepo) UpdateItemByID(ctx context.Context, collection interface{}, id int, item_values map[string]interface{}) error {
+	defer metrics.Track(r.Metrics, "UpdateItemByID")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.UpdateItemByID")
+	defer span.End()
+
 	var collectionRef *firestore.CollectionRef
 	if c, ok := collection.(*firestore.CollectionRef); !ok {
-		return errors.New("must pass interface of type firestore.CollectionRef into UpdateItemByID")
+		return fmt.Errorf("must pass interface of type firestore.CollectionRef into UpdateItemByID: %w", ErrInvalid)
 	} else {
 		collectionRef = c
 	}
 
 	docs, err := collectionRef.Where("ItemID", "==", id).Documents(ctx).GetAll()
 	if err != nil {
-		return err
+		return storeError(err)
 	} else if len(docs) == 0 {
-		return errors.New("failed to delete document: not found")
+		return fmt.Errorf("failed to update item %d: %w", id, ErrNotFound)
 	} else if len(docs) > 1 {
-		return errors.New("failed to delete document: multiple documents found with matching IDs")
+		return fmt.Errorf("failed to update item %d, multiple documents found with matching IDs: %w", id, ErrConflict)
 	}
 
 	doc := docs[0]
-	err = r.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+	err = r.runTransaction(ctx, "UpdateItemByID", func(ctx context.Context, tx *firestore.Transaction) error {
 
 		var updates []firestore.Update
 
@@ -195,52 +273,48 @@ func (r *FirebaseRepo) UpdateItemByID(ctx context.Context, collection interface{
 			updates = append(updates, firestore.Update{Path: path, Value: new_value})
 		}
 
-		return tx.Update(ref, updates)
+		return tx.Update(doc.Ref, updates)
 	})
 
 	if err != nil {
-		log.Printf("unable to update item: %v", err)
+		logging.Logger(ctx).Error("unable to update item", "err", err)
 	}
 
-	return err
+	return storeError(err)
 }
 
 func (r *FirebaseRepo) MoveToFridge(ctx context.Context, userRef interface{}) error {
-	var active_doc_refs *firestore.DocumentIterator
-	var fridge_ref *firestore.CollectionRef
-	var user *firestore.DocumentRef
+	defer metrics.Track(r.Metrics, "MoveToFridge")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.MoveToFridge")
+	defer span.End()
 
-	if u, ok := userRef.(*firestore.DocumentRef); !ok {
-		return errors.New("must pass inteface of type *firestore.DocumentRef")
+	var user *firestore.DocumentRef
+	if u, ok := userRef.(*firestore.DocumentRef); !ok || u == nil {
+		return fmt.Errorf("must pass inteface of type *firestore.DocumentRef: %w", ErrInvalid)
 	} else {
 		user = u
 	}
 
-	if user == nil {
-		active_doc_refs = r.Client.Collection("grocery").Where("IsActive", "==", true).Documents(ctx)
-		fridge_ref = r.Client.Collection("fridge")
-	} else {
-		active_doc_refs = user.Collection("GROCERY").Where("IsActive", "==", true).Documents(ctx)
-		fridge_ref = user.Collection("FRIDGE")
-	}
+	active_doc_refs := user.Collection("GROCERY").Where("IsActive", "==", true).Documents(ctx)
+	fridge_ref := user.Collection("FRIDGE")
 
 	// using a map to act as a set
 	removed_indicies := make(map[int]bool)
 
-	err := r.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+	err := r.runTransaction(ctx, "MoveToFridge", func(ctx context.Context, tx *firestore.Transaction) error {
 		for {
 			doc, err := active_doc_refs.Next()
 			if err == iterator.Done {
 				return r.remapIndiciesFromRemoved(ctx, user, removed_indicies)
 			} else if err != nil {
-				log.Printf("could not iterate through docs: %v", err)
+				logging.Logger(ctx).Error("could not iterate through docs", "err", err)
 				return err
 			}
 
 			var grocery_item model.GroceryItem
 			err = doc.DataTo(&grocery_item)
 			if err != nil {
-				log.Printf("unable to marshal data to grocery schema: %v", err)
+				logging.Logger(ctx).Error("unable to marshal data to grocery schema", "err", err)
 				return err
 			}
 
@@ -248,7 +322,7 @@ func (r *FirebaseRepo) MoveToFridge(ctx context.Context, userRef interface{}) er
 
 			err = tx.Delete(doc.Ref)
 			if err != nil {
-				log.Printf("unable to delete document %s: %v", doc.Ref.ID, err)
+				logging.Logger(ctx).Error("unable to delete document", "doc_id", doc.Ref.ID, "err", err)
 				return err
 			}
 
@@ -269,20 +343,14 @@ func (r *FirebaseRepo) MoveToFridge(ctx context.Context, userRef interface{}) er
 
 			err = tx.Create(&fridge_item_ref, fridge_item)
 			if err != nil {
-				log.Printf("unable to create fridge item %s: %v", fridge_item.Name, err)
+				logging.Logger(ctx).Error("unable to create fridge item", "item_name", fridge_item.Name, "err", err)
 				return err
 			}
 		}
 
 	})
 
-	if err != nil {
-		return err
-	}
-
-	log.Println(removed_indicies)
-
-	return err
+	return storeError(err)
 }
 
 func (r *FirebaseRepo) remapIndiciesFromRemoved(ctx context.Context, userRef *firestore.DocumentRef, removed_indicies map[int]bool) error {
@@ -290,12 +358,7 @@ func (r *FirebaseRepo) remapIndiciesFromRemoved(ctx context.Context, userRef *fi
 		return nil
 	}
 
-	var groceryCollection *firestore.CollectionRef
-	if userRef == nil {
-		groceryCollection = r.Client.Collection("grocery")
-	} else {
-		groceryCollection = userRef.Collection("GROCERY")
-	}
+	groceryCollection := userRef.Collection("GROCERY")
 
 	num_items, err := r.countNumDocs(ctx, groceryCollection)
 	if err != nil {
@@ -315,7 +378,7 @@ func (r *FirebaseRepo) remapIndiciesFromRemoved(ctx context.Context, userRef *fi
 
 		data, err := doc.DataAt("Index")
 		if err != nil {
-			log.Printf("unable to read is_active field: %v", err)
+			logging.Logger(ctx).Error("unable to read index field", "err", err)
 			return err
 		}
 
@@ -323,21 +386,23 @@ func (r *FirebaseRepo) remapIndiciesFromRemoved(ctx context.Context, userRef *fi
 		if !ok {
 			return errors.New("unable to convert data to int")
 		}
-		log.Printf("hello: %d", int(old_index))
 		new_index, ok := new_index_map[int(old_index)]
 		if ok {
-			log.Printf("updating with %d to %d", old_index, new_index)
 			_, err = doc.Ref.Update(ctx, []firestore.Update{{Path: "Index", Value: new_index}})
 			if err != nil {
 				return err
 			}
 		}
 	}
-	return err
+	return nil
+}
+
+func (r *FirebaseRepo) countNumDocs(ctx context.Context, collectionRef *firestore.CollectionRef) (int, error) {
+	return r.countQuery(ctx, collectionRef.Query)
 }
 
-func (r *FirebaseRepo) countNumDocs(ctx context.Context, collection string) (int, error) {
-	query := r.Client.Collection(collection).NewAggregationQuery().WithCount("all")
+func (r *FirebaseRepo) countQuery(ctx context.Context, q firestore.Query) (int, error) {
+	query := q.NewAggregationQuery().WithCount("all")
 	results, err := query.Get(ctx)
 	if err != nil {
 		return 0, err
@@ -354,7 +419,6 @@ func (r *FirebaseRepo) countNumDocs(ctx context.Context, collection string) (int
 }
 
 func computeNewIndexMap(removed_indicies map[int]bool, num_items int) map[int]int {
-	log.Print(removed_indicies)
 	new_map := make(map[int]int)
 	next_available_index := 1
 	for i := 1; i <= num_items; i++ {
@@ -364,66 +428,64 @@ func computeNewIndexMap(removed_indicies map[int]bool, num_items int) map[int]in
 			next_available_index++
 		}
 	}
-	log.Print(new_map)
 	return new_map
 }
 
 func (r *FirebaseRepo) RearrageItems(ctx context.Context, collection interface{}, old_index int64, new_index int64) error {
+	defer metrics.Track(r.Metrics, "RearrageItems")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.RearrageItems")
+	defer span.End()
+
 	var collectionRef *firestore.CollectionRef
 	if c, ok := collection.(*firestore.CollectionRef); !ok {
-		return errors.New("must pass interface of type firestore.CollectionRef into RearrangeItems")
+		return fmt.Errorf("must pass interface of type firestore.CollectionRef into RearrangeItems: %w", ErrInvalid)
 	} else {
 		collectionRef = c
 	}
 
 	max_index, err := r.countNumDocs(ctx, collectionRef)
 	if err != nil {
-		return err
+		return storeError(err)
 	}
 
 	if new_index > int64(max_index) || old_index > int64(max_index) {
-		return errors.New("indicies exceed max index")
+		return fmt.Errorf("indicies exceed max index %d: %w", max_index, ErrInvalid)
 	}
 
-	doc, err := r.Client.Collection(collection).Where("Index", "==", old_index).Documents(ctx).Next()
+	doc, err := collectionRef.Where("Index", "==", old_index).Documents(ctx).Next()
+	if err == iterator.Done {
+		return fmt.Errorf("could not find document with index %d: %w", old_index, ErrNotFound)
+	}
 	if err != nil {
-		return fmt.Errorf("could not find document with index %d", old_index)
+		return storeError(err)
 	}
 
 	if new_index < old_index { // moved up
-		err = r.shiftIndicies(ctx, collection, 1, int(new_index), int(old_index)-1)
+		err = r.shiftIndicies(ctx, collectionRef, 1, int(new_index), int(old_index)-1)
 	} else { // moved down
-		err = r.shiftIndicies(ctx, collection, -1, int(old_index)+1, int(new_index))
+		err = r.shiftIndicies(ctx, collectionRef, -1, int(old_index)+1, int(new_index))
 	}
 	if err != nil {
-		return err
+		return storeError(err)
 	}
 
 	_, err = doc.Ref.Update(ctx, []firestore.Update{{Path: "Index", Value: new_index}})
-	if err != nil {
-		return err
-	}
-
-	return err
+	return storeError(err)
 }
 
-func (r *FirebaseRepo) shiftIndicies(ctx context.Context, collection string, amount int64, start_index int, end_index int) error {
-	err := r.Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		docs := r.Client.Collection(collection).Where("Index", ">=", start_index).Where("Index", "<=", end_index)
-		iter := docs.Documents(ctx)
-
-		for {
-			doc, err := iter.Next()
-			if err == iterator.Done {
-				return nil
-			} else if err != nil {
-				log.Printf("could not iterate through docs: %v", err)
-				return err
-			}
+func (r *FirebaseRepo) shiftIndicies(ctx context.Context, collectionRef *firestore.CollectionRef, amount int64, start_index int, end_index int) error {
+	err := r.runTransaction(ctx, "shiftIndicies", func(ctx context.Context, tx *firestore.Transaction) error {
+		query := collectionRef.Where("Index", ">=", start_index).Where("Index", "<=", end_index)
+		docs, err := tx.Documents(query).GetAll()
+		if err != nil {
+			logging.Logger(ctx).Error("could not iterate through docs", "err", err)
+			return err
+		}
 
+		for _, doc := range docs {
 			data, err := doc.DataAt("Index")
 			if err != nil {
-				log.Printf("unable to read is_active field: %v", err)
+				logging.Logger(ctx).Error("unable to read index field", "err", err)
 				return err
 			}
 
@@ -435,15 +497,133 @@ func (r *FirebaseRepo) shiftIndicies(ctx context.Context, collection string, amo
 				return err
 			}
 		}
+		return nil
 	})
 	return err
 }
 
+// IndexReport describes problems with the Index sequence of a grocery list,
+// which should run from 1 to the number of items without gaps or repeats.
+type IndexReport struct {
+	Items      int   `json:"items"`
+	Missing    []int `json:"missing"`
+	Duplicates []int `json:"duplicates"`
+	OutOfRange []int `json:"out_of_range"`
+}
+
+func (i *IndexReport) IsValid() bool {
+	return len(i.Missing) == 0 && len(i.Duplicates) == 0 && len(i.OutOfRange) == 0
+}
+
+func (r *FirebaseRepo) InspectIndicies(ctx context.Context, collectionRef *firestore.CollectionRef) (*IndexReport, error) {
+	defer metrics.Track(r.Metrics, "InspectIndicies")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.InspectIndicies")
+	defer span.End()
+
+	docs, err := collectionRef.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &IndexReport{
+		Items:      len(docs),
+		Missing:    []int{},
+		Duplicates: []int{},
+		OutOfRange: []int{},
+	}
+
+	counts := make(map[int]int)
+	for _, doc := range docs {
+		data, err := doc.DataAt("Index")
+		if err != nil {
+			return nil, err
+		}
+		index, _ := data.(int64)
+		counts[int(index)]++
+	}
+
+	for index, count := range counts {
+		if index < 1 || index > len(docs) {
+			report.OutOfRange = append(report.OutOfRange, index)
+		}
+		if count > 1 {
+			report.Duplicates = append(report.Duplicates, index)
+		}
+	}
+	for index := 1; index <= len(docs); index++ {
+		if counts[index] == 0 {
+			report.Missing = append(report.Missing, index)
+		}
+	}
+
+	sort.Ints(report.OutOfRange)
+	sort.Ints(report.Duplicates)
+	return report, nil
+}
+
+// RepairIndicies renumbers a grocery list from 1, keeping the current order
+// of its items. Items sharing an index are ordered by ItemID. It returns how
+// many items were given a new index.
+func (r *FirebaseRepo) RepairIndicies(ctx context.Context, collectionRef *firestore.CollectionRef) (int, error) {
+	defer metrics.Track(r.Metrics, "RepairIndicies")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.RepairIndicies")
+	defer span.End()
+
+	changed := 0
+
+	err := r.runTransaction(ctx, "RepairIndicies", func(ctx context.Context, tx *firestore.Transaction) error {
+		changed = 0
+
+		docs, err := tx.Documents(collectionRef).GetAll()
+		if err != nil {
+			return err
+		}
+
+		items := make([]model.GroceryItem, len(docs))
+		for i, doc := range docs {
+			err = doc.DataTo(&items[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		order := make([]int, len(docs))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			ia, ib := items[order[a]], items[order[b]]
+			if ia.Index != ib.Index {
+				return ia.Index < ib.Index
+			}
+			return ia.ItemID < ib.ItemID
+		})
+
+		for position, i := range order {
+			if items[i].Index == position+1 {
+				continue
+			}
+			err = tx.Update(docs[i].Ref, []firestore.Update{{Path: "Index", Value: position + 1}})
+			if err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+
+	return changed, err
+}
+
+func isGroceryCollection(collectionRef *firestore.CollectionRef) bool {
+	return collectionRef.ID == "GROCERY"
+}
+
 func getItemSchemaByCollection(collection string) interface{} {
 	switch collection {
-	case "fridge":
+	case "FRIDGE":
 		return &model.FridgeItem{}
-	case "grocery":
+	case "GROCERY":
 		return &model.GroceryItem{}
 	default:
 		return nil
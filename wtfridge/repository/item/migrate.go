@@ -0,0 +1,141 @@
+package item
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/firestore"
+	"github.com/NathanRJohnson/live-backend/platform/tracing"
+	"github.com/NathanRJohnson/live-backend/wtfridge/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LegacyCollections maps the top level collections used before lists were
+// kept per user to the user subcollection their documents belong in.
+var LegacyCollections = map[string]string{
+	"fridge":  "FRIDGE",
+	"grocery": "GROCERY",
+}
+
+// MigrationConflict is a legacy document that was not migrated because it
+// clashes with one already in the user's collection.
+type MigrationConflict struct {
+	Collection string `json:"collection"`
+	DocID      string `json:"doc_id"`
+	ItemID     int64  `json:"item_id"`
+	Reason     string `json:"reason"`
+}
+
+// FetchLegacyDocuments returns every document in a legacy collection, in the
+// order they should be migrated. Grocery items keep their list order.
+func (r *FirebaseRepo) FetchLegacyDocuments(ctx context.Context, legacy string) ([]*firestore.DocumentSnapshot, error) {
+	defer metrics.Track(r.Metrics, "FetchLegacyDocuments")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.FetchLegacyDocuments")
+	defer span.End()
+
+	if _, ok := LegacyCollections[legacy]; !ok {
+		return nil, fmt.Errorf("unknown legacy collection: %s", legacy)
+	}
+
+	docs, err := r.Client.Collection(legacy).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		a, _ := docs[i].DataAt("Index")
+		b, _ := docs[j].DataAt("Index")
+		ai, _ := a.(int64)
+		bi, _ := b.(int64)
+		if ai != bi {
+			return ai < bi
+		}
+		return docs[i].Ref.ID < docs[j].Ref.ID
+	})
+	return docs, nil
+}
+
+// MigrateDocument copies a legacy document into target, keeping its document
+// ID. Grocery items are given index, so they are appended to the user's list.
+// When move is set the legacy document is deleted in the same transaction.
+// A document that clashes with one in target is left alone and reported as a
+// conflict. With dryRun set the checks are made but nothing is written.
+func (r *FirebaseRepo) MigrateDocument(ctx context.Context, doc *firestore.DocumentSnapshot, target *firestore.CollectionRef, index int, move bool, dryRun bool) (*MigrationConflict, error) {
+	defer metrics.Track(r.Metrics, "MigrateDocument")()
+	ctx, span := tracing.Start(ctx, "FirebaseRepo.MigrateDocument")
+	defer span.End()
+
+	data := doc.Data()
+	itemID, _ := data["ItemID"].(int64)
+	if isGroceryCollection(target) {
+		data["Index"] = index
+	}
+
+	var conflict *MigrationConflict
+	targetRef := target.Doc(doc.Ref.ID)
+
+	migrate := func(ctx context.Context, tx *firestore.Transaction) error {
+		conflict = nil
+
+		matches, err := tx.Documents(target.Where("ItemID", "==", itemID)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(matches) > 0 {
+			conflict = &MigrationConflict{
+				DocID:  doc.Ref.ID,
+				ItemID: itemID,
+				Reason: fmt.Sprintf("item_id already used by %s", matches[0].Ref.Path),
+			}
+			return nil
+		}
+
+		_, err = tx.Get(targetRef)
+		if err == nil {
+			conflict = &MigrationConflict{
+				DocID:  doc.Ref.ID,
+				ItemID: itemID,
+				Reason: fmt.Sprintf("document already exists at %s", targetRef.Path),
+			}
+			return nil
+		}
+		if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if dryRun {
+			return nil
+		}
+
+		err = tx.Create(targetRef, data)
+		if err != nil {
+			return err
+		}
+		if move {
+			return tx.Delete(doc.Ref)
+		}
+		return nil
+	}
+
+	var err error
+	if dryRun {
+		err = r.runTransaction(ctx, "MigrateDocument", migrate, firestore.ReadOnly)
+	} else {
+		err = r.runTransaction(ctx, "MigrateDocument", migrate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if conflict != nil {
+		conflict.Collection = doc.Ref.Parent.ID
+	}
+	return conflict, nil
+}
+
+// CountDocs returns the number of documents in a collection.
+func (r *FirebaseRepo) CountDocs(ctx context.Context, collectionRef *firestore.CollectionRef) (int, error) {
+	return r.countNumDocs(ctx, collectionRef)
+}